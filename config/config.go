@@ -8,10 +8,16 @@ import (
 
 // Config 应用配置结构体
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Auth     AuthConfig     `mapstructure:"auth"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Redis      RedisConfig      `mapstructure:"redis"`
+	Auth       AuthConfig       `mapstructure:"auth"`
+	Mail       MailConfig       `mapstructure:"mail"`
+	Moderation ModerationConfig `mapstructure:"moderation"`
+	Quota      QuotaConfig      `mapstructure:"quota"`
+	Webhooks   WebhookConfig    `mapstructure:"webhooks"`
+	Analytics  AnalyticsConfig  `mapstructure:"analytics"`
+	Privacy    PrivacyConfig    `mapstructure:"privacy"`
 }
 
 // ServerConfig 服务器配置
@@ -19,6 +25,9 @@ type ServerConfig struct {
 	Port    int    `mapstructure:"port"`
 	Host    string `mapstructure:"host"`
 	BaseURL string `mapstructure:"base_url"`
+	// TrustedProxies 可信反向代理的IP或CIDR，只有来自这些地址的请求才按 X-Forwarded-For 取客户端IP
+	// 为空时不信任任何代理，直接使用连接的对端地址
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // DatabaseConfig 数据库配置
@@ -47,6 +56,118 @@ type RedisConfig struct {
 type AuthConfig struct {
 	SecretKey string `mapstructure:"secret_key"`
 	Expires   int    `mapstructure:"expires"` // Token过期时间(小时)
+	// RefreshExpires 刷新令牌过期时间(小时)，为0时使用默认值
+	RefreshExpires int `mapstructure:"refresh_expires"`
+	// RequireAdmin2FA 要求管理员启用两步验证后才能使用管理员接口
+	RequireAdmin2FA bool       `mapstructure:"require_admin_2fa"`
+	TOTPIssuer      string     `mapstructure:"totp_issuer"` // 身份验证器中显示的服务名称
+	OIDC            OIDCConfig `mapstructure:"oidc"`
+	// PasswordResetExpires 找回密码链接有效期(分钟)，为0时使用默认值
+	PasswordResetExpires int `mapstructure:"password_reset_expires"`
+	// PasswordResetsPerHour 每个IP、每个邮箱每小时最多申请找回密码的次数，默认5
+	PasswordResetsPerHour int `mapstructure:"password_resets_per_hour"`
+	// Lockout 登录失败锁定策略
+	Lockout LockoutConfig `mapstructure:"lockout"`
+}
+
+// LockoutConfig 登录失败锁定配置，各项为0时使用默认值
+type LockoutConfig struct {
+	Disabled          bool `mapstructure:"disabled"`
+	MaxFailures       int  `mapstructure:"max_failures"`        // 同一账户连续失败多少次后锁定，默认5
+	IPMaxFailures     int  `mapstructure:"ip_max_failures"`     // 同一IP连续失败多少次后锁定，默认20
+	LockoutMinutes    int  `mapstructure:"lockout_minutes"`     // 首次锁定时长(分钟)，之后每次翻倍，默认15
+	MaxLockoutMinutes int  `mapstructure:"max_lockout_minutes"` // 锁定时长上限(分钟)，默认1440
+	ResetMinutes      int  `mapstructure:"reset_minutes"`       // 超过该时长没有失败记录则重新计数，默认60
+}
+
+// OIDCConfig OpenID Connect单点登录配置
+type OIDCConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	Issuer        string   `mapstructure:"issuer"` // 身份提供方地址，用于自动发现
+	ClientID      string   `mapstructure:"client_id"`
+	ClientSecret  string   `mapstructure:"client_secret"`
+	RedirectURL   string   `mapstructure:"redirect_url"` // 回调地址，需指向 /api/auth/oidc/callback
+	Scopes        []string `mapstructure:"scopes"`
+	UsernameClaim string   `mapstructure:"username_claim"` // 用作用户名的声明，默认 preferred_username
+	GroupsClaim   string   `mapstructure:"groups_claim"`   // 用户组声明，默认 groups
+	AdminGroups   []string `mapstructure:"admin_groups"`   // 属于这些组的用户授予管理员权限
+}
+
+// ModerationConfig 链接被停用后向访问者展示的页面
+type ModerationConfig struct {
+	TakedownStatus  int    `mapstructure:"takedown_status"` // 响应状态码，默认451
+	TakedownTitle   string `mapstructure:"takedown_title"`
+	TakedownMessage string `mapstructure:"takedown_message"`
+	ShowReason      bool   `mapstructure:"show_reason"`      // 是否向访问者展示停用原因
+	Contact         string `mapstructure:"contact"`          // 申诉联系方式，留空则不显示
+	ReportsPerHour  int    `mapstructure:"reports_per_hour"` // 每个IP每小时最多提交的举报数，默认5
+}
+
+// QuotaConfig 用户套餐配置，未配置任何套餐时不限制
+type QuotaConfig struct {
+	DefaultPlan string                `mapstructure:"default_plan"` // 未指定套餐的用户使用的套餐
+	Plans       map[string]PlanConfig `mapstructure:"plans"`
+}
+
+// PlanConfig 套餐限额，数值为0表示不限制
+type PlanConfig struct {
+	MaxActiveLinks int      `mapstructure:"max_active_links" json:"max_active_links"` // 未过期的链接数量上限
+	MaxLinksPerDay int      `mapstructure:"max_links_per_day" json:"max_links_per_day"`
+	MaxExpiryDays  int      `mapstructure:"max_expiry_days" json:"max_expiry_days"` // 有效期上限(天)
+	Features       []string `mapstructure:"features" json:"features"`               // 允许使用的功能，如 custom_alias
+}
+
+// WebhookConfig 外发Webhook配置
+type WebhookConfig struct {
+	Timeout     int `mapstructure:"timeout"`      // 单次投递超时(秒)，默认5
+	MaxAttempts int `mapstructure:"max_attempts"` // 最大投递次数，默认8
+	MaxPerUser  int `mapstructure:"max_per_user"` // 每个用户最多创建的Webhook数量，默认10
+	// AllowPrivateNetworks 允许投递到内网和本机地址，默认禁止以防止SSRF
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
+}
+
+// AnalyticsConfig 访问统计配置
+type AnalyticsConfig struct {
+	// VisitLogging 访问明细的记录方式: full 记录每次访问(默认)，sampled 按 SampleRate 抽样记录，
+	// counts_only 只累计访问次数不记录明细
+	VisitLogging string  `mapstructure:"visit_logging"`
+	SampleRate   float64 `mapstructure:"sample_rate"` // 抽样比例，0到1之间，默认0.1
+	BufferSize   int     `mapstructure:"buffer_size"` // 待写入访问记录的缓冲区大小，默认5000
+	// VisitRetentionDays 访问明细的保留天数，超过后删除已汇总的明细，为0时永久保留
+	VisitRetentionDays int `mapstructure:"visit_retention_days"`
+	// GeoIPDatabase MaxMind格式(.mmdb)的IP地理位置数据库路径，为空时不记录地理位置
+	GeoIPDatabase string `mapstructure:"geoip_database"`
+	GeoIPLanguage string `mapstructure:"geoip_language"` // 地区和城市名称的语言，默认zh-CN，缺失时使用英文
+}
+
+// PrivacyConfig 访问数据的隐私保护配置
+type PrivacyConfig struct {
+	// IPMode 访问明细中IP的保存方式: full 完整保存(默认)，truncate 只保存IPv4的前三段、IPv6的前48位，
+	// hash 保存带密钥的哈希，none 不保存
+	IPMode string `mapstructure:"ip_mode"`
+	// IPHashKey hash 方式的密钥，为空时由 auth.secret_key 派生；修改后按IP删除访问数据时无法匹配之前的记录
+	IPHashKey string `mapstructure:"ip_hash_key"`
+	// HonorDoNotTrack 请求带有 DNT: 1 或 Sec-GPC: 1 时只累计访问次数，不记录明细和独立访客
+	HonorDoNotTrack bool `mapstructure:"honor_do_not_track"`
+	// DiscardUserAgent 解析出浏览器、系统和设备后不保存原始User-Agent
+	DiscardUserAgent bool `mapstructure:"discard_user_agent"`
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Driver  string     `mapstructure:"driver"` // smtp、file 或 log
+	From    string     `mapstructure:"from"`
+	FileDir string     `mapstructure:"file_dir"` // file 驱动写入的目录
+	SMTP    SMTPConfig `mapstructure:"smtp"`
+}
+
+// SMTPConfig SMTP服务器配置
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	TLS      bool   `mapstructure:"tls"` // 使用隐式TLS(465端口)，否则自动尝试STARTTLS
 }
 
 // LoadConfig 加载配置文件
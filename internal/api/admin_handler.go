@@ -2,14 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"shorturl/config"
 	"shorturl/internal/model"
 	"shorturl/internal/service"
 )
@@ -18,13 +21,15 @@ import (
 type AdminHandler struct {
 	authService service.AuthService
 	urlService  service.URLService
+	quota       config.QuotaConfig
 }
 
 // NewAdminHandler 创建管理员处理器
-func NewAdminHandler(authService service.AuthService, urlService service.URLService) *AdminHandler {
+func NewAdminHandler(authService service.AuthService, urlService service.URLService, quota config.QuotaConfig) *AdminHandler {
 	return &AdminHandler{
 		authService: authService,
 		urlService:  urlService,
+		quota:       quota,
 	}
 }
 
@@ -37,6 +42,8 @@ func (h *AdminHandler) GetDashboardStats(c *gin.Context) {
 		TotalLinks   int64 `json:"total_links"`
 		ExpiredLinks int64 `json:"expired_links"`
 		TotalVisits  int64 `json:"total_visits"` // 添加总访问量字段
+		// VisitLogging 访问明细的记录方式，以及启动以来丢弃或写入失败的明细数
+		VisitLogging service.VisitLogStats `json:"visit_logging"`
 	}
 
 	// 获取用户总数
@@ -58,6 +65,8 @@ func (h *AdminHandler) GetDashboardStats(c *gin.Context) {
 		stats.TotalVisits = 0 // 设置默认值
 	}
 
+	stats.VisitLogging = h.urlService.VisitLogStats()
+
 	c.JSON(http.StatusOK, stats)
 }
 
@@ -108,20 +117,280 @@ func (h *AdminHandler) ResetUserPassword(c *gin.Context) {
 		return
 	}
 
-	// 默认重置为简单密码，实际应用中应该生成随机密码
-	password := "123456"
+	setAuditTarget(c, "user", c.Param("id"))
 
-	// 重置密码
-	if err := h.authService.ResetPassword(c.Request.Context(), uint(userID), password); err != nil {
+	// 生成随机临时密码，用户下次登录后必须修改
+	password, err := h.authService.ResetPasswordTemporary(c.Request.Context(), uint(userID))
+	if errors.Is(err, service.ErrOIDCPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		logrus.Errorf("重置密码失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
 		return
 	}
 
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "密码已重置，用户下次登录后需修改密码",
+		"temporary_password": password,
+	})
+}
+
+// SetUserRole 修改用户角色
+func (h *AdminHandler) SetUserRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	var before model.User
+	c.MustGet("db").(*gorm.DB).Select("role").First(&before, userID)
+	setAuditChange(c, "user", c.Param("id"), gin.H{"role": before.Role}, gin.H{"role": req.Role})
+
+	if err := h.authService.SetUserRole(c.Request.Context(), uint(userID), req.Role); err != nil {
+		logrus.Warnf("修改用户角色失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "角色已更新"})
+}
+
+// SetUserPlan 修改用户套餐，plan为空字符串时恢复为默认套餐
+func (h *AdminHandler) SetUserPlan(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	var before model.User
+	c.MustGet("db").(*gorm.DB).Select("plan").First(&before, userID)
+	setAuditChange(c, "user", c.Param("id"), gin.H{"plan": before.Plan}, gin.H{"plan": req.Plan})
+
+	if err := h.authService.SetUserPlan(c.Request.Context(), uint(userID), req.Plan); err != nil {
+		logrus.Warnf("修改用户套餐失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "套餐已更新"})
+}
+
+// GetPlans 获取配置中的全部套餐
+func (h *AdminHandler) GetPlans(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"default_plan": h.quota.DefaultPlan,
+		"plans":        h.quota.Plans,
+	})
+}
+
+// CreateUser 创建用户，未提供密码时返回一次性的临时密码
+func (h *AdminHandler) CreateUser(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required,min=3,max=64"`
+		Email    string `json:"email" binding:"omitempty,email"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	user, temporary, err := h.authService.CreateUser(c.Request.Context(), req.Username, req.Password, req.Email, req.Role)
+	if err != nil {
+		logrus.Warnf("创建用户失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditChange(c, "user", strconv.FormatUint(uint64(user.ID), 10), nil,
+		gin.H{"username": user.Username, "email": user.Email, "role": user.Role})
+
+	resp := gin.H{
+		"message": "用户已创建",
+		"user":    user,
+	}
+	if temporary != "" {
+		c.Header("Cache-Control", "no-store")
+		resp["temporary_password"] = temporary
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// UpdateUser 修改用户名或邮箱
+func (h *AdminHandler) UpdateUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req struct {
+		Username *string `json:"username"`
+		Email    *string `json:"email" binding:"omitempty,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	var before model.User
+	c.MustGet("db").(*gorm.DB).Select("username", "email").First(&before, userID)
+
+	user, err := h.authService.UpdateUser(c.Request.Context(), uint(userID), service.UserUpdate{
+		Username: req.Username,
+		Email:    req.Email,
+	})
+	if err != nil {
+		logrus.Warnf("修改用户失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditChange(c, "user", c.Param("id"),
+		gin.H{"username": before.Username, "email": before.Email},
+		gin.H{"username": user.Username, "email": user.Email})
+
+	c.JSON(http.StatusOK, gin.H{"message": "用户信息已更新", "user": user})
+}
+
+// DisableUser 禁用账户，已登录的会话立即失效
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	h.setUserDisabled(c, true)
+}
+
+// EnableUser 重新启用账户
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	h.setUserDisabled(c, false)
+}
+
+func (h *AdminHandler) setUserDisabled(c *gin.Context, disabled bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	setAuditChange(c, "user", c.Param("id"), gin.H{"disabled": !disabled}, gin.H{"disabled": disabled})
+
+	current := c.MustGet("user").(*model.User)
+	if disabled && uint(userID) == current.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能禁用自己的账户"})
+		return
+	}
+
+	if err := h.authService.SetUserDisabled(c.Request.Context(), uint(userID), disabled); err != nil {
+		logrus.Warnf("更新账户状态失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if disabled {
+		c.JSON(http.StatusOK, gin.H{"message": "账户已禁用"})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"message": "账户已启用"})
+	}
+}
+
+// DeleteUser 删除用户
+// 通过查询参数选择链接的处理方式: links=delete 删除其个人链接，transfer_to=<用户ID> 转移给其他用户
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var transferTo uint64
+	if v := c.Query("transfer_to"); v != "" {
+		if transferTo, err = strconv.ParseUint(v, 10, 64); err != nil || transferTo == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的接收用户ID"})
+			return
+		}
+	} else if c.Query("links") != "delete" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择删除或转移该用户的链接"})
+		return
+	}
+
+	current := c.MustGet("user").(*model.User)
+	if uint(userID) == current.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能删除自己的账户"})
+		return
+	}
+
+	var before model.User
+	c.MustGet("db").(*gorm.DB).Select("username", "email", "role").First(&before, userID)
+	after := gin.H{"links": "delete"}
+	if transferTo != 0 {
+		after = gin.H{"links": "transfer", "transfer_to": transferTo}
+	}
+	setAuditChange(c, "user", c.Param("id"),
+		gin.H{"username": before.Username, "email": before.Email, "role": before.Role}, after)
+
+	deleted, err := h.authService.DeleteUser(c.Request.Context(), uint(userID), uint(transferTo))
+	if err != nil {
+		logrus.Warnf("删除用户失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.urlService.InvalidateCache(c.Request.Context(), deleted...)
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "密码已重置为: " + password,
+		"message":       "用户已删除",
+		"deleted_links": len(deleted),
 	})
 }
 
+// ListLoginLockouts 获取登录失败记录，locked=true 时只返回当前处于锁定状态的记录
+func (h *AdminHandler) ListLoginLockouts(c *gin.Context) {
+	throttles, err := h.authService.ListLoginThrottles(c.Request.Context(), c.Query("locked") == "true")
+	if err != nil {
+		logrus.Errorf("获取登录锁定记录失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录锁定记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, throttles)
+}
+
+// ClearLoginLockout 解除账户或IP的登录锁定
+func (h *AdminHandler) ClearLoginLockout(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的记录ID"})
+		return
+	}
+
+	throttle, err := h.authService.ClearLoginThrottle(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditChange(c, "login_lockout", c.Param("id"),
+		gin.H{"scope": throttle.Scope, "identifier": throttle.Identifier, "locked_until": throttle.LockedUntil}, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+}
+
 // ExportSystemData 导出系统数据
 func (h *AdminHandler) ExportSystemData(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
@@ -161,3 +430,24 @@ func (h *AdminHandler) ExportSystemData(c *gin.Context) {
 		return
 	}
 }
+
+// EraseVisitsByIP 删除某个IP在全部链接上的访问明细，用于处理访问者的删除请求
+func (h *AdminHandler) EraseVisitsByIP(c *gin.Context) {
+	var req struct {
+		IP string `json:"ip" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定IP地址"})
+		return
+	}
+
+	erased, err := h.urlService.EraseVisitsByIP(c.Request.Context(), strings.TrimSpace(req.IP), nil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 审计日志不记录IP本身
+	setAuditChange(c, "url_visits", "all", nil, gin.H{"erased": erased})
+
+	c.JSON(http.StatusOK, gin.H{"message": "访问明细已删除", "erased": erased})
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"shorturl/internal/model"
+	"shorturl/internal/service"
+)
+
+const auditContextKey = "audit"
+
+// auditActions 路由到审计动作名称的映射，未列出的路由使用 "方法 路径" 作为动作名
+var auditActions = map[string]string{
+	"POST /api/auth/register":                    "user.register",
+	"POST /api/auth/login":                       "auth.login",
+	"POST /api/auth/refresh":                     "auth.refresh",
+	"POST /api/auth/logout":                      "auth.logout",
+	"POST /api/auth/logout-all":                  "auth.logout_all",
+	"PUT /api/auth/password":                     "auth.password_change",
+	"POST /api/auth/password/forgot":             "auth.password_forgot",
+	"POST /api/auth/password/reset":              "auth.password_reset",
+	"POST /api/auth/2fa/verify":                  "auth.2fa_verify",
+	"POST /api/auth/2fa/setup":                   "auth.2fa_setup",
+	"POST /api/auth/2fa/enable":                  "auth.2fa_enable",
+	"POST /api/auth/2fa/disable":                 "auth.2fa_disable",
+	"POST /api/auth/2fa/recovery-codes":          "auth.recovery_codes",
+	"POST /api/urls":                             "url.create",
+	"DELETE /api/urls/:code":                     "url.delete",
+	"POST /api/urls/:code/transfer":              "url.transfer",
+	"POST /api/urls/cleanup":                     "url.cleanup",
+	"POST /api/moderation/links/:code/disable":   "url.disable",
+	"POST /api/moderation/links/:code/enable":    "url.enable",
+	"POST /api/moderation/reports/:id/resolve":   "report.resolve",
+	"POST /api/reports":                          "report.submit",
+	"POST /api/webhooks":                         "webhook.create",
+	"PATCH /api/webhooks/:id":                    "webhook.update",
+	"DELETE /api/webhooks/:id":                   "webhook.delete",
+	"POST /api/webhooks/:id/test":                "webhook.test",
+	"POST /api/workspaces":                       "workspace.create",
+	"POST /api/workspaces/:id/invites":           "workspace.invite",
+	"PUT /api/workspaces/:id/members/:userId":    "workspace.member_role",
+	"DELETE /api/workspaces/:id/members/:userId": "workspace.member_remove",
+	"POST /api/workspace-invites/:id/accept":     "workspace.invite_accept",
+	"POST /api/workspace-invites/:id/decline":    "workspace.invite_decline",
+	"POST /api/admin/users":                      "user.create",
+	"PATCH /api/admin/users/:id":                 "user.update",
+	"DELETE /api/admin/users/:id":                "user.delete",
+	"POST /api/admin/users/:id/disable":          "user.disable",
+	"POST /api/admin/users/:id/enable":           "user.enable",
+	"POST /api/admin/users/:id/reset-password":   "user.reset_password",
+	"PUT /api/admin/users/:id/role":              "user.set_role",
+	"PUT /api/admin/users/:id/plan":              "user.set_plan",
+	"DELETE /api/admin/lockouts/:id":             "auth.lockout_clear",
+}
+
+// auditDetail 由处理器补充的审计目标和变更摘要
+type auditDetail struct {
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// setAuditTarget 记录本次请求操作的对象
+func setAuditTarget(c *gin.Context, targetType, targetID string) {
+	setAuditChange(c, targetType, targetID, nil, nil)
+}
+
+// setAuditChange 记录本次请求操作的对象及变更前后的摘要，摘要中不得包含密码等敏感信息
+func setAuditChange(c *gin.Context, targetType, targetID string, before, after interface{}) {
+	c.Set(auditContextKey, &auditDetail{
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     before,
+		After:      after,
+	})
+}
+
+// AuditHandler 审计日志处理器
+type AuditHandler struct {
+	auditService service.AuditService
+}
+
+// NewAuditHandler 创建审计日志处理器
+func NewAuditHandler(auditService service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// Middleware 为所有修改类请求写入审计日志
+// 在请求处理完成后记录，因此能拿到认证中间件设置的用户和最终的响应状态
+func (h *AuditHandler) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			// 未匹配到路由的请求不记录
+			return
+		}
+
+		action, ok := auditActions[method+" "+route]
+		if !ok {
+			action = method + " " + route
+		}
+
+		entry := &model.AuditLog{
+			Action:    action,
+			Method:    method,
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+			IP:        c.ClientIP(),
+			UserAgent: truncateString(c.Request.UserAgent(), 512),
+		}
+
+		if user, exists := c.Get("user"); exists {
+			u := user.(*model.User)
+			entry.ActorID = u.ID
+			entry.ActorName = u.Username
+		}
+
+		if detail, exists := c.Get(auditContextKey); exists {
+			d := detail.(*auditDetail)
+			entry.TargetType = d.TargetType
+			entry.TargetID = d.TargetID
+			entry.Before = auditSummary(d.Before)
+			entry.After = auditSummary(d.After)
+		} else if len(c.Params) > 0 {
+			entry.TargetID = c.Params[0].Value
+		}
+
+		// 请求上下文可能已被取消，使用独立的上下文保证日志写入
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		if err := h.auditService.Record(ctx, entry); err != nil {
+			logrus.Errorf("记录审计日志失败: %v", err)
+		}
+	}
+}
+
+// ListAuditLogs 分页查询审计日志
+func (h *AuditHandler) ListAuditLogs(c *gin.Context) {
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	logs, total, err := h.auditService.Query(c.Request.Context(), filter)
+	if err != nil {
+		logrus.Errorf("查询审计日志失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": logs,
+	})
+}
+
+// ExportAuditLogs 以NDJSON格式导出审计日志，供SIEM采集
+func (h *AuditHandler) ExportAuditLogs(c *gin.Context) {
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	fileName := "audit_" + time.Now().Format("20060102_150405") + ".ndjson"
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	if err := h.auditService.Export(c.Request.Context(), filter, c.Writer); err != nil {
+		logrus.Errorf("导出审计日志失败: %v", err)
+	}
+}
+
+// parseAuditFilter 解析查询参数，时间参数使用RFC3339格式
+func parseAuditFilter(c *gin.Context) (service.AuditFilter, bool) {
+	filter := service.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	if v := c.Query("actor_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的操作者ID"})
+			return filter, false
+		}
+		filter.ActorID = uint(id)
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "时间格式应为RFC3339: " + p.name})
+				return filter, false
+			}
+			*p.dst = t
+		}
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	return filter, true
+}
+
+// auditSummary 将变更摘要序列化为JSON
+func auditSummary(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// truncateString 截断超长字符串以适配字段长度
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -35,6 +37,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
 		return
 	}
+	setAuditChange(c, "user", req.Username, nil, gin.H{"email": req.Email})
 	
 	user, err := h.authService.Register(c.Request.Context(), req.Username, req.Password, req.Email)
 	if err != nil {
@@ -64,20 +67,294 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
 		return
 	}
+	setAuditTarget(c, "user", req.Username)
 	
-	token, err := h.authService.Login(c.Request.Context(), req.Username, req.Password)
+	result, err := h.authService.Login(c.Request.Context(), req.Username, req.Password, clientInfo(c))
 	if err != nil {
 		logrus.Warnf("用户登录失败: %v", err)
+		if respondLoginRejected(c, err) {
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 		return
 	}
 	
+	// 启用了两步验证，客户端需携带挑战令牌和验证码调用 /api/auth/2fa/verify
+	if result.Tokens == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "请输入两步验证码",
+			"two_factor_required": true,
+			"challenge_token":     result.ChallengeToken,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":                   "登录成功",
+		"token":                     result.Tokens.AccessToken,
+		"refresh_token":             result.Tokens.RefreshToken,
+		"expires_at":                result.Tokens.ExpiresAt,
+		"must_change_password":      result.MustChangePassword,
+		"two_factor_setup_required": result.TwoFactorSetupRequired,
+	})
+}
+
+// respondLoginRejected 登录被临时锁定时返回429并设置 Retry-After，账户被禁用时返回403
+func respondLoginRejected(c *gin.Context, err error) bool {
+	if errors.Is(err, service.ErrAccountDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用，请联系管理员"})
+		return true
+	}
+
+	var locked *service.LoginLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error()})
+	return true
+}
+
+// ChangePassword 修改当前用户的密码，其他设备上的会话会被注销
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	tokens, err := h.authService.ChangePassword(c.Request.Context(), user.ID, req.CurrentPassword, req.NewPassword, clientInfo(c))
+	if err != nil {
+		logrus.Warnf("修改密码失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "密码已修改",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+	})
+}
+
+// ForgotPassword 发送找回密码邮件，无论邮箱是否存在都返回相同的响应
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入有效的邮箱"})
+		return
+	}
+	setAuditTarget(c, "email", req.Email)
+
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email, c.ClientIP()); err != nil {
+		if errors.Is(err, service.ErrPasswordResetRateLimited) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		logrus.Errorf("处理找回密码请求失败: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "如果该邮箱已注册，您将收到一封重置密码的邮件"})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	if err := h.authService.ResetPasswordWithToken(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		logrus.Warnf("重置密码失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
+
+// VerifyTwoFactor 登录第二步，校验两步验证码或恢复码
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	tokens, err := h.authService.VerifyTwoFactor(c.Request.Context(), req.ChallengeToken, req.Code, clientInfo(c))
+	if err != nil {
+		logrus.Warnf("两步验证失败: %v", err)
+		if respondLoginRejected(c, err) {
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误或已过期"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "登录成功",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+	})
+}
+
+// SetupTwoFactor 生成两步验证密钥和二维码
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+
+	setup, err := h.authService.SetupTwoFactor(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("生成两步验证密钥失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// EnableTwoFactor 确认绑定并启用两步验证
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	codes, err := h.authService.EnableTwoFactor(c.Request.Context(), user.ID, req.Code)
+	if err != nil {
+		logrus.Warnf("启用两步验证失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "两步验证已启用，请妥善保存恢复码",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor 关闭两步验证
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req struct {
+		Password string `json:"password"` // 本地账户必填，单点登录账户不需要
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	if err := h.authService.DisableTwoFactor(c.Request.Context(), user.ID, req.Password, req.Code); err != nil {
+		logrus.Warnf("关闭两步验证失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	codes, err := h.authService.RegenerateRecoveryCodes(c.Request.Context(), user.ID, req.Code)
+	if err != nil {
+		logrus.Warnf("重新生成恢复码失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "恢复码已重新生成",
+		"recovery_codes": codes,
+	})
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(c.Request.Context(), req.RefreshToken, clientInfo(c))
+	if err != nil {
+		logrus.Warnf("刷新令牌失败: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "刷新令牌无效或已过期"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "登录成功",
-		"token":   token,
+		"message":       "刷新成功",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
 	})
 }
 
+// Logout 注销当前会话
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if err := h.authService.Logout(c.Request.Context(), c.GetString("token")); err != nil {
+		logrus.Errorf("注销会话失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销失败"})
+		return
+	}
+
+	c.SetCookie("auth_token", "", -1, "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// LogoutAll 注销当前用户在所有设备上的会话
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+
+	if err := h.authService.LogoutAll(c.Request.Context(), user.ID); err != nil {
+		logrus.Errorf("注销全部会话失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销失败"})
+		return
+	}
+
+	c.SetCookie("auth_token", "", -1, "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{"message": "已在所有设备上退出登录"})
+}
+
 // AuthMiddleware 认证中间件
 func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -103,12 +380,53 @@ func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		
-		// 将用户信息保存到上下文中
+		// 将用户信息和原始令牌保存到上下文中
 		c.Set("user", user)
+		c.Set("token", tokenString)
+
+		// 管理员重置密码后，修改密码前只允许访问修改密码和退出登录接口
+		if user.MustChangePassword && !passwordChangeAllowedPaths[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "请先修改密码",
+				"code":  "password_change_required",
+			})
+			c.Abort()
+			return
+		}
+
+		// 管理员两步验证策略对密码登录和单点登录同样生效，启用前只允许设置两步验证和退出登录
+		if h.authService.TwoFactorSetupRequired(user) && !twoFactorSetupAllowedPaths[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "管理员账户需要先启用两步验证",
+				"code":  "two_factor_setup_required",
+			})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
 
+// passwordChangeAllowedPaths 需要修改密码的用户仍可访问的接口
+// 同时需要启用两步验证的管理员须能在修改密码前后完成设置，两个列表互相包含对方的接口
+var passwordChangeAllowedPaths = map[string]bool{
+	"/api/auth/password":   true,
+	"/api/auth/2fa/setup":  true,
+	"/api/auth/2fa/enable": true,
+	"/api/auth/logout":     true,
+	"/api/auth/logout-all": true,
+}
+
+// twoFactorSetupAllowedPaths 需要启用两步验证的管理员仍可访问的接口
+var twoFactorSetupAllowedPaths = map[string]bool{
+	"/api/auth/2fa/setup":  true,
+	"/api/auth/2fa/enable": true,
+	"/api/auth/password":   true,
+	"/api/auth/logout":     true,
+	"/api/auth/logout-all": true,
+}
+
 // AdminMiddleware 管理员权限中间件
 func (h *AuthHandler) AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -120,11 +438,45 @@ func (h *AuthHandler) AdminMiddleware() gin.HandlerFunc {
 		}
 		
 		user, ok := userInterface.(*model.User)
-		if !ok || !user.IsAdmin {
+		if !ok || user.Role != model.RoleAdmin {
 			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
 			c.Abort()
 			return
 		}
+
+		// 管理员两步验证策略
+		if h.authService.TwoFactorSetupRequired(user) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "管理员账户需要先启用两步验证",
+				"code":  "two_factor_setup_required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission 权限检查中间件，需在认证中间件之后使用
+func (h *AuthHandler) RequirePermission(perm model.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userInterface, exists := c.Get("user")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+			c.Abort()
+			return
+		}
+
+		user, ok := userInterface.(*model.User)
+		if !ok || !user.Can(perm) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "没有执行此操作的权限",
+				"permission": perm,
+			})
+			c.Abort()
+			return
+		}
 		
 		c.Next()
 	}
@@ -151,8 +503,17 @@ func (h *AuthHandler) WebAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		
-		// 将用户信息保存到上下文中
+		// 将用户信息和原始令牌保存到上下文中
 		c.Set("user", user)
+		c.Set("token", tokenCookie)
 		c.Next()
 	}
 }
+
+// clientInfo 提取请求方的客户端信息
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"shorturl/internal/model"
+	"shorturl/internal/service"
+)
+
+// CampaignHandler 营销活动处理器
+type CampaignHandler struct {
+	campaignService  service.CampaignService
+	urlService       service.URLService
+	workspaceService service.WorkspaceService
+}
+
+// NewCampaignHandler 创建营销活动处理器
+func NewCampaignHandler(campaignService service.CampaignService, urlService service.URLService, workspaceService service.WorkspaceService) *CampaignHandler {
+	return &CampaignHandler{
+		campaignService:  campaignService,
+		urlService:       urlService,
+		workspaceService: workspaceService,
+	}
+}
+
+// ListCampaigns 获取当前团队空间或用户个人的营销活动
+func (h *CampaignHandler) ListCampaigns(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+	var workspaceID uint
+	if member := activeWorkspace(c); member != nil {
+		workspaceID = member.WorkspaceID
+	}
+
+	campaigns, err := h.campaignService.ListCampaigns(c.Request.Context(), user.ID, workspaceID)
+	if err != nil {
+		logrus.Errorf("获取营销活动失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取营销活动失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, campaigns)
+}
+
+// CreateCampaign 在当前团队空间或个人空间创建营销活动
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description" binding:"max=512"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	var workspaceID uint
+	if member := activeWorkspace(c); member != nil {
+		if !model.WorkspaceRoleAtLeast(member.Role, model.WorkspaceRoleEditor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权在该团队空间创建营销活动"})
+			return
+		}
+		workspaceID = member.WorkspaceID
+	}
+
+	campaign, err := h.campaignService.CreateCampaign(c.Request.Context(), user.ID, workspaceID, req.Name, req.Description)
+	if err != nil {
+		logrus.Warnf("创建营销活动失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditChange(c, "campaign", strconv.FormatUint(uint64(campaign.ID), 10), nil, gin.H{
+		"name":         campaign.Name,
+		"workspace_id": campaign.WorkspaceID,
+	})
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// UpdateCampaign 修改营销活动的名称或说明
+func (h *CampaignHandler) UpdateCampaign(c *gin.Context) {
+	campaign, ok := h.authorizeCampaign(c, true)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description" binding:"omitempty,max=512"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+	before := gin.H{"name": campaign.Name, "description": campaign.Description}
+
+	campaign, err := h.campaignService.UpdateCampaign(c.Request.Context(), campaign.ID, service.CampaignUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		logrus.Warnf("更新营销活动失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditChange(c, "campaign", c.Param("id"), before, gin.H{"name": campaign.Name, "description": campaign.Description})
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// DeleteCampaign 删除营销活动，活动中的链接保留
+func (h *CampaignHandler) DeleteCampaign(c *gin.Context) {
+	campaign, ok := h.authorizeCampaign(c, true)
+	if !ok {
+		return
+	}
+	setAuditChange(c, "campaign", c.Param("id"), gin.H{
+		"name":         campaign.Name,
+		"workspace_id": campaign.WorkspaceID,
+	}, nil)
+
+	if err := h.campaignService.DeleteCampaign(c.Request.Context(), campaign.ID); err != nil {
+		logrus.Errorf("删除营销活动失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除营销活动失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "营销活动已删除"})
+}
+
+// GetCampaignStats 获取营销活动全部链接的汇总统计，支持 from、to、interval、tz 查询参数
+func (h *CampaignHandler) GetCampaignStats(c *gin.Context) {
+	campaign, ok := h.authorizeCampaign(c, false)
+	if !ok {
+		return
+	}
+
+	r, ok := parseStatsRange(c, defaultStatsDays)
+	if !ok {
+		return
+	}
+
+	stats, err := h.campaignService.GetCampaignStats(c.Request.Context(), campaign.ID, r)
+	if err != nil {
+		logrus.Errorf("获取营销活动统计失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取营销活动统计失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// SetURLCampaign 将已有的短链接归入营销活动，campaign_id为0时移出活动
+func (h *CampaignHandler) SetURLCampaign(c *gin.Context) {
+	var req struct {
+		CampaignID *uint `json:"campaign_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定营销活动"})
+		return
+	}
+
+	shortCode := c.Param("code")
+	url, ok := authorizeURL(c, h.urlService, h.workspaceService, shortCode, urlAccessManage)
+	if !ok {
+		return
+	}
+	if *req.CampaignID != 0 {
+		campaign, err := h.campaignService.GetCampaign(c.Request.Context(), *req.CampaignID)
+		if err != nil || !campaignInScope(campaign, url.UserID, url.WorkspaceID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "营销活动不存在或与链接不在同一空间"})
+			return
+		}
+	}
+	setAuditChange(c, "url", shortCode, gin.H{"campaign_id": url.CampaignID}, gin.H{"campaign_id": *req.CampaignID})
+
+	if err := h.campaignService.AssignURL(c.Request.Context(), shortCode, *req.CampaignID); err != nil {
+		logrus.Errorf("修改链接所属活动失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改链接所属活动失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "链接所属活动已更新", "campaign_id": *req.CampaignID})
+}
+
+// authorizeCampaign 加载路径中的营销活动并校验当前用户的访问权限，规则与 authorizeURL 相同，审核权限不能修改活动
+// 校验失败时已写入响应，调用方直接返回即可
+func (h *CampaignHandler) authorizeCampaign(c *gin.Context, write bool) (*model.Campaign, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的营销活动ID"})
+		return nil, false
+	}
+	campaign, err := h.campaignService.GetCampaign(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "营销活动不存在"})
+		return nil, false
+	}
+
+	user := c.MustGet("user").(*model.User)
+	allowed := false
+	switch {
+	case !write && user.Can(model.PermLinkReadAny):
+		allowed = true
+	case campaign.WorkspaceID == 0:
+		allowed = campaign.UserID == user.ID
+	default:
+		if member, err := h.workspaceService.GetMembership(c.Request.Context(), campaign.WorkspaceID, user.ID); err == nil {
+			allowed = !write || model.WorkspaceRoleAtLeast(member.Role, model.WorkspaceRoleEditor)
+		}
+	}
+
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该营销活动"})
+		return nil, false
+	}
+	return campaign, true
+}
+
+// campaignInScope 判断活动与链接是否属于同一空间: 同一团队空间，或同一用户的个人空间
+func campaignInScope(campaign *model.Campaign, userID, workspaceID uint) bool {
+	if campaign.WorkspaceID != workspaceID {
+		return false
+	}
+	return workspaceID != 0 || campaign.UserID == userID
+}
@@ -5,21 +5,23 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
 	"shorturl/internal/model"
+	"shorturl/internal/service"
 )
 
 // DashboardHandler 处理仪表板API请求
 type DashboardHandler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	urlService service.URLService
 }
 
 // NewDashboardHandler 创建仪表板处理器
-func NewDashboardHandler(db *gorm.DB) *DashboardHandler {
+func NewDashboardHandler(db *gorm.DB, urlService service.URLService) *DashboardHandler {
 	return &DashboardHandler{
-		db: db,
+		db:         db,
+		urlService: urlService,
 	}
 }
 
@@ -33,74 +35,67 @@ func (h *DashboardHandler) GetDashboardData(c *gin.Context) {
 
 	userID := user.(*model.User).ID
 
+	// 统计范围：当前团队空间的全部链接，或用户个人的链接
+	scope := func(db *gorm.DB) *gorm.DB {
+		if member := activeWorkspace(c); member != nil {
+			return db.Where("workspace_id = ?", member.WorkspaceID)
+		}
+		return db.Where("user_id = ? AND workspace_id = 0", userID)
+	}
+
+	r, ok := parseStatsRange(c, defaultDashboardDays)
+	if !ok {
+		return
+	}
+
 	// 准备响应数据结构
 	dashboardData := struct {
 		TotalLinks  int64              `json:"total_links"`
 		TotalVisits int64              `json:"total_visits"`
 		ActiveLinks int64              `json:"active_links"`
 		RecentLinks []model.URL        `json:"recent_links"`
-		VisitsTrend []model.DailyVisit `json:"visits_trend"`
-	}{}
+		VisitsTrend []model.DailyVisit `json:"visits_trend"` // 按 interval 分组，没有访问的时间段为0
+		// TopCountries 时间范围内访问最多的国家或地区，未配置GeoIP数据库时为空
+		TopCountries []model.Breakdown `json:"top_countries"`
+		From         time.Time         `json:"from"`
+		To           time.Time         `json:"to"`
+		Interval     string            `json:"interval"`
+		Timezone     string            `json:"timezone"`
+	}{
+		TopCountries: []model.Breakdown{},
+		From:         r.From,
+		To:           r.To,
+		Interval:     r.Interval,
+		Timezone:     r.TimezoneName(),
+	}
 
-	// 获取用户的链接总数
-	h.db.Model(&model.URL{}).Where("user_id = ?", userID).Count(&dashboardData.TotalLinks)
+	// 获取链接总数
+	h.db.Model(&model.URL{}).Scopes(scope).Count(&dashboardData.TotalLinks)
 
-	// 获取用户所有链接的总访问量
-	h.db.Model(&model.URL{}).Where("user_id = ?", userID).Select("SUM(visits)").Scan(&dashboardData.TotalVisits)
+	// 获取所有链接的总访问量
+	h.db.Model(&model.URL{}).Scopes(scope).Select("SUM(visits)").Scan(&dashboardData.TotalVisits)
 
-	// 获取用户的活跃链接数（未过期的）
-	h.db.Model(&model.URL{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Count(&dashboardData.ActiveLinks)
+	// 获取活跃链接数（未过期的）
+	h.db.Model(&model.URL{}).Scopes(scope).Where("expires_at > ?", time.Now()).Count(&dashboardData.ActiveLinks)
 
 	// 获取最近创建的5个链接
-	h.db.Where("user_id = ?", userID).
+	h.db.Scopes(scope).
 		Order("created_at DESC").
 		Limit(5).
 		Find(&dashboardData.RecentLinks)
 
-	// 获取过去7天的访问趋势
-	sevenDaysAgo := time.Now().AddDate(0, 0, -7)
-
-	// 获取用户所有链接
-	var urls []model.URL
-	h.db.Select("id").Where("user_id = ?", userID).Find(&urls)
+	// 以子查询筛选统计范围内的链接，链接较多时不必先取出全部ID
+	links := service.LinkSet{Query: h.db.Model(&model.URL{}).Scopes(scope).Select("id")}
 
-	// 如果用户没有链接，返回空的访问趋势
-	if len(urls) == 0 {
-		dashboardData.VisitsTrend = []model.DailyVisit{}
+	// 时间范围内的访问趋势，没有链接时每个时间段均为0
+	dashboardData.VisitsTrend = h.urlService.VisitSeries(c.Request.Context(), links, r)
+	if dashboardData.TotalLinks == 0 {
 		c.JSON(http.StatusOK, dashboardData)
 		return
 	}
 
-	// 提取链接ID
-	var urlIDs []uint
-	for _, url := range urls {
-		urlIDs = append(urlIDs, url.ID)
-	}
-
-	// 按日期聚合访问记录
-	rows, err := h.db.Raw(`
-		SELECT DATE(created_at) as date, COUNT(*) as count 
-		FROM url_visits 
-		WHERE url_id IN (?) AND created_at >= ?
-		GROUP BY DATE(created_at) 
-		ORDER BY date ASC
-	`, urlIDs, sevenDaysAgo).Rows()
-
-	if err != nil {
-		logrus.Errorf("获取访问趋势失败: %v", err)
-		dashboardData.VisitsTrend = []model.DailyVisit{}
-	} else {
-		defer rows.Close()
-
-		for rows.Next() {
-			var visit model.DailyVisit
-			if err := rows.Scan(&visit.Date, &visit.Count); err != nil {
-				logrus.Errorf("解析访问记录失败: %v", err)
-				continue
-			}
-			dashboardData.VisitsTrend = append(dashboardData.VisitsTrend, visit)
-		}
-	}
+	// 时间范围内访问最多的国家或地区
+	dashboardData.TopCountries = h.urlService.VisitBreakdown(c.Request.Context(), links, r, service.DimensionCountry, 5)
 
 	c.JSON(http.StatusOK, dashboardData)
 }
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"shorturl/internal/model"
+	"shorturl/internal/service"
+)
+
+const (
+	liveHeartbeatInterval = time.Second * 15
+	// liveStreamMaxDuration 事件流的最长持续时间，到期后客户端重新连接并重新认证
+	liveStreamMaxDuration = time.Minute * 30
+)
+
+// LiveHandler 实时访问推送处理器
+type LiveHandler struct {
+	clickStream      service.ClickStream
+	urlService       service.URLService
+	workspaceService service.WorkspaceService
+}
+
+// NewLiveHandler 创建实时访问推送处理器
+func NewLiveHandler(clickStream service.ClickStream, urlService service.URLService, workspaceService service.WorkspaceService) *LiveHandler {
+	return &LiveHandler{
+		clickStream:      clickStream,
+		urlService:       urlService,
+		workspaceService: workspaceService,
+	}
+}
+
+// StreamURLClicks 以Server-Sent Events推送单个链接的实时访问
+func (h *LiveHandler) StreamURLClicks(c *gin.Context) {
+	shortCode := c.Param("code")
+	if _, ok := authorizeURL(c, h.urlService, h.workspaceService, shortCode, urlAccessRead); !ok {
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	h.stream(c, user.ID, service.ClickFilter{ShortCode: shortCode})
+}
+
+// StreamClicks 推送当前空间内所有链接的实时访问，个人空间为用户自己的链接
+func (h *LiveHandler) StreamClicks(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+	filter := service.ClickFilter{UserID: user.ID}
+	if member := activeWorkspace(c); member != nil {
+		filter.WorkspaceID = member.WorkspaceID
+	}
+	h.stream(c, user.ID, filter)
+}
+
+// stream 订阅访问事件并持续写出，直到客户端断开、服务关闭或达到最长持续时间
+func (h *LiveHandler) stream(c *gin.Context, userID uint, filter service.ClickFilter) {
+	sub, err := h.clickStream.Subscribe(userID, filter)
+	if err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	// 服务器的WriteTimeout对长连接不适用，取消本连接的写超时
+	rc := http.NewResponseController(c.Writer)
+	rc.SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁止Nginx缓冲
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", int(liveHeartbeatInterval/time.Millisecond))
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(liveHeartbeatInterval)
+	defer heartbeat.Stop()
+	deadline := time.NewTimer(liveStreamMaxDuration)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "event: click\ndata: %s\n\n", data)
+		}
+		c.Writer.Flush()
+	}
+}
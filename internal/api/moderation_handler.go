@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"shorturl/config"
+	"shorturl/internal/model"
+	"shorturl/internal/service"
+)
+
+const (
+	defaultTakedownTitle   = "链接已被停用"
+	defaultTakedownMessage = "该短链接已被管理员停用。"
+)
+
+// ModerationHandler 审核员处置任意链接
+type ModerationHandler struct {
+	urlService service.URLService
+}
+
+// NewModerationHandler 创建链接处置处理器
+func NewModerationHandler(urlService service.URLService) *ModerationHandler {
+	return &ModerationHandler{
+		urlService: urlService,
+	}
+}
+
+// SearchLinks 搜索所有用户的链接，q 为短码或原始URL关键字，disabled=true 只返回已停用的链接
+func (h *ModerationHandler) SearchLinks(c *gin.Context) {
+	filter := service.URLFilter{
+		Query:        c.Query("q"),
+		DisabledOnly: c.Query("disabled") == "true",
+	}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	urls, total, err := h.urlService.SearchURLs(c.Request.Context(), filter)
+	if err != nil {
+		logrus.Errorf("搜索短链接失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索短链接失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": urls,
+	})
+}
+
+// DisableLink 停用链接，原因会记录在审计日志中并可选择展示给访问者
+func (h *ModerationHandler) DisableLink(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required,max=512"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写停用原因"})
+		return
+	}
+
+	shortCode := c.Param("code")
+	setAuditChange(c, "url", shortCode, gin.H{"disabled": false}, gin.H{"disabled": true, "reason": req.Reason})
+
+	user := c.MustGet("user").(*model.User)
+	if err := h.urlService.DisableURL(c.Request.Context(), shortCode, req.Reason, user.ID); err != nil {
+		logrus.Warnf("停用短链接失败: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "短链接已停用"})
+}
+
+// EnableLink 恢复被停用的链接
+func (h *ModerationHandler) EnableLink(c *gin.Context) {
+	shortCode := c.Param("code")
+	setAuditChange(c, "url", shortCode, gin.H{"disabled": true}, gin.H{"disabled": false})
+
+	if err := h.urlService.EnableURL(c.Request.Context(), shortCode); err != nil {
+		logrus.Warnf("恢复短链接失败: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "短链接已恢复"})
+}
+
+// RenderLinkUnavailable 渲染短链接无法跳转时的页面，已停用的链接展示配置的停用说明
+func RenderLinkUnavailable(c *gin.Context, cfg config.ModerationConfig, err error) {
+	var disabled *service.URLDisabledError
+	if !errors.As(err, &disabled) {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"title": "链接不存在或已过期",
+			"error": "您访问的短链接不存在或已过期",
+		})
+		return
+	}
+
+	status := cfg.TakedownStatus
+	if status == 0 {
+		status = http.StatusUnavailableForLegalReasons
+	}
+	title := cfg.TakedownTitle
+	if title == "" {
+		title = defaultTakedownTitle
+	}
+	message := cfg.TakedownMessage
+	if message == "" {
+		message = defaultTakedownMessage
+	}
+	data := gin.H{
+		"title":   title,
+		"message": message,
+		"contact": cfg.Contact,
+	}
+	if cfg.ShowReason {
+		data["reason"] = disabled.Reason
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.HTML(status, "takedown.html", data)
+}
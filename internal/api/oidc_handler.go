@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"shorturl/internal/service"
+)
+
+const oidcStateCookie = "oidc_state"
+
+// OIDCHandler 单点登录处理器
+type OIDCHandler struct {
+	oidcService service.OIDCService
+	authService service.AuthService
+}
+
+// NewOIDCHandler 创建单点登录处理器
+func NewOIDCHandler(oidcService service.OIDCService, authService service.AuthService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+		authService: authService,
+	}
+}
+
+// Login 跳转到身份提供方进行认证
+// 查询参数 mode=api 时回调返回JSON令牌，否则写入Cookie并跳转到 redirect 指定的页面
+func (h *OIDCHandler) Login(c *gin.Context) {
+	if !h.oidcService.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	mode := c.DefaultQuery("mode", "web")
+	if mode != "api" {
+		mode = "web"
+	}
+
+	authURL, state, err := h.oidcService.AuthCodeURL(c.Request.Context(), safeReturnPath(c.Query("redirect")), mode)
+	if err != nil {
+		logrus.Errorf("生成单点登录地址失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "身份提供方不可用"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 600, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 处理身份提供方的回调并签发本地令牌
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if !h.oidcService.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		logrus.Warnf("身份提供方返回错误: %s %s", errCode, c.Query("error_description"))
+		h.fail(c, http.StatusUnauthorized, "单点登录被拒绝")
+		return
+	}
+
+	stateToken, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "登录请求已过期，请重试")
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+
+	result, err := h.oidcService.HandleCallback(c.Request.Context(), c.Query("code"), c.Query("state"), stateToken)
+	if err != nil {
+		logrus.Warnf("单点登录失败: %v", err)
+		h.fail(c, http.StatusUnauthorized, "单点登录失败")
+		return
+	}
+
+	login, err := h.authService.IssueTokens(c.Request.Context(), result.User, clientInfo(c))
+	if errors.Is(err, service.ErrAccountDisabled) {
+		h.fail(c, http.StatusForbidden, "账户已被禁用，请联系管理员")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("签发令牌失败: %v", err)
+		h.fail(c, http.StatusInternalServerError, "登录失败")
+		return
+	}
+
+	// 本地启用了两步验证时，与密码登录一样需要再输入验证码
+	if login.Tokens == nil {
+		if result.Mode == "api" {
+			c.JSON(http.StatusOK, gin.H{
+				"message":             "请输入两步验证码",
+				"two_factor_required": true,
+				"challenge_token":     login.ChallengeToken,
+			})
+			return
+		}
+		// 挑战令牌放在URL片段中，浏览器不会把片段发送给服务器或写入 Referer，不会出现在访问日志中
+		c.Redirect(http.StatusFound, "/admin#challenge_token="+url.QueryEscape(login.ChallengeToken))
+		return
+	}
+	tokens := login.Tokens
+
+	if result.Mode == "api" {
+		c.JSON(http.StatusOK, gin.H{
+			"message":                   "登录成功",
+			"token":                     tokens.AccessToken,
+			"refresh_token":             tokens.RefreshToken,
+			"expires_at":                tokens.ExpiresAt,
+			"two_factor_setup_required": login.TwoFactorSetupRequired,
+		})
+		return
+	}
+
+	// 与密码登录一致，Web界面从auth_token Cookie中读取令牌
+	maxAge := int(time.Until(tokens.ExpiresAt).Seconds())
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie("auth_token", tokens.AccessToken, maxAge, "/", "", c.Request.TLS != nil, false)
+	if login.TwoFactorSetupRequired {
+		c.Redirect(http.StatusFound, "/dashboard#security")
+		return
+	}
+	c.Redirect(http.StatusFound, result.ReturnTo)
+}
+
+// fail 以错误页面或JSON形式返回单点登录失败信息
+func (h *OIDCHandler) fail(c *gin.Context, status int, message string) {
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	c.HTML(status, "error.html", gin.H{
+		"title": "登录失败",
+		"error": message,
+	})
+}
+
+// safeReturnPath 只允许跳转到本站路径，防止开放重定向
+func safeReturnPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/dashboard"
+	}
+	return path
+}
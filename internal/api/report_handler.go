@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"shorturl/internal/model"
+	"shorturl/internal/service"
+)
+
+// ReportHandler 违规举报处理器
+type ReportHandler struct {
+	reportService service.ReportService
+}
+
+// NewReportHandler 创建违规举报处理器
+func NewReportHandler(reportService service.ReportService) *ReportHandler {
+	return &ReportHandler{
+		reportService: reportService,
+	}
+}
+
+// SubmitReport 访问者举报违规链接，无需登录
+func (h *ReportHandler) SubmitReport(c *gin.Context) {
+	var req struct {
+		ShortCode   string `json:"short_code" binding:"required,max=10"`
+		Category    string `json:"category" binding:"required"`
+		Description string `json:"description" binding:"max=1000"`
+		Email       string `json:"email" binding:"omitempty,email,max=128"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	report := &model.AbuseReport{
+		ShortCode:     req.ShortCode,
+		Category:      req.Category,
+		Description:   req.Description,
+		ReporterEmail: req.Email,
+		ReporterIP:    c.ClientIP(),
+	}
+	setAuditTarget(c, "url", req.ShortCode)
+
+	if err := h.reportService.SubmitReport(c.Request.Context(), report); err != nil {
+		if errors.Is(err, service.ErrReportRateLimited) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		logrus.Warnf("提交举报失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "举报已提交，感谢您的反馈"})
+}
+
+// ListReports 分页查询举报，status 为 pending、actioned 或 dismissed
+func (h *ReportHandler) ListReports(c *gin.Context) {
+	filter := service.ReportFilter{
+		Status:    c.Query("status"),
+		ShortCode: c.Query("code"),
+	}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	reports, total, err := h.reportService.ListReports(c.Request.Context(), filter)
+	if err != nil {
+		logrus.Errorf("查询举报失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询举报失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"items": reports,
+	})
+}
+
+// SummarizeReports 按链接汇总举报数量，pending=false 时包含已处理完的链接
+func (h *ReportHandler) SummarizeReports(c *gin.Context) {
+	summaries, err := h.reportService.SummarizeReports(c.Request.Context(), c.DefaultQuery("pending", "true") == "true")
+	if err != nil {
+		logrus.Errorf("汇总举报失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "汇总举报失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summaries)
+}
+
+// ResolveReport 处理举报，action 为 dismiss、disable 或 delete
+func (h *ReportHandler) ResolveReport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的举报ID"})
+		return
+	}
+
+	var req struct {
+		Action string `json:"action" binding:"required"`
+		Note   string `json:"note" binding:"max=512"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	setAuditChange(c, "abuse_report", c.Param("id"), nil, gin.H{"action": req.Action, "note": req.Note})
+
+	user := c.MustGet("user").(*model.User)
+	resolved, err := h.reportService.ResolveReport(c.Request.Context(), uint(id), req.Action, req.Note, user.ID)
+	if err != nil {
+		logrus.Warnf("处理举报失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "举报已处理",
+		"resolved": resolved,
+	})
+}
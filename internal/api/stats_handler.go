@@ -1,8 +1,9 @@
 package api
 
 import (
-	"encoding/csv"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,74 +12,87 @@ import (
 	"shorturl/internal/service"
 )
 
+// 未指定开始时间时统计的天数
+const (
+	defaultStatsDays     = 30
+	defaultDashboardDays = 7
+)
+
+// exportWriteTimeout 导出统计数据的写超时，访问明细较多时远超服务器默认的 WriteTimeout
+const exportWriteTimeout = time.Minute * 10
+
 // StatsHandler 处理统计数据API
 type StatsHandler struct {
-	urlService service.URLService
+	urlService       service.URLService
+	workspaceService service.WorkspaceService
 }
 
 // NewStatsHandler 创建统计数据处理器
-func NewStatsHandler(urlService service.URLService) *StatsHandler {
+func NewStatsHandler(urlService service.URLService, workspaceService service.WorkspaceService) *StatsHandler {
 	return &StatsHandler{
-		urlService: urlService,
+		urlService:       urlService,
+		workspaceService: workspaceService,
 	}
 }
 
-// ExportStats 导出统计数据为CSV
+// ExportStats 导出统计数据，format 为 csv(默认)、json 或 xlsx，visits=true 时包含时间范围内的访问明细
+// 时间范围参数与统计接口相同；CSV 默认带 UTF-8 BOM 以便 Excel 正确识别中文，bom=false 时不带
 func (h *StatsHandler) ExportStats(c *gin.Context) {
 	shortCode := c.Param("code")
 
-	//user, exists := c.Get("user")
-	_, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+	if _, ok := authorizeURL(c, h.urlService, h.workspaceService, shortCode, urlAccessRead); !ok {
 		return
 	}
 
-	// 获取统计数据
-	stats, err := h.urlService.GetURLStats(c.Request.Context(), shortCode)
-	if err != nil {
-		logrus.Errorf("获取短链接统计失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取短链接统计失败"})
+	r, ok := parseStatsRange(c, defaultStatsDays)
+	if !ok {
 		return
 	}
 
-	// 设置响应头，使浏览器下载文件
-	fileName := "stats_" + shortCode + "_" + time.Now().Format("20060102") + ".csv"
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Disposition", "attachment; filename="+fileName)
-	c.Header("Content-Type", "text/csv")
-
-	// 创建CSV写入器
-	writer := csv.NewWriter(c.Writer)
-
-	// 写入每日访问数据
-	writer.Write([]string{"日期", "访问量"})
-	for _, day := range stats.DailyVisits {
-		writer.Write([]string{day.Date, string(rune(day.Count))})
+	format := strings.ToLower(c.DefaultQuery("format", service.ExportCSV))
+	contentType := service.ExportContentType(format)
+	if contentType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导出格式应为 csv、json 或 xlsx"})
+		return
 	}
-
-	// 空行分隔
-	writer.Write([]string{})
-
-	// 写入顶部引荐来源
-	writer.Write([]string{"引荐来源", "访问量"})
-	for _, ref := range stats.TopReferers {
-		writer.Write([]string{ref.URL, string(rune(ref.Count))})
+	opts := service.ExportOptions{Format: format, BOM: true}
+	for _, p := range []struct {
+		name string
+		dst  *bool
+	}{{"visits", &opts.IncludeVisits}, {"bom", &opts.BOM}} {
+		if v := c.Query(p.name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的参数: " + p.name})
+				return
+			}
+			*p.dst = b
+		}
 	}
 
-	// 空行分隔
-	writer.Write([]string{})
+	// 设置响应头，使浏览器下载文件；数据边查询边写出，开始写出后无法再返回错误状态
+	fileName := "stats_" + shortCode + "_" + time.Now().Format("20060102") + "." + format
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
 
-	// 写入顶部用户代理
-	writer.Write([]string{"浏览器/设备", "访问量"})
-	for _, ua := range stats.TopUserAgents {
-		writer.Write([]string{ua.Name, string(rune(ua.Count))})
+	// 服务器的 WriteTimeout 会截断耗时较长的导出，客户端只能收到不完整的文件，改为单独的写超时
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+		logrus.Warnf("设置导出的写超时失败: %v", err)
 	}
 
-	// 刷新缓冲区
-	writer.Flush()
+	if err := h.urlService.ExportStats(c.Request.Context(), shortCode, r, opts, c.Writer); err != nil {
+		logrus.Errorf("导出统计数据失败: %v", err)
+	}
+}
 
-	if err := writer.Error(); err != nil {
-		logrus.Errorf("导出CSV失败: %v", err)
+// parseStatsRange 解析 from、to、interval、tz 查询参数
+func parseStatsRange(c *gin.Context, defaultDays int) (service.StatsRange, bool) {
+	r, err := service.ParseStatsRange(c.Query("from"), c.Query("to"), c.Query("interval"), c.Query("tz"), defaultDays)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return r, false
 	}
+	return r, true
 }
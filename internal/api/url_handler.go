@@ -2,7 +2,10 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,13 +17,17 @@ import (
 
 // URLHandler 处理短链接相关请求
 type URLHandler struct {
-	urlService service.URLService
+	urlService       service.URLService
+	workspaceService service.WorkspaceService
+	campaignService  service.CampaignService
 }
 
 // NewURLHandler 创建URL处理器
-func NewURLHandler(urlService service.URLService) *URLHandler {
+func NewURLHandler(urlService service.URLService, workspaceService service.WorkspaceService, campaignService service.CampaignService) *URLHandler {
 	return &URLHandler{
-		urlService: urlService,
+		urlService:       urlService,
+		workspaceService: workspaceService,
+		campaignService:  campaignService,
 	}
 }
 
@@ -28,7 +35,16 @@ func NewURLHandler(urlService service.URLService) *URLHandler {
 func (h *URLHandler) CreateURL(c *gin.Context) {
 	var req struct {
 		OriginalURL string `json:"original_url" binding:"required,url"`
-		ExpiresIn   string `json:"expires_in"` // 如: "24h", "7d", "1m"
+		ExpiresIn   string `json:"expires_in"`  // 如: "24h", "7d", "1m"
+		Alias       string `json:"alias"`       // 自定义短码，需要套餐开放 custom_alias 功能
+		CampaignID  uint   `json:"campaign_id"` // 归入的营销活动，须与链接属于同一空间
+		NoTracking  bool   `json:"no_tracking"` // 不记录访问明细，只累计访问次数
+		// UTM参数追加到原始URL，覆盖其中已有的同名参数；指定活动时 utm_campaign 默认为活动名称
+		UTMSource   string `json:"utm_source" binding:"max=255"`
+		UTMMedium   string `json:"utm_medium" binding:"max=255"`
+		UTMCampaign string `json:"utm_campaign" binding:"max=255"`
+		UTMTerm     string `json:"utm_term" binding:"max=255"`
+		UTMContent  string `json:"utm_content" binding:"max=255"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -53,14 +69,65 @@ func (h *URLHandler) CreateURL(c *gin.Context) {
 		userID = user.(*model.User).ID
 	}
 
+	// 在当前团队空间中创建时需要编辑及以上角色
+	var workspaceID uint
+	if member := activeWorkspace(c); member != nil {
+		if !model.WorkspaceRoleAtLeast(member.Role, model.WorkspaceRoleEditor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权在该团队空间创建短链接"})
+			return
+		}
+		workspaceID = member.WorkspaceID
+	}
+
+	utm := service.NormalizeUTM(model.UTMParams{
+		Source:   req.UTMSource,
+		Medium:   req.UTMMedium,
+		Campaign: req.UTMCampaign,
+		Term:     req.UTMTerm,
+		Content:  req.UTMContent,
+	})
+	if req.CampaignID != 0 {
+		campaign, err := h.campaignService.GetCampaign(c.Request.Context(), req.CampaignID)
+		if err != nil || !campaignInScope(campaign, userID, workspaceID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "营销活动不存在"})
+			return
+		}
+		if utm.Campaign == "" {
+			utm.Campaign = campaign.Name
+		}
+	}
+	originalURL, err := service.AppendUTM(req.OriginalURL, utm)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 创建短链接
-	url, err := h.urlService.CreateShortURL(c.Request.Context(), req.OriginalURL, userID, expiration)
+	url, err := h.urlService.CreateShortURL(c.Request.Context(), originalURL, strings.TrimSpace(req.Alias), userID, workspaceID, expiration, req.CampaignID, utm, req.NoTracking)
 	if err != nil {
+		var quotaErr *service.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": quotaErr.Error(), "code": "quota_exceeded", "limit": quotaErr.Limit})
+			return
+		}
+		var aliasErr *service.AliasError
+		if errors.As(err, &aliasErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": aliasErr.Error()})
+			return
+		}
 		logrus.Errorf("创建短链接失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建短链接失败"})
 		return
 	}
 
+	setAuditChange(c, "url", url.ShortCode, nil, gin.H{
+		"original_url": url.OriginalURL,
+		"workspace_id": url.WorkspaceID,
+		"campaign_id":  url.CampaignID,
+		"no_tracking":  url.NoTracking,
+		"expires_at":   url.ExpiresAt,
+	})
+
 	baseURL := c.GetString("baseURL")
 	if baseURL == "" {
 		baseURL = "http://" + c.Request.Host
@@ -71,9 +138,26 @@ func (h *URLHandler) CreateURL(c *gin.Context) {
 		"original_url": url.OriginalURL,
 		"short_url":    baseURL + "/" + url.ShortCode,
 		"expires_at":   url.ExpiresAt,
+		"workspace_id": url.WorkspaceID,
+		"campaign_id":  url.CampaignID,
+		"no_tracking":  url.NoTracking,
 	})
 }
 
+// GetQuotaUsage 获取当前用户的套餐限额和用量
+func (h *URLHandler) GetQuotaUsage(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+
+	usage, err := h.urlService.GetQuotaUsage(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("获取套餐用量失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取套餐用量失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
 // RedirectURL 重定向到原始URL (优化版本)
 func (h *URLHandler) RedirectURL(c *gin.Context) {
 	shortCode := c.Param("code")
@@ -93,18 +177,13 @@ func (h *URLHandler) RedirectURL(c *gin.Context) {
 		return
 	}
 
-	// 异步记录访问统计
+	// 异步记录访问统计，请求信息在返回前提取，gin.Context 在请求结束后会被复用
+	visit := service.NewVisitInfo(c.Request, c.ClientIP())
 	go func() {
 		bgCtx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
 
-		if err := h.urlService.TrackVisit(
-			bgCtx,
-			shortCode,
-			c.ClientIP(),
-			c.Request.UserAgent(),
-			c.Request.Referer(),
-		); err != nil {
+		if err := h.urlService.TrackVisit(bgCtx, shortCode, visit); err != nil {
 			logrus.Debugf("记录访问失败: %v", err) // 降低日志级别
 		}
 	}()
@@ -113,7 +192,7 @@ func (h *URLHandler) RedirectURL(c *gin.Context) {
 	c.Redirect(http.StatusFound, originalURL)
 }
 
-// GetURLs 获取用户创建的短链接列表
+// GetURLs 获取当前团队空间或用户个人的短链接列表
 func (h *URLHandler) GetURLs(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
@@ -121,7 +200,13 @@ func (h *URLHandler) GetURLs(c *gin.Context) {
 		return
 	}
 
-	urls, err := h.urlService.GetURLsByUser(c.Request.Context(), user.(*model.User).ID)
+	var urls []*model.URL
+	var err error
+	if member := activeWorkspace(c); member != nil {
+		urls, err = h.urlService.GetURLsByWorkspace(c.Request.Context(), member.WorkspaceID)
+	} else {
+		urls, err = h.urlService.GetURLsByUser(c.Request.Context(), user.(*model.User).ID)
+	}
 	if err != nil {
 		logrus.Errorf("获取用户短链接失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户短链接失败"})
@@ -134,13 +219,17 @@ func (h *URLHandler) GetURLs(c *gin.Context) {
 // DeleteURL 删除短链接
 func (h *URLHandler) DeleteURL(c *gin.Context) {
 	shortCode := c.Param("code")
-	user, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+	url, ok := authorizeURL(c, h.urlService, h.workspaceService, shortCode, urlAccessDelete)
+	if !ok {
 		return
 	}
+	setAuditChange(c, "url", shortCode, gin.H{
+		"original_url": url.OriginalURL,
+		"user_id":      url.UserID,
+		"workspace_id": url.WorkspaceID,
+	}, nil)
 
-	err := h.urlService.DeleteURL(c.Request.Context(), shortCode, user.(*model.User).ID)
+	err := h.urlService.DeleteURL(c.Request.Context(), shortCode)
 	if err != nil {
 		logrus.Errorf("删除短链接失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除短链接失败"})
@@ -150,11 +239,19 @@ func (h *URLHandler) DeleteURL(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "短链接已删除"})
 }
 
-// GetURLStats 获取短链接统计信息
+// GetURLStats 获取短链接统计信息，支持 from、to、interval、tz 查询参数
 func (h *URLHandler) GetURLStats(c *gin.Context) {
 	shortCode := c.Param("code")
+	if _, ok := authorizeURL(c, h.urlService, h.workspaceService, shortCode, urlAccessRead); !ok {
+		return
+	}
 
-	stats, err := h.urlService.GetURLStats(c.Request.Context(), shortCode)
+	r, ok := parseStatsRange(c, defaultStatsDays)
+	if !ok {
+		return
+	}
+
+	stats, err := h.urlService.GetURLStats(c.Request.Context(), shortCode, r)
 	if err != nil {
 		logrus.Errorf("获取短链接统计失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取短链接统计失败"})
@@ -164,9 +261,152 @@ func (h *URLHandler) GetURLStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// TransferURL 将短链接转移到其他团队空间，workspace_id为0时转回创建者的个人链接
+func (h *URLHandler) TransferURL(c *gin.Context) {
+	var req struct {
+		WorkspaceID *uint `json:"workspace_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定目标团队空间"})
+		return
+	}
+
+	shortCode := c.Param("code")
+	url, ok := authorizeURL(c, h.urlService, h.workspaceService, shortCode, urlAccessManage)
+	if !ok {
+		return
+	}
+
+	// 团队空间的链接只有创建者本人或空间管理员可以转出，其他编辑者不能把链接转到自己的空间
+	user := c.MustGet("user").(*model.User)
+	if url.WorkspaceID != 0 && url.UserID != user.ID {
+		member, err := h.workspaceService.GetMembership(c.Request.Context(), url.WorkspaceID, user.ID)
+		if err != nil || !model.WorkspaceRoleAtLeast(member.Role, model.WorkspaceRoleAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有创建者或空间管理员可以转移该链接"})
+			return
+		}
+	}
+
+	target := *req.WorkspaceID
+	if target == 0 {
+		// 只有创建者本人可以把链接转回个人名下，避免链接落到其他人的个人空间
+		if url.UserID != user.ID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有创建者可以将链接转回个人空间"})
+			return
+		}
+	} else {
+		member, err := h.workspaceService.GetMembership(c.Request.Context(), target, user.ID)
+		if err != nil || !model.WorkspaceRoleAtLeast(member.Role, model.WorkspaceRoleEditor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权将链接转移到该团队空间"})
+			return
+		}
+	}
+
+	setAuditChange(c, "url", shortCode, gin.H{"workspace_id": url.WorkspaceID}, gin.H{"workspace_id": target})
+
+	if err := h.workspaceService.TransferURL(c.Request.Context(), shortCode, target); err != nil {
+		logrus.Errorf("转移短链接失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "转移短链接失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "短链接已转移", "workspace_id": target})
+}
+
+// SetURLTracking 开启或关闭短链接的访问跟踪，关闭后只累计访问次数，不记录访问明细和独立访客
+func (h *URLHandler) SetURLTracking(c *gin.Context) {
+	var req struct {
+		NoTracking *bool `json:"no_tracking" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定是否跟踪访问"})
+		return
+	}
+
+	shortCode := c.Param("code")
+	url, ok := authorizeURL(c, h.urlService, h.workspaceService, shortCode, urlAccessManage)
+	if !ok {
+		return
+	}
+	setAuditChange(c, "url", shortCode, gin.H{"no_tracking": url.NoTracking}, gin.H{"no_tracking": *req.NoTracking})
+
+	if err := h.urlService.SetNoTracking(c.Request.Context(), shortCode, *req.NoTracking); err != nil {
+		logrus.Errorf("更新访问跟踪设置失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新访问跟踪设置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "访问跟踪设置已更新", "no_tracking": *req.NoTracking})
+}
+
+// EraseURLVisits 删除短链接的全部访问数据，包括访问明细、统计、独立访客和访问次数
+func (h *URLHandler) EraseURLVisits(c *gin.Context) {
+	shortCode := c.Param("code")
+	url, ok := authorizeURL(c, h.urlService, h.workspaceService, shortCode, urlAccessManage)
+	if !ok {
+		return
+	}
+
+	erased, err := h.urlService.EraseURLVisits(c.Request.Context(), shortCode)
+	if err != nil {
+		logrus.Errorf("删除访问数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除访问数据失败"})
+		return
+	}
+	setAuditChange(c, "url_visits", shortCode, gin.H{"visits": url.Visits}, gin.H{"erased": erased})
+
+	c.JSON(http.StatusOK, gin.H{"message": "访问数据已删除", "erased": erased})
+}
+
+// EraseVisitsByIP 删除某个IP在当前团队空间或用户个人链接上的访问明细，用于处理访问者的删除请求
+func (h *URLHandler) EraseVisitsByIP(c *gin.Context) {
+	var req struct {
+		IP string `json:"ip" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定IP地址"})
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	var urls []*model.URL
+	var err error
+	scope := "user:" + strconv.FormatUint(uint64(user.ID), 10)
+	if member := activeWorkspace(c); member != nil {
+		if !model.WorkspaceRoleAtLeast(member.Role, model.WorkspaceRoleEditor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权删除该团队空间的访问数据"})
+			return
+		}
+		scope = "workspace:" + strconv.FormatUint(uint64(member.WorkspaceID), 10)
+		urls, err = h.urlService.GetURLsByWorkspace(c.Request.Context(), member.WorkspaceID)
+	} else {
+		urls, err = h.urlService.GetURLsByUser(c.Request.Context(), user.ID)
+	}
+	if err != nil {
+		logrus.Errorf("获取短链接失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除访问明细失败"})
+		return
+	}
+
+	urlIDs := make([]uint, 0, len(urls))
+	for _, url := range urls {
+		urlIDs = append(urlIDs, url.ID)
+	}
+	erased, err := h.urlService.EraseVisitsByIP(c.Request.Context(), strings.TrimSpace(req.IP), urlIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 审计日志不记录IP本身
+	setAuditChange(c, "url_visits", scope, nil, gin.H{"erased": erased})
+
+	c.JSON(http.StatusOK, gin.H{"message": "访问明细已删除", "erased": erased})
+}
+
 // CleanupExpiredURLs 清理过期的短链接
 func (h *URLHandler) CleanupExpiredURLs(c *gin.Context) {
 	message, err := h.urlService.CleanupExpiredURLs(c.Request.Context())
+	setAuditChange(c, "system", "expired_urls", nil, message)
 	if err != nil {
 		logrus.Errorf("清理过期短链接失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
@@ -174,3 +414,47 @@ func (h *URLHandler) CleanupExpiredURLs(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, message)
 }
+
+// urlAccess 操作短链接需要的访问级别
+type urlAccess int
+
+const (
+	urlAccessRead   urlAccess = iota // 查看链接和统计
+	urlAccessDelete                  // 删除链接，审核员可以删除任意链接
+	urlAccessManage                  // 修改跟踪设置、所属活动和删除访问数据，只有链接的所有者可以操作
+)
+
+// authorizeURL 加载短链接并校验当前用户的访问权限
+// 个人链接只有创建者可以访问；团队空间链接所有成员可查看，编辑及以上角色可修改；
+// 拥有全局查看权限的用户可以查看任意链接，拥有审核权限的用户可以删除任意链接，其他修改只有所有者可以进行。
+// 校验失败时已写入响应，调用方直接返回即可
+func authorizeURL(c *gin.Context, urlService service.URLService, workspaceService service.WorkspaceService, shortCode string, access urlAccess) (*model.URL, bool) {
+	user := c.MustGet("user").(*model.User)
+
+	url, err := urlService.GetURL(c.Request.Context(), shortCode)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "短链接不存在"})
+		return nil, false
+	}
+
+	allowed := false
+	switch {
+	case access == urlAccessDelete && user.Can(model.PermLinkModerate):
+		allowed = true
+	case access == urlAccessRead && user.Can(model.PermLinkReadAny):
+		allowed = true
+	case url.WorkspaceID == 0:
+		allowed = url.UserID == user.ID
+	default:
+		if member, err := workspaceService.GetMembership(c.Request.Context(), url.WorkspaceID, user.ID); err == nil {
+			allowed = access == urlAccessRead || model.WorkspaceRoleAtLeast(member.Role, model.WorkspaceRoleEditor)
+		}
+	}
+
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该短链接"})
+		return nil, false
+	}
+
+	return url, true
+}
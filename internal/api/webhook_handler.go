@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"shorturl/internal/model"
+	"shorturl/internal/service"
+)
+
+// WebhookHandler Webhook订阅处理器
+type WebhookHandler struct {
+	webhookService service.WebhookService
+}
+
+// NewWebhookHandler 创建Webhook处理器
+func NewWebhookHandler(webhookService service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// ListWebhooks 获取当前用户的Webhook
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+
+	webhooks, err := h.webhookService.ListWebhooks(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("获取Webhook失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取Webhook失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":   model.WebhookEvents,
+		"webhooks": webhooks,
+	})
+}
+
+// CreateWebhook 创建Webhook，签名密钥只在响应中返回一次
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req struct {
+		URL    string   `json:"url" binding:"required,url,max=2048"`
+		Events []string `json:"events" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	webhook, err := h.webhookService.CreateWebhook(c.Request.Context(), user.ID, req.URL, req.Events)
+	if err != nil {
+		logrus.Warnf("创建Webhook失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	setAuditChange(c, "webhook", strconv.FormatUint(uint64(webhook.ID), 10), nil, gin.H{
+		"url":    webhook.URL,
+		"events": webhook.Events,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": webhook,
+		"secret":  webhook.Secret,
+	})
+}
+
+// UpdateWebhook 修改Webhook地址、订阅事件或启用状态
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		URL    *string  `json:"url" binding:"omitempty,url,max=2048"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+	setAuditChange(c, "webhook", c.Param("id"), nil, req)
+
+	user := c.MustGet("user").(*model.User)
+	webhook, err := h.webhookService.UpdateWebhook(c.Request.Context(), user.ID, id, service.WebhookUpdate{
+		URL:    req.URL,
+		Events: req.Events,
+		Active: req.Active,
+	})
+	if err != nil {
+		logrus.Warnf("更新Webhook失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook 删除Webhook
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	if err := h.webhookService.DeleteWebhook(c.Request.Context(), user.ID, id); err != nil {
+		logrus.Warnf("删除Webhook失败: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook已删除"})
+}
+
+// ListDeliveries 获取Webhook最近的投递记录
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	user := c.MustGet("user").(*model.User)
+	deliveries, err := h.webhookService.ListDeliveries(c.Request.Context(), user.ID, id, limit)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// SendTestEvent 发送测试事件并返回本次投递结果
+func (h *WebhookHandler) SendTestEvent(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	// 控制在服务器写超时之内返回
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Second*3)
+	defer cancel()
+
+	user := c.MustGet("user").(*model.User)
+	delivery, err := h.webhookService.SendTestEvent(ctx, user.ID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+func parseWebhookID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的Webhook ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"shorturl/internal/model"
+	"shorturl/internal/service"
+)
+
+// WorkspaceHandler 处理团队空间相关请求
+type WorkspaceHandler struct {
+	workspaceService service.WorkspaceService
+}
+
+// NewWorkspaceHandler 创建团队空间处理器
+func NewWorkspaceHandler(workspaceService service.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceService: workspaceService,
+	}
+}
+
+// WorkspaceMiddleware 解析当前团队空间，需在认证中间件之后使用
+// 通过请求头 X-Workspace-ID 或查询参数 workspace_id 指定，未指定时为个人空间
+func (h *WorkspaceHandler) WorkspaceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader("X-Workspace-ID")
+		if raw == "" {
+			raw = c.Query("workspace_id")
+		}
+		if raw == "" || raw == "0" {
+			c.Next()
+			return
+		}
+
+		workspaceID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的团队空间ID"})
+			c.Abort()
+			return
+		}
+
+		user := c.MustGet("user").(*model.User)
+		member, err := h.workspaceService.GetMembership(c.Request.Context(), uint(workspaceID), user.ID)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "不是该团队空间的成员"})
+			c.Abort()
+			return
+		}
+
+		c.Set("workspace", member)
+		c.Next()
+	}
+}
+
+// activeWorkspace 返回当前请求所在团队空间的成员记录，个人空间返回nil
+func activeWorkspace(c *gin.Context) *model.WorkspaceMember {
+	if member, exists := c.Get("workspace"); exists {
+		return member.(*model.WorkspaceMember)
+	}
+	return nil
+}
+
+// ListWorkspaces 获取当前用户加入的团队空间
+func (h *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+
+	workspaces, err := h.workspaceService.ListWorkspaces(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("获取团队空间失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取团队空间失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workspaces)
+}
+
+// CreateWorkspace 创建团队空间
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required,max=128"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入团队空间名称"})
+		return
+	}
+
+	user := c.MustGet("user").(*model.User)
+	workspace, err := h.workspaceService.CreateWorkspace(c.Request.Context(), user.ID, req.Name)
+	if err != nil {
+		logrus.Errorf("创建团队空间失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建团队空间失败"})
+		return
+	}
+	setAuditChange(c, "workspace", strconv.FormatUint(uint64(workspace.ID), 10), nil, gin.H{"name": workspace.Name})
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// ListMembers 获取团队空间成员列表
+func (h *WorkspaceHandler) ListMembers(c *gin.Context) {
+	workspaceID, _, ok := h.requireRole(c, model.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := h.workspaceService.ListMembers(c.Request.Context(), workspaceID)
+	if err != nil {
+		logrus.Errorf("获取成员列表失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取成员列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// InviteMember 邀请用户加入团队空间
+func (h *WorkspaceHandler) InviteMember(c *gin.Context) {
+	workspaceID, member, ok := h.requireRole(c, model.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Role     string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入要邀请的用户名"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.WorkspaceRoleEditor
+	}
+
+	setAuditChange(c, "workspace", c.Param("id"), nil, gin.H{"invitee": req.Username, "role": req.Role})
+
+	invite, err := h.workspaceService.InviteMember(c.Request.Context(), workspaceID, member.UserID, req.Username, req.Role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invite)
+}
+
+// UpdateMemberRole 修改成员角色，只有所有者可以授予或收回所有者角色
+func (h *WorkspaceHandler) UpdateMemberRole(c *gin.Context) {
+	workspaceID, member, ok := h.requireRole(c, model.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	targetID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效"})
+		return
+	}
+
+	target, err := h.workspaceService.GetMembership(c.Request.Context(), workspaceID, uint(targetID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "成员不存在"})
+		return
+	}
+	if (req.Role == model.WorkspaceRoleOwner || target.Role == model.WorkspaceRoleOwner) &&
+		member.Role != model.WorkspaceRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有所有者可以变更所有者角色"})
+		return
+	}
+
+	setAuditChange(c, "workspace", c.Param("id"),
+		gin.H{"user_id": target.UserID, "role": target.Role},
+		gin.H{"user_id": target.UserID, "role": req.Role})
+
+	if err := h.workspaceService.UpdateMemberRole(c.Request.Context(), workspaceID, uint(targetID), req.Role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "成员角色已更新"})
+}
+
+// RemoveMember 移除成员，成员也可以主动退出团队空间
+func (h *WorkspaceHandler) RemoveMember(c *gin.Context) {
+	workspaceID, member, ok := h.requireRole(c, model.WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	targetID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	if uint(targetID) != member.UserID {
+		if !model.WorkspaceRoleAtLeast(member.Role, model.WorkspaceRoleAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权移除成员"})
+			return
+		}
+		target, err := h.workspaceService.GetMembership(c.Request.Context(), workspaceID, uint(targetID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "成员不存在"})
+			return
+		}
+		if target.Role == model.WorkspaceRoleOwner && member.Role != model.WorkspaceRoleOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有所有者可以移除所有者"})
+			return
+		}
+	}
+
+	setAuditChange(c, "workspace", c.Param("id"), gin.H{"user_id": targetID}, nil)
+
+	if err := h.workspaceService.RemoveMember(c.Request.Context(), workspaceID, uint(targetID)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
+}
+
+// ListInvites 获取当前用户收到的待处理邀请
+func (h *WorkspaceHandler) ListInvites(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+
+	invites, err := h.workspaceService.ListInvites(c.Request.Context(), user.ID)
+	if err != nil {
+		logrus.Errorf("获取邀请失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// AcceptInvite 接受团队空间邀请
+func (h *WorkspaceHandler) AcceptInvite(c *gin.Context) {
+	h.respondInvite(c, true)
+}
+
+// DeclineInvite 拒绝团队空间邀请
+func (h *WorkspaceHandler) DeclineInvite(c *gin.Context) {
+	h.respondInvite(c, false)
+}
+
+func (h *WorkspaceHandler) respondInvite(c *gin.Context, accept bool) {
+	inviteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邀请ID"})
+		return
+	}
+
+	setAuditTarget(c, "workspace_invite", c.Param("id"))
+
+	user := c.MustGet("user").(*model.User)
+	if err := h.workspaceService.RespondInvite(c.Request.Context(), uint(inviteID), user.ID, accept); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if accept {
+		c.JSON(http.StatusOK, gin.H{"message": "已加入团队空间"})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"message": "已拒绝邀请"})
+	}
+}
+
+// requireRole 解析路径中的团队空间ID并校验当前用户的空间角色
+// 校验失败时已写入响应，调用方直接返回即可
+func (h *WorkspaceHandler) requireRole(c *gin.Context, min string) (uint, *model.WorkspaceMember, bool) {
+	workspaceID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的团队空间ID"})
+		return 0, nil, false
+	}
+
+	user := c.MustGet("user").(*model.User)
+	member, err := h.workspaceService.GetMembership(c.Request.Context(), uint(workspaceID), user.ID)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不是该团队空间的成员"})
+		return 0, nil, false
+	}
+	if !model.WorkspaceRoleAtLeast(member.Role, min) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "团队空间角色权限不足"})
+		return 0, nil, false
+	}
+
+	return uint(workspaceID), member, true
+}
@@ -17,6 +17,11 @@ type RedisClient interface {
 	Get(ctx context.Context, key string) (string, error)
 	Del(ctx context.Context, keys ...string) error
 	Incr(ctx context.Context, key string, value ...int64) (int64, error)
+	Publish(ctx context.Context, channel string, message interface{}) error
+	Subscribe(ctx context.Context, channel string) (<-chan string, error)
+	PFAdd(ctx context.Context, key string, expiration time.Duration, elements ...interface{}) error
+	PFCount(ctx context.Context, keys ...string) (int64, error)
+	PFCountEach(ctx context.Context, keySets [][]string) ([]int64, error)
 	Close() error
 	Enabled() bool
 }
@@ -110,6 +115,95 @@ func (r *redisClient) Incr(ctx context.Context, key string, value ...int64) (int
 	return r.client.Incr(ctx, key).Result()
 }
 
+// Publish 向频道发布消息
+func (r *redisClient) Publish(ctx context.Context, channel string, message interface{}) error {
+	if !r.enabled {
+		return nil
+	}
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe 订阅频道，ctx取消后退订并关闭返回的通道
+// 连接断开时go-redis会自动重连，期间的消息会丢失
+func (r *redisClient) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	if !r.enabled {
+		return nil, fmt.Errorf("Redis未启用")
+	}
+
+	pubsub := r.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("订阅频道失败: %v", err)
+	}
+
+	messages := make(chan string, 256)
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- msg.Payload:
+				default:
+					// 消费方处理不过来时丢弃，避免阻塞go-redis的接收循环
+				}
+			}
+		}
+	}()
+	return messages, nil
+}
+
+// PFAdd 向HyperLogLog添加元素，expiration大于0时同时刷新过期时间
+func (r *redisClient) PFAdd(ctx context.Context, key string, expiration time.Duration, elements ...interface{}) error {
+	if !r.enabled {
+		return fmt.Errorf("Redis未启用")
+	}
+
+	pipe := r.client.Pipeline()
+	pipe.PFAdd(ctx, key, elements...)
+	if expiration > 0 {
+		pipe.Expire(ctx, key, expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// PFCount 估算一个或多个HyperLogLog并集的基数，键不存在时视为空集
+func (r *redisClient) PFCount(ctx context.Context, keys ...string) (int64, error) {
+	if !r.enabled {
+		return 0, fmt.Errorf("Redis未启用")
+	}
+	return r.client.PFCount(ctx, keys...).Result()
+}
+
+// PFCountEach 在一个管道中分别估算每组HyperLogLog并集的基数，结果与 keySets 一一对应
+func (r *redisClient) PFCountEach(ctx context.Context, keySets [][]string) ([]int64, error) {
+	if !r.enabled {
+		return nil, fmt.Errorf("Redis未启用")
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keySets))
+	for i, keys := range keySets {
+		cmds[i] = pipe.PFCount(ctx, keys...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	counts := make([]int64, len(cmds))
+	for i, cmd := range cmds {
+		counts[i] = cmd.Val()
+	}
+	return counts, nil
+}
+
 // Close 关闭连接
 func (r *redisClient) Close() error {
 	if !r.enabled {
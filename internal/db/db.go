@@ -84,8 +84,25 @@ func connectPostgreSQL(dbConfig config.DatabaseConfig, config *gorm.Config) (*go
 func migrateDatabase(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&model.URL{},
+		&model.Campaign{},
 		&model.URLVisit{},
+		&model.VisitorSketch{},
+		&model.HourlyVisitRollup{},
+		&model.DailyVisitRollup{},
+		&model.RollupState{},
 		&model.User{},
+		&model.Session{},
+		&model.RecoveryCode{},
+		&model.PasswordResetToken{},
+		&model.PasswordResetRequest{},
+		&model.LoginThrottle{},
+		&model.Workspace{},
+		&model.WorkspaceMember{},
+		&model.WorkspaceInvite{},
+		&model.AuditLog{},
+		&model.AbuseReport{},
+		&model.Webhook{},
+		&model.WebhookDelivery{},
 	); err != nil {
 		return err
 	}
@@ -27,5 +27,10 @@ func RunMigrations(db *gorm.DB) error {
 		logrus.Warnf("创建访问时间索引失败: %v", err)
 	}
 
+	// 为引入角色之前创建的管理员补齐角色，新增列默认值为 editor
+	if err := db.Exec("UPDATE users SET role = 'admin' WHERE is_admin = ? AND role <> 'admin'", true).Error; err != nil {
+		logrus.Warnf("迁移管理员角色失败: %v", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,186 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/sirupsen/logrus"
+
+	"shorturl/config"
+)
+
+const (
+	reloadInterval  = time.Minute // 检查数据库文件是否被替换的间隔
+	defaultLanguage = "zh-CN"
+)
+
+// Location IP地址对应的地理位置，查不到的字段为空
+type Location struct {
+	Country string // ISO 3166-1 两位国家或地区代码
+	Region  string // 一级行政区名称
+	City    string
+}
+
+// Resolver IP地理位置查询接口
+type Resolver interface {
+	Lookup(ip string) Location
+	Close()
+}
+
+// NewResolver 根据配置创建查询器，使用 MaxMind 格式的 .mmdb 数据库(GeoLite2、DB-IP 等)
+// 未配置数据库时返回不做查询的实现；数据库文件暂时无法读取时记录告警并在文件就绪后自动加载
+func NewResolver(cfg *config.Config) Resolver {
+	path := cfg.Analytics.GeoIPDatabase
+	if path == "" {
+		logrus.Info("未配置GeoIP数据库，不记录访问的地理位置")
+		return noopResolver{}
+	}
+
+	languages := []string{"en"}
+	lang := cfg.Analytics.GeoIPLanguage
+	if lang == "" {
+		lang = defaultLanguage
+	}
+	if lang != "en" {
+		languages = append([]string{lang}, languages...)
+	}
+
+	r := &mmdbResolver{
+		path:      path,
+		languages: languages,
+		stop:      make(chan struct{}),
+	}
+	if err := r.reload(); err != nil {
+		logrus.Warnf("加载GeoIP数据库失败，文件就绪后将自动加载: %v", err)
+	}
+
+	r.wg.Add(1)
+	go r.watch()
+	return r
+}
+
+type noopResolver struct{}
+
+func (noopResolver) Lookup(string) Location { return Location{} }
+func (noopResolver) Close()                 {}
+
+type mmdbResolver struct {
+	path      string
+	languages []string // 名称的语言优先级
+
+	reader  atomic.Pointer[maxminddb.Reader]
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// record 数据库中需要的字段，City 和 Country 两种数据库都适用
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Lookup 查询IP的地理位置，内网地址和无法识别的地址返回空结果
+func (r *mmdbResolver) Lookup(ip string) Location {
+	reader := r.reader.Load()
+	if reader == nil {
+		return Location{}
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.IsPrivate() || addr.IsLoopback() || addr.IsUnspecified() {
+		return Location{}
+	}
+
+	var rec record
+	if err := reader.Lookup(addr, &rec); err != nil {
+		return Location{}
+	}
+
+	loc := Location{Country: rec.Country.ISOCode, City: r.name(rec.City.Names)}
+	if loc.Country == "" {
+		loc.Country = rec.RegisteredCountry.ISOCode
+	}
+	if len(rec.Subdivisions) > 0 {
+		loc.Region = r.name(rec.Subdivisions[0].Names)
+	}
+	return loc
+}
+
+// Close 停止检查数据库文件
+func (r *mmdbResolver) Close() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+func (r *mmdbResolver) name(names map[string]string) string {
+	for _, lang := range r.languages {
+		if n := names[lang]; n != "" {
+			return n
+		}
+	}
+	return ""
+}
+
+// watch 定期检查数据库文件，修改时间或大小变化时重新加载
+func (r *mmdbResolver) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(r.path)
+			if err != nil || (info.ModTime().Equal(r.modTime) && info.Size() == r.size) {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				logrus.Warnf("重新加载GeoIP数据库失败，继续使用原数据库: %v", err)
+			}
+		}
+	}
+}
+
+// reload 读取整个数据库文件到内存后替换当前的数据库
+// 不使用mmap，替换后旧数据库由GC回收，正在进行的查询不受影响
+func (r *mmdbResolver) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		// 记录文件状态，文件未再变化时不重复尝试
+		r.modTime, r.size = info.ModTime(), info.Size()
+		return fmt.Errorf("解析 %s 失败: %v", r.path, err)
+	}
+
+	r.reader.Store(reader)
+	r.modTime, r.size = info.ModTime(), info.Size()
+	logrus.Infof("已加载GeoIP数据库 %s (%s, %s)", r.path, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).Format("2006-01-02"))
+	return nil
+}
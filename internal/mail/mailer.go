@@ -0,0 +1,223 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"shorturl/config"
+)
+
+// Message 邮件内容，正文为纯文本
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewMailer 根据配置创建邮件发送器
+// driver 可选 smtp、file(写入目录，便于本地调试)和 log(只打印日志)，默认为 log
+func NewMailer(cfg *config.Config) (Mailer, error) {
+	mc := cfg.Mail
+	from := mc.From
+	if from == "" {
+		from = "noreply@localhost"
+	}
+
+	switch mc.Driver {
+	case "smtp":
+		if mc.SMTP.Host == "" {
+			return nil, fmt.Errorf("未配置SMTP服务器地址")
+		}
+		port := mc.SMTP.Port
+		if port == 0 {
+			port = 587
+		}
+		sender, err := netmail.ParseAddress(from)
+		if err != nil {
+			return nil, fmt.Errorf("无效的发件人地址: %v", err)
+		}
+		logrus.Infof("邮件通过SMTP发送: %s:%d", mc.SMTP.Host, port)
+		return &smtpMailer{
+			from:     from,
+			sender:   sender.Address,
+			addr:     net.JoinHostPort(mc.SMTP.Host, fmt.Sprint(port)),
+			host:     mc.SMTP.Host,
+			username: mc.SMTP.Username,
+			password: mc.SMTP.Password,
+			implicit: mc.SMTP.TLS,
+		}, nil
+	case "file":
+		dir := mc.FileDir
+		if dir == "" {
+			dir = "./data/mail"
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("创建邮件目录失败: %v", err)
+		}
+		logrus.Infof("邮件写入目录: %s", dir)
+		return &fileMailer{from: from, dir: dir}, nil
+	case "", "log":
+		logrus.Info("邮件只输出到日志，生产环境请配置 mail.driver")
+		return &logMailer{from: from}, nil
+	default:
+		return nil, fmt.Errorf("不支持的邮件驱动: %s", mc.Driver)
+	}
+}
+
+// smtpMailer 通过SMTP服务器发送邮件，非隐式TLS时服务器支持则自动启用STARTTLS
+type smtpMailer struct {
+	from     string // 邮件头中的发件人
+	sender   string // 信封发件人地址
+	addr     string
+	host     string
+	username string
+	password string
+	implicit bool // 使用隐式TLS(通常为465端口)
+}
+
+// Send 发送邮件
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	dialer := &net.Dialer{Timeout: time.Second * 10}
+	var conn net.Conn
+	var err error
+	if m.implicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", m.addr, &tls.Config{ServerName: m.host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接SMTP服务器失败: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP握手失败: %v", err)
+	}
+	defer client.Close()
+
+	if !m.implicit {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+				return fmt.Errorf("STARTTLS失败: %v", err)
+			}
+		}
+	}
+
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("SMTP认证失败: %v", err)
+		}
+	}
+
+	if err := client.Mail(m.sender); err != nil {
+		return fmt.Errorf("设置发件人失败: %v", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("设置收件人失败: %v", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("发送邮件失败: %v", err)
+	}
+	if _, err := w.Write(compose(m.from, msg)); err != nil {
+		return fmt.Errorf("发送邮件失败: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件失败: %v", err)
+	}
+
+	return client.Quit()
+}
+
+// fileMailer 将邮件写入目录，每封邮件一个 .eml 文件
+type fileMailer struct {
+	from string
+	dir  string
+}
+
+// Send 写入邮件文件
+func (m *fileMailer) Send(ctx context.Context, msg *Message) error {
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102_150405.000000"), sanitize(msg.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, compose(m.from, msg), 0o600); err != nil {
+		return fmt.Errorf("写入邮件文件失败: %v", err)
+	}
+	logrus.Infof("邮件已写入: %s", path)
+	return nil
+}
+
+// logMailer 将邮件内容输出到日志
+type logMailer struct {
+	from string
+}
+
+// secretParam 邮件链接中的令牌参数，如找回密码链接的 reset_token
+var secretParam = regexp.MustCompile(`([?&][A-Za-z_]*(?:token|code)=)[^\s&#]+`)
+
+// Send 以Debug级别打印邮件，链接中的令牌替换为 ***，避免日志中出现可用的找回密码链接
+func (m *logMailer) Send(ctx context.Context, msg *Message) error {
+	logrus.Debugf("[邮件] 收件人: %s 主题: %s\n%s", msg.To, msg.Subject, secretParam.ReplaceAllString(msg.Body, "${1}***"))
+	return nil
+}
+
+// compose 生成符合RFC 5322的邮件内容
+func compose(from string, msg *Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + stripCRLF(msg.To) + "\r\n")
+	b.WriteString("Subject: " + encodeHeader(stripCRLF(msg.Subject)) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// encodeHeader 对包含非ASCII字符的邮件头进行编码
+func encodeHeader(s string) string {
+	for _, r := range s {
+		if r > 127 {
+			return mime.BEncoding.Encode("UTF-8", s)
+		}
+	}
+	return s
+}
+
+// stripCRLF 移除换行符，防止邮件头注入
+func stripCRLF(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// sanitize 将收件人地址转换为安全的文件名
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '@' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,18 +13,62 @@ type URL struct {
 	ShortCode   string    `gorm:"uniqueIndex;size:10;not null" json:"short_code"`
 	OriginalURL string    `gorm:"size:2048;not null" json:"original_url"`
 	UserID      uint      `gorm:"index" json:"user_id"`
+	WorkspaceID uint      `gorm:"index;default:0" json:"workspace_id"` // 0 表示创建者的个人链接
 	ExpiresAt   time.Time `json:"expires_at"`
 	Visits      int64     `gorm:"default:0" json:"visits"`
+	// Disabled 被审核员停用的链接不再跳转，访问者看到停用说明页
+	Disabled       bool       `gorm:"default:false;index" json:"disabled"`
+	DisabledReason string     `gorm:"size:512" json:"disabled_reason"`
+	DisabledAt     *time.Time `json:"disabled_at"`
+	DisabledBy     uint       `json:"disabled_by"` // 执行停用的用户ID
+	// NoTracking 只累计访问次数，不记录访问明细和独立访客
+	NoTracking bool `gorm:"default:false" json:"no_tracking"`
+	// CampaignID 所属营销活动，0 表示不属于任何活动
+	CampaignID uint `gorm:"index;default:0" json:"campaign_id"`
+	UTMParams  `gorm:"embedded;embeddedPrefix:utm_"`
+}
+
+// UTMParams 创建链接时填写的UTM参数，已追加到目标地址中，单独保存用于按来源和媒介汇总活动统计
+type UTMParams struct {
+	Source   string `gorm:"size:255" json:"utm_source"`
+	Medium   string `gorm:"size:255" json:"utm_medium"`
+	Campaign string `gorm:"size:255" json:"utm_campaign"`
+	Term     string `gorm:"size:255" json:"utm_term"`
+	Content  string `gorm:"size:255" json:"utm_content"`
+}
+
+// Campaign 营销活动，归组多个短链接并汇总统计
+type Campaign struct {
+	gorm.Model
+	Name        string `gorm:"size:128;not null" json:"name"`
+	Description string `gorm:"size:512" json:"description"`
+	UserID      uint   `gorm:"index" json:"user_id"`                // 创建者
+	WorkspaceID uint   `gorm:"index;default:0" json:"workspace_id"` // 0 表示创建者的个人活动
 }
 
 // URLVisit 表示访问记录
 type URLVisit struct {
-	ID         uint      `gorm:"primarykey" json:"id"`
-	URLID      uint      `gorm:"index;not null" json:"url_id"`
-	IP         string    `gorm:"size:45" json:"ip"`
-	UserAgent  string    `gorm:"size:512" json:"user_agent"`
-	RefererURL string    `gorm:"size:2048" json:"referer_url"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID              uint      `gorm:"primarykey" json:"id"`
+	URLID           uint      `gorm:"index;not null" json:"url_id"`
+	IP              string    `gorm:"size:45" json:"ip"` // 按 privacy.ip_mode 处理后的IP
+	ClientIP        string    `gorm:"-" json:"-"`        // 完整IP，只在写入前用于查询地理位置，不保存
+	UserAgent       string    `gorm:"size:512" json:"user_agent"`
+	RefererURL      string    `gorm:"size:2048" json:"referer_url"`     // 写入时去掉跟踪参数
+	RefererDomain   string    `gorm:"size:255" json:"referer_domain"`   // 来源域名，去掉 www. 和 m. 前缀
+	RefererCategory string    `gorm:"size:16" json:"referer_category"`  // direct、search、social、email 或 referral
+	Weight          float64   `gorm:"not null;default:1" json:"weight"` // 抽样记录时每条记录代表的访问次数
+	Browser         string    `gorm:"size:32" json:"browser"`           // 由User-Agent解析出的维度，写入时填充
+	BrowserVersion  string    `gorm:"size:16" json:"browser_version"`
+	OS              string    `gorm:"size:32" json:"os"`
+	Device          string    `gorm:"size:16;index" json:"device"` // desktop、mobile、tablet、bot 或 unknown
+	Country         string    `gorm:"size:2;index" json:"country"` // 由IP查询的ISO国家代码，未配置GeoIP数据库时为空
+	Region          string    `gorm:"size:64" json:"region"`
+	City            string    `gorm:"size:64" json:"city"`
+	Bot             bool      `gorm:"not null;default:false;index" json:"bot"` // 机器人访问，不计入访问次数和访问分布
+	BotReason       string    `gorm:"size:16" json:"bot_reason"`               // crawler、headless、head 或 prefetch
+	CreatedAt       time.Time `json:"created_at"`
+	// RecordedAt 写入数据库的时间，访问记录在内存中缓冲后才写入，汇总明细时据此判断写入是否可能尚未提交；升级前的明细为空
+	RecordedAt *time.Time `json:"-"`
 }
 
 // User 表示管理员用户
@@ -32,22 +77,267 @@ type User struct {
 	Username    string    `gorm:"uniqueIndex;size:64;not null" json:"username"`
 	Password    string    `gorm:"size:128;not null" json:"-"` // 存储哈希后的密码
 	Email       string    `gorm:"size:128" json:"email"`
-	IsAdmin     bool      `gorm:"default:false" json:"is_admin"`
+	IsAdmin     bool      `gorm:"default:false" json:"is_admin"` // 与 Role == RoleAdmin 保持一致
+	Role        string    `gorm:"size:32;default:editor;not null" json:"role"`
 	LastLoginAt time.Time `json:"last_login_at"`
+	// AuthProvider 账户来源: local 为本地密码账户，oidc 为单点登录自动创建的账户
+	AuthProvider string `gorm:"size:32;default:local" json:"auth_provider"`
+	ExternalID   string `gorm:"index;size:512" json:"-"` // 外部身份标识 (issuer|subject)
+	// TOTPSecret 两步验证密钥(Base32)，启用前为待确认的密钥
+	TOTPSecret   string `gorm:"size:64" json:"-"`
+	TOTPEnabled  bool   `gorm:"default:false" json:"totp_enabled"`
+	TOTPLastStep int64  `gorm:"default:0" json:"-"` // 最近一次使用的时间步，防止验证码重放
+	// TokenVersion 令牌版本，递增后该用户此前签发的所有令牌全部失效
+	TokenVersion int `gorm:"default:0;not null" json:"-"`
+	// MustChangePassword 管理员重置密码后置为true，用户修改密码前只能访问修改密码接口
+	MustChangePassword bool `gorm:"default:false" json:"must_change_password"`
+	// Disabled 被管理员禁用的账户无法登录，已签发的令牌也会立即失效
+	Disabled bool `gorm:"default:false;not null" json:"disabled"`
+	// Plan 用户套餐，为空时使用配置中的默认套餐
+	Plan string `gorm:"size:32" json:"plan"`
+}
+
+// 用户角色
+const (
+	RoleViewer    = "viewer"    // 只能查看统计
+	RoleEditor    = "editor"    // 管理自己的链接
+	RoleModerator = "moderator" // 可以查看和处置任意链接
+	RoleAdmin     = "admin"     // 管理用户和系统设置
+)
+
+// Permission 表示一项操作权限
+type Permission string
+
+// 权限定义
+const (
+	PermLinkRead     Permission = "links:read"     // 查看自己的链接和统计
+	PermLinkWrite    Permission = "links:write"    // 创建和删除自己的链接
+	PermLinkReadAny  Permission = "links:read_any" // 查看任意链接的统计
+	PermLinkModerate Permission = "links:moderate" // 禁用或删除任意链接
+	PermUserManage   Permission = "users:manage"   // 管理用户
+	PermSystemManage Permission = "system:manage"  // 系统维护与数据导出
+	PermAuditRead    Permission = "audit:read"     // 查看和导出审计日志
+)
+
+// RolePermissions 角色到权限的映射
+var RolePermissions = map[string][]Permission{
+	RoleViewer:    {PermLinkRead},
+	RoleEditor:    {PermLinkRead, PermLinkWrite},
+	RoleModerator: {PermLinkRead, PermLinkWrite, PermLinkReadAny, PermLinkModerate},
+	RoleAdmin:     {PermLinkRead, PermLinkWrite, PermLinkReadAny, PermLinkModerate, PermUserManage, PermSystemManage, PermAuditRead},
+}
+
+// ValidRole 判断角色名是否有效
+func ValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// Can 判断用户是否拥有指定权限
+func (u *User) Can(perm Permission) bool {
+	for _, p := range RolePermissions[u.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Session 表示服务端登录会话，用于刷新令牌轮换与吊销
+type Session struct {
+	ID                uint       `gorm:"primarykey" json:"id"`
+	UserID            uint       `gorm:"index;not null" json:"user_id"`
+	RefreshTokenHash  string     `gorm:"uniqueIndex;size:64;not null" json:"-"` // 当前刷新令牌的SHA-256
+	PreviousTokenHash string     `gorm:"index;size:64" json:"-"`                // 上一个刷新令牌，用于检测重放
+	IP                string     `gorm:"size:45" json:"ip"`
+	UserAgent         string     `gorm:"size:512" json:"user_agent"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `gorm:"index" json:"revoked_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// PasswordResetToken 表示找回密码令牌，只保存摘要且只能使用一次
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	IP        string     `gorm:"size:45" json:"ip"` // 发起找回请求的IP
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PasswordResetRequest 记录找回密码请求，用于按IP和邮箱限制频率，邮箱不存在时也会记录
+type PasswordResetRequest struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	EmailHash string    `gorm:"index;size:64;not null" json:"-"` // 邮箱转小写后的摘要，不保存明文
+	IP        string    `gorm:"index;size:45" json:"ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// 登录失败计数的维度
+const (
+	LoginThrottleAccount = "account" // 按用户名计数
+	LoginThrottleIP      = "ip"      // 按客户端IP计数
+)
+
+// LoginThrottle 记录某个用户名或IP的连续登录失败次数及锁定状态
+type LoginThrottle struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	Scope        string     `gorm:"uniqueIndex:idx_login_throttle;size:16;not null" json:"scope"`
+	Identifier   string     `gorm:"uniqueIndex:idx_login_throttle;size:255;not null" json:"identifier"` // 用户名或IP
+	Failures     int        `gorm:"not null;default:0" json:"failures"`
+	Lockouts     int        `gorm:"not null;default:0" json:"lockouts"` // 连续锁定次数，用于计算指数退避
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `gorm:"index" json:"locked_until"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// 团队空间内的成员角色
+const (
+	WorkspaceRoleOwner  = "owner"  // 管理空间和成员
+	WorkspaceRoleAdmin  = "admin"  // 管理成员和所有链接
+	WorkspaceRoleEditor = "editor" // 创建和管理空间内的链接
+	WorkspaceRoleViewer = "viewer" // 只能查看链接和统计
+)
+
+// workspaceRoleLevels 空间角色等级，数值越大权限越高
+var workspaceRoleLevels = map[string]int{
+	WorkspaceRoleViewer: 1,
+	WorkspaceRoleEditor: 2,
+	WorkspaceRoleAdmin:  3,
+	WorkspaceRoleOwner:  4,
+}
+
+// ValidWorkspaceRole 判断空间角色名是否有效
+func ValidWorkspaceRole(role string) bool {
+	_, ok := workspaceRoleLevels[role]
+	return ok
+}
+
+// WorkspaceRoleAtLeast 判断空间角色是否不低于指定角色
+func WorkspaceRoleAtLeast(role, min string) bool {
+	return workspaceRoleLevels[role] >= workspaceRoleLevels[min] && workspaceRoleLevels[min] > 0
+}
+
+// Workspace 表示团队空间，空间内的链接由所有成员共同管理
+type Workspace struct {
+	gorm.Model
+	Name    string `gorm:"size:128;not null" json:"name"`
+	OwnerID uint   `gorm:"index;not null" json:"owner_id"`
+}
+
+// WorkspaceMember 表示团队空间成员
+type WorkspaceMember struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	WorkspaceID uint      `gorm:"uniqueIndex:idx_workspace_member;not null" json:"workspace_id"`
+	UserID      uint      `gorm:"uniqueIndex:idx_workspace_member;index;not null" json:"user_id"`
+	Role        string    `gorm:"size:16;not null" json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WorkspaceInvite 表示待处理的团队空间邀请
+type WorkspaceInvite struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	WorkspaceID uint       `gorm:"index;not null" json:"workspace_id"`
+	InviteeID   uint       `gorm:"index;not null" json:"invitee_id"`
+	InviterID   uint       `gorm:"not null" json:"inviter_id"`
+	Role        string     `gorm:"size:16;not null" json:"role"`
+	Status      string     `gorm:"size:16;default:pending;index" json:"status"` // pending, accepted, declined
+	RespondedAt *time.Time `json:"responded_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// RecoveryCode 表示两步验证的一次性恢复码
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// VisitorSketch 独立访客的HyperLogLog数据，未启用Redis时使用
+type VisitorSketch struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	URLID     uint      `gorm:"uniqueIndex:idx_visitor_sketch;not null" json:"url_id"`
+	Day       string    `gorm:"uniqueIndex:idx_visitor_sketch;size:10;not null" json:"day"` // YYYY-MM-DD，为空表示全部时间
+	Data      []byte    `json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HourlyVisitRollup 每个链接每小时的访问量，由后台任务从访问明细汇总
+type HourlyVisitRollup struct {
+	ID      uint      `gorm:"primarykey" json:"id"`
+	URLID   uint      `gorm:"uniqueIndex:idx_hourly_visit_rollup;not null" json:"url_id"`
+	Hour    time.Time `gorm:"uniqueIndex:idx_hourly_visit_rollup;not null" json:"hour"` // UTC整点
+	Visits  float64   `gorm:"not null;default:0" json:"visits"`                         // 正常访问，按每条明细代表的访问次数累计
+	Bots    float64   `gorm:"not null;default:0" json:"bots"`                           // 机器人访问
+	Records int64     `gorm:"not null;default:0" json:"records"`                        // 汇总的明细条数，少于访问量时为抽样记录
+}
+
+// DailyVisitRollup 每个链接每天按维度分组的访问量，如某天来自 Chrome 的访问
+type DailyVisitRollup struct {
+	ID        uint    `gorm:"primarykey" json:"id"`
+	URLID     uint    `gorm:"uniqueIndex:idx_daily_visit_rollup;not null" json:"url_id"`
+	Day       string  `gorm:"uniqueIndex:idx_daily_visit_rollup;size:10;not null" json:"day"` // UTC日期 YYYY-MM-DD
+	Dimension string  `gorm:"uniqueIndex:idx_daily_visit_rollup;size:16;not null" json:"dimension"`
+	Value     string  `gorm:"uniqueIndex:idx_daily_visit_rollup;size:512;not null" json:"value"`
+	Count     float64 `gorm:"not null;default:0" json:"count"`
+}
+
+// RollupState 访问明细的汇总进度，多个实例通过条件更新避免重复汇总
+type RollupState struct {
+	Name        string    `gorm:"primarykey;size:32" json:"name"`
+	LastVisitID uint      `gorm:"not null;default:0" json:"last_visit_id"` // 已汇总的最后一条明细
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // Stats 是URL统计的聚合视图
 type Stats struct {
-	DailyVisits   []DailyVisit `json:"daily_visits"`
-	TotalVisits   int64        `json:"total_visits"`
-	TopReferers   []Referer    `json:"top_referers"`
-	TopUserAgents []UserAgent  `json:"top_user_agents"`
+	From              time.Time    `json:"from"` // 统计的时间范围 [from, to)
+	To                time.Time    `json:"to"`
+	Interval          string       `json:"interval"` // 时间序列的粒度: hour、day、week 或 month
+	Timezone          string       `json:"timezone"`
+	DailyVisits       []DailyVisit `json:"daily_visits"` // 按 interval 分组的时间序列，没有访问的时间段为0
+	TotalVisits       int64        `json:"total_visits"`
+	UniqueVisitors    int64        `json:"unique_visitors"` // 全部时间的独立访客数，HyperLogLog估算值
+	RangeVisits       int64        `json:"range_visits"`    // 时间范围内的访问量
+	RangeUniques      int64        `json:"range_uniques"`   // 时间范围内的独立访客数，按整天估算
+	TopReferers       []Referer    `json:"top_referers"`
+	RefererDomains    []Breakdown  `json:"referer_domains"`    // 来源域名，如 "t.co"
+	RefererCategories []Breakdown  `json:"referer_categories"` // 来源类型: direct、search、social、email、referral
+	TopUserAgents     []UserAgent  `json:"top_user_agents"`
+	Browsers          []Breakdown  `json:"browsers"`
+	BrowserVersions   []Breakdown  `json:"browser_versions"` // 浏览器及主版本号，如 "Chrome 120"
+	OperatingSystems  []Breakdown  `json:"operating_systems"`
+	Devices           []Breakdown  `json:"devices"`
+	Countries         []Breakdown  `json:"countries"` // 国家或地区代码
+	Regions           []Breakdown  `json:"regions"`   // 国家代码和地区名称，如 "CN 广东"
+	Cities            []Breakdown  `json:"cities"`    // 国家代码和城市名称，如 "CN 深圳"
+	Bots              BotTraffic   `json:"bots"`      // 机器人访问，不计入上面的访问量和分布
+	Sampled           bool         `json:"sampled"`   // 明细为抽样记录，分布统计是按抽样比例还原的估计值
+}
+
+// BotTraffic 机器人访问统计，基于访问明细
+type BotTraffic struct {
+	Visits  int64       `json:"visits"`
+	Reasons []Breakdown `json:"reasons"` // 识别原因: crawler、headless、head、prefetch
+	Agents  []Breakdown `json:"agents"`  // 爬虫名称，如 "Slack"，无头浏览器等为浏览器名称
+}
+
+// Breakdown 按某一维度分组的访问统计
+type Breakdown struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
 }
 
 // DailyVisit 表示每日访问统计
 type DailyVisit struct {
-	Date  string `json:"date"`
-	Count int64  `json:"count"`
+	Date    string `json:"date"` // 时间段的起点，如 "2024-01-02"，小时粒度为 "2024-01-02 15:00"，月粒度为 "2024-01"
+	Count   int64  `json:"count"`
+	Uniques int64  `json:"uniques"` // 时间段内的独立访客数，小时粒度不统计
 }
 
 // Referer 表示来源网站统计
@@ -62,8 +352,123 @@ type UserAgent struct {
 	Count int64  `json:"count"`
 }
 
-
 // Message 表示消息
 type Message struct {
 	Content string `gorm:"size:2048;not null" json:"content"`
 }
+
+// AuditLog 表示一条审计日志，只允许追加，不允许修改或删除
+type AuditLog struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	ActorID    uint      `gorm:"index" json:"actor_id"` // 0 表示未登录的请求
+	ActorName  string    `gorm:"size:64" json:"actor_name"`
+	Action     string    `gorm:"index;size:64;not null" json:"action"`
+	TargetType string    `gorm:"index:idx_audit_target;size:32" json:"target_type"`
+	TargetID   string    `gorm:"index:idx_audit_target;size:128" json:"target_id"`
+	Before     string    `gorm:"type:text" json:"before,omitempty"` // 变更前摘要(JSON)
+	After      string    `gorm:"type:text" json:"after,omitempty"`  // 变更后摘要(JSON)
+	Method     string    `gorm:"size:8" json:"method"`
+	Path       string    `gorm:"size:512" json:"path"`
+	Status     int       `json:"status"`
+	IP         string    `gorm:"size:45" json:"ip"`
+	UserAgent  string    `gorm:"size:512" json:"user_agent"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// BeforeUpdate 禁止修改审计日志
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return errAuditLogImmutable
+}
+
+// BeforeDelete 禁止删除审计日志
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return errAuditLogImmutable
+}
+
+var errAuditLogImmutable = errors.New("审计日志只允许追加")
+
+// AbuseReport 访问者提交的违规链接举报，审核员在举报队列中处理
+type AbuseReport struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	ShortCode     string     `gorm:"index;size:10;not null" json:"short_code"`
+	Category      string     `gorm:"size:16;not null" json:"category"`
+	Description   string     `gorm:"size:1000" json:"description"`
+	ReporterEmail string     `gorm:"size:128" json:"reporter_email"` // 可选，用于回复举报人
+	ReporterIP    string     `gorm:"index;size:45" json:"reporter_ip"`
+	Status        string     `gorm:"index;size:16;default:pending;not null" json:"status"`
+	Resolution    string     `gorm:"size:512" json:"resolution"` // 处理说明
+	ResolvedBy    uint       `json:"resolved_by"`
+	ResolvedAt    *time.Time `json:"resolved_at"`
+	CreatedAt     time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// 举报处理状态
+const (
+	ReportStatusPending   = "pending"   // 待处理
+	ReportStatusActioned  = "actioned"  // 已处置链接
+	ReportStatusDismissed = "dismissed" // 已驳回
+)
+
+// 举报类型
+const (
+	ReportCategoryPhishing = "phishing" // 钓鱼或诈骗
+	ReportCategorySpam     = "spam"     // 垃圾信息
+	ReportCategoryMalware  = "malware"  // 恶意软件
+	ReportCategoryOther    = "other"
+)
+
+// ValidReportCategory 判断举报类型是否有效
+func ValidReportCategory(category string) bool {
+	switch category {
+	case ReportCategoryPhishing, ReportCategorySpam, ReportCategoryMalware, ReportCategoryOther:
+		return true
+	}
+	return false
+}
+
+// Webhook 用户配置的事件订阅，事件发生时向URL投递签名的JSON
+type Webhook struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	URL       string    `gorm:"size:2048;not null" json:"url"`
+	Secret    string    `gorm:"size:128;not null" json:"-"`      // HMAC签名密钥，只在创建时返回
+	Events    string    `gorm:"size:255;not null" json:"events"` // 逗号分隔的事件类型
+	Active    bool      `gorm:"default:true;not null" json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Webhook事件类型
+const (
+	WebhookEventLinkCreated = "link.created"
+	WebhookEventLinkDeleted = "link.deleted"
+	WebhookEventLinkClicked = "link.clicked"
+	WebhookEventTest        = "webhook.test" // 手动发送的测试事件，不需要订阅
+)
+
+// WebhookEvents 可订阅的事件类型
+var WebhookEvents = []string{WebhookEventLinkCreated, WebhookEventLinkDeleted, WebhookEventLinkClicked}
+
+// WebhookDelivery Webhook投递记录，同时作为待发送的发件箱
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	WebhookID      uint       `gorm:"index;not null" json:"webhook_id"`
+	Event          string     `gorm:"size:32;not null" json:"event"`
+	Payload        string     `gorm:"type:text;not null" json:"payload"`
+	Status         string     `gorm:"index:idx_webhook_outbox;size:16;not null" json:"status"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index:idx_webhook_outbox" json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `gorm:"size:512" json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Webhook投递状态
+const (
+	WebhookDeliveryPending = "pending" // 等待投递或重试
+	WebhookDeliverySuccess = "success"
+	WebhookDeliveryFailed  = "failed" // 超过最大重试次数
+)
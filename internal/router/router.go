@@ -2,6 +2,7 @@ package router
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"runtime"
 	"strings"
@@ -10,21 +11,28 @@ import (
 	"golang.org/x/net/http2"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"shorturl/config"
 	"shorturl/internal/api"
 	"shorturl/internal/model"
 	"shorturl/internal/service"
 )
 
 // Setup 配置并返回所有路由
-func Setup(urlService service.URLService, authService service.AuthService, db *gorm.DB) *gin.Engine {
+func Setup(cfg *config.Config, urlService service.URLService, authService service.AuthService, oidcService service.OIDCService, workspaceService service.WorkspaceService, auditService service.AuditService, reportService service.ReportService, campaignService service.CampaignService, webhookService service.WebhookService, clickStream service.ClickStream, db *gorm.DB) *gin.Engine {
 	// 设置Gin为最高性能模式
 	gin.SetMode(gin.ReleaseMode)
 
 	// 创建自定义引擎，禁用默认功能
 	r := gin.New()
 
+	// 只信任配置的反向代理传来的 X-Forwarded-For，否则访问者可以伪造IP绕过按IP的限流
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logrus.Fatalf("server.trusted_proxies 配置无效: %v", err)
+	}
+
 	// 关闭Gin的自动恢复功能，改用自定义的恢复中间件
 	// r.Use(gin.Recovery())
 	r.Use(CustomRecovery())
@@ -44,52 +52,148 @@ func Setup(urlService service.URLService, authService service.AuthService, db *g
 		c.Next()
 	})
 
+	// 记录所有修改类请求的审计日志
+	auditHandler := api.NewAuditHandler(auditService)
+	r.Use(auditHandler.Middleware())
+
 	// 初始化处理器
-	urlHandler := api.NewURLHandler(urlService)
+	urlHandler := api.NewURLHandler(urlService, workspaceService, campaignService)
 	authHandler := api.NewAuthHandler(authService)
-	statsHandler := api.NewStatsHandler(urlService)
-	dashboardHandler := api.NewDashboardHandler(db)
-	adminHandler := api.NewAdminHandler(authService, urlService)
+	statsHandler := api.NewStatsHandler(urlService, workspaceService)
+	dashboardHandler := api.NewDashboardHandler(db, urlService)
+	adminHandler := api.NewAdminHandler(authService, urlService, cfg.Quota)
+	oidcHandler := api.NewOIDCHandler(oidcService, authService)
+	workspaceHandler := api.NewWorkspaceHandler(workspaceService)
+	moderationHandler := api.NewModerationHandler(urlService)
+	reportHandler := api.NewReportHandler(reportService)
+	webhookHandler := api.NewWebhookHandler(webhookService)
+	liveHandler := api.NewLiveHandler(clickStream, urlService, workspaceService)
+	campaignHandler := api.NewCampaignHandler(campaignService, urlService, workspaceService)
 
 	// 加载模板
 	r.LoadHTMLGlob("web/templates/*")
 	r.Static("/static", "web/static")
 
 	// 短链接重定向路由 - 高优先级路由，放在最前面
-	r.GET("/:code", ZeroCopyRedirect(urlService))
+	r.GET("/:code", ZeroCopyRedirect(urlService, cfg.Moderation))
+	r.HEAD("/:code", ZeroCopyRedirect(urlService, cfg.Moderation)) // 链接检查工具使用HEAD请求，记录为机器人访问
 
 	// 公共API
 	public := r.Group("/api")
 	{
 		public.POST("/auth/register", authHandler.Register)
 		public.POST("/auth/login", authHandler.Login)
+		public.POST("/auth/refresh", authHandler.Refresh)
+		public.POST("/auth/password/forgot", authHandler.ForgotPassword)
+		public.POST("/auth/password/reset", authHandler.ResetPassword)
+		public.POST("/auth/2fa/verify", authHandler.VerifyTwoFactor)
+		public.GET("/auth/oidc/login", oidcHandler.Login)
+		public.GET("/auth/oidc/callback", oidcHandler.Callback)
+		public.POST("/reports", reportHandler.SubmitReport)
 	}
 
 	// 需要认证的API
 	authorized := r.Group("/api")
 	authorized.Use(authHandler.AuthMiddleware())
 	{
-		// URL管理API
-		authorized.POST("/urls", urlHandler.CreateURL)
-		authorized.GET("/urls", urlHandler.GetURLs)
-		authorized.DELETE("/urls/:code", urlHandler.DeleteURL)
-		authorized.GET("/urls/:code/stats", urlHandler.GetURLStats)
-		authorized.GET("/urls/:code/export", statsHandler.ExportStats)
-		authorized.POST("/urls/cleanup", urlHandler.CleanupExpiredURLs)
+		// 会话管理API
+		authorized.POST("/auth/logout", authHandler.Logout)
+		authorized.POST("/auth/logout-all", authHandler.LogoutAll)
+		authorized.PUT("/auth/password", authHandler.ChangePassword)
+
+		// 两步验证API
+		authorized.POST("/auth/2fa/setup", authHandler.SetupTwoFactor)
+		authorized.POST("/auth/2fa/enable", authHandler.EnableTwoFactor)
+		authorized.POST("/auth/2fa/disable", authHandler.DisableTwoFactor)
+		authorized.POST("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+
+		// URL管理API，列表、创建和仪表盘按当前团队空间划分范围
+		canRead := authHandler.RequirePermission(model.PermLinkRead)
+		canWrite := authHandler.RequirePermission(model.PermLinkWrite)
+		inWorkspace := workspaceHandler.WorkspaceMiddleware()
+		authorized.POST("/urls", canWrite, inWorkspace, urlHandler.CreateURL)
+		authorized.GET("/urls", canRead, inWorkspace, urlHandler.GetURLs)
+		authorized.DELETE("/urls/:code", canWrite, urlHandler.DeleteURL)
+		authorized.GET("/urls/:code/stats", canRead, urlHandler.GetURLStats)
+		authorized.GET("/urls/:code/export", canRead, statsHandler.ExportStats)
+		authorized.GET("/urls/:code/live", canRead, liveHandler.StreamURLClicks)
+		authorized.POST("/urls/:code/transfer", canWrite, urlHandler.TransferURL)
+		authorized.PUT("/urls/:code/campaign", canWrite, campaignHandler.SetURLCampaign)
+		authorized.PUT("/urls/:code/tracking", canWrite, urlHandler.SetURLTracking)
+		authorized.DELETE("/urls/:code/visits", canWrite, urlHandler.EraseURLVisits)
+		authorized.POST("/visits/erase", canWrite, inWorkspace, urlHandler.EraseVisitsByIP)
+		authorized.POST("/urls/cleanup", authHandler.RequirePermission(model.PermSystemManage), urlHandler.CleanupExpiredURLs)
 
 		// 仪表盘API
-		authorized.GET("/dashboard", dashboardHandler.GetDashboardData)
+		authorized.GET("/dashboard", canRead, inWorkspace, dashboardHandler.GetDashboardData)
+		authorized.GET("/live", canRead, inWorkspace, liveHandler.StreamClicks)
+		authorized.GET("/quota", urlHandler.GetQuotaUsage)
+
+		// 营销活动API，列表和创建按当前团队空间划分范围
+		authorized.GET("/campaigns", canRead, inWorkspace, campaignHandler.ListCampaigns)
+		authorized.POST("/campaigns", canWrite, inWorkspace, campaignHandler.CreateCampaign)
+		authorized.PATCH("/campaigns/:id", canWrite, campaignHandler.UpdateCampaign)
+		authorized.DELETE("/campaigns/:id", canWrite, campaignHandler.DeleteCampaign)
+		authorized.GET("/campaigns/:id/stats", canRead, campaignHandler.GetCampaignStats)
+
+		// 团队空间API
+		authorized.GET("/workspaces", workspaceHandler.ListWorkspaces)
+		authorized.POST("/workspaces", canWrite, workspaceHandler.CreateWorkspace)
+		authorized.GET("/workspaces/:id/members", workspaceHandler.ListMembers)
+		authorized.POST("/workspaces/:id/invites", workspaceHandler.InviteMember)
+		authorized.PUT("/workspaces/:id/members/:userId", workspaceHandler.UpdateMemberRole)
+		authorized.DELETE("/workspaces/:id/members/:userId", workspaceHandler.RemoveMember)
+		authorized.GET("/workspace-invites", workspaceHandler.ListInvites)
+		authorized.POST("/workspace-invites/:id/accept", workspaceHandler.AcceptInvite)
+		authorized.POST("/workspace-invites/:id/decline", workspaceHandler.DeclineInvite)
+
+		// Webhook API
+		authorized.GET("/webhooks", canWrite, webhookHandler.ListWebhooks)
+		authorized.POST("/webhooks", canWrite, webhookHandler.CreateWebhook)
+		authorized.PATCH("/webhooks/:id", canWrite, webhookHandler.UpdateWebhook)
+		authorized.DELETE("/webhooks/:id", canWrite, webhookHandler.DeleteWebhook)
+		authorized.GET("/webhooks/:id/deliveries", canWrite, webhookHandler.ListDeliveries)
+		authorized.POST("/webhooks/:id/test", canWrite, webhookHandler.SendTestEvent)
+	}
+
+	// 链接处置API，审核员和管理员可用
+	moderation := r.Group("/api/moderation")
+	moderation.Use(authHandler.AuthMiddleware(), authHandler.RequirePermission(model.PermLinkModerate))
+	{
+		moderation.GET("/links", moderationHandler.SearchLinks)
+		moderation.POST("/links/:code/disable", moderationHandler.DisableLink)
+		moderation.POST("/links/:code/enable", moderationHandler.EnableLink)
+		moderation.GET("/reports", reportHandler.ListReports)
+		moderation.GET("/reports/summary", reportHandler.SummarizeReports)
+		moderation.POST("/reports/:id/resolve", reportHandler.ResolveReport)
 	}
 
 	// 管理员API
 	admin := r.Group("/api/admin")
 	admin.Use(authHandler.AuthMiddleware(), authHandler.AdminMiddleware())
 	{
-		admin.GET("/stats", adminHandler.GetDashboardStats)
-		admin.GET("/users", adminHandler.GetUsers)
-		admin.GET("/users/:id/links", adminHandler.GetUserLinks)
-		admin.POST("/users/:id/reset-password", adminHandler.ResetUserPassword)
-		admin.GET("/export", adminHandler.ExportSystemData)
+		canManageUsers := authHandler.RequirePermission(model.PermUserManage)
+		canManageSystem := authHandler.RequirePermission(model.PermSystemManage)
+		admin.GET("/stats", canManageSystem, adminHandler.GetDashboardStats)
+		admin.GET("/users", canManageUsers, adminHandler.GetUsers)
+		admin.POST("/users", canManageUsers, adminHandler.CreateUser)
+		admin.PATCH("/users/:id", canManageUsers, adminHandler.UpdateUser)
+		admin.DELETE("/users/:id", canManageUsers, adminHandler.DeleteUser)
+		admin.POST("/users/:id/disable", canManageUsers, adminHandler.DisableUser)
+		admin.POST("/users/:id/enable", canManageUsers, adminHandler.EnableUser)
+		admin.GET("/users/:id/links", canManageUsers, adminHandler.GetUserLinks)
+		admin.POST("/users/:id/reset-password", canManageUsers, adminHandler.ResetUserPassword)
+		admin.PUT("/users/:id/role", canManageUsers, adminHandler.SetUserRole)
+		admin.PUT("/users/:id/plan", canManageUsers, adminHandler.SetUserPlan)
+		admin.GET("/plans", canManageUsers, adminHandler.GetPlans)
+		admin.GET("/lockouts", canManageUsers, adminHandler.ListLoginLockouts)
+		admin.DELETE("/lockouts/:id", canManageUsers, adminHandler.ClearLoginLockout)
+		admin.GET("/export", canManageSystem, adminHandler.ExportSystemData)
+		admin.POST("/visits/erase", canManageSystem, adminHandler.EraseVisitsByIP)
+
+		canReadAudit := authHandler.RequirePermission(model.PermAuditRead)
+		admin.GET("/audit-logs", canReadAudit, auditHandler.ListAuditLogs)
+		admin.GET("/audit-logs/export", canReadAudit, auditHandler.ExportAuditLogs)
 	}
 
 	// Web界面路由
@@ -99,9 +203,19 @@ func Setup(urlService service.URLService, authService service.AuthService, db *g
 		})
 	})
 
+	r.GET("/preview/:code", PreviewPage(urlService, cfg.Moderation))
+
+	r.GET("/report", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "report.html", gin.H{
+			"title": "举报违规链接",
+			"code":  c.Query("code"),
+		})
+	})
+
 	r.GET("/admin", func(c *gin.Context) {
 		c.HTML(http.StatusOK, "login.html", gin.H{
-			"title": "管理员登录",
+			"title":       "管理员登录",
+			"oidcEnabled": oidcService.Enabled(),
 		})
 	})
 
@@ -116,7 +230,7 @@ func Setup(urlService service.URLService, authService service.AuthService, db *g
 }
 
 // ZeroCopyRedirect 使用零拷贝的重定向处理
-func ZeroCopyRedirect(urlService service.URLService) gin.HandlerFunc {
+func ZeroCopyRedirect(urlService service.URLService, moderation config.ModerationConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		shortCode := c.Param("code")
 
@@ -131,15 +245,11 @@ func ZeroCopyRedirect(urlService service.URLService) gin.HandlerFunc {
 				c.Redirect(http.StatusFound, originalURL)
 
 				// 异步记录访问，不影响响应速度
-				go urlService.TrackVisit(
-					context.Background(),
-					shortCode,
-					c.ClientIP(),
-					c.Request.UserAgent(),
-					c.Request.Referer(),
-				)
+				go urlService.TrackVisit(context.Background(), shortCode, service.NewVisitInfo(c.Request, c.ClientIP()))
 				return
 			}
+			api.RenderLinkUnavailable(c, moderation, err)
+			return
 		}
 
 		// 处理普通请求或错误
@@ -150,6 +260,32 @@ func ZeroCopyRedirect(urlService service.URLService) gin.HandlerFunc {
 	}
 }
 
+// PreviewPage 展示短链接的目标地址，访问者确认后再跳转，也可以从这里举报链接
+func PreviewPage(urlService service.URLService, moderation config.ModerationConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shortCode := c.Param("code")
+
+		url, err := urlService.GetURL(c.Request.Context(), shortCode)
+		if err == nil && url.ExpiresAt.Before(time.Now()) {
+			err = fmt.Errorf("短链接已过期")
+		}
+		if err == nil && url.Disabled {
+			err = &service.URLDisabledError{Reason: url.DisabledReason}
+		}
+		if err != nil {
+			api.RenderLinkUnavailable(c, moderation, err)
+			return
+		}
+
+		c.HTML(http.StatusOK, "preview.html", gin.H{
+			"title":       "链接预览",
+			"code":        url.ShortCode,
+			"originalURL": url.OriginalURL,
+			"createdAt":   url.CreatedAt.Format("2006-01-02 15:04"),
+		})
+	}
+}
+
 // CustomRecovery 自定义更高效的恢复中间件
 func CustomRecovery() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+
+	"shorturl/internal/model"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// AuditFilter 审计日志查询条件，零值字段不参与过滤
+type AuditFilter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+	Page       int
+	PageSize   int
+}
+
+// AuditService 审计日志服务接口
+type AuditService interface {
+	Record(ctx context.Context, entry *model.AuditLog) error
+	Query(ctx context.Context, filter AuditFilter) ([]model.AuditLog, int64, error)
+	Export(ctx context.Context, filter AuditFilter, w io.Writer) error
+}
+
+type auditService struct {
+	db *gorm.DB
+}
+
+// NewAuditService 创建审计日志服务
+func NewAuditService(db *gorm.DB) AuditService {
+	return &auditService{db: db}
+}
+
+// Record 追加一条审计日志
+func (s *auditService) Record(ctx context.Context, entry *model.AuditLog) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	if err := s.db.WithContext(ctx).Create(entry).Error; err != nil {
+		return fmt.Errorf("写入审计日志失败: %v", err)
+	}
+	return nil
+}
+
+// Query 按条件分页查询审计日志，按时间倒序
+func (s *auditService) Query(ctx context.Context, filter AuditFilter) ([]model.AuditLog, int64, error) {
+	query := s.filtered(ctx, filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计审计日志失败: %v", err)
+	}
+
+	page, pageSize := filter.Page, filter.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultAuditPageSize
+	}
+	if pageSize > maxAuditPageSize {
+		pageSize = maxAuditPageSize
+	}
+
+	var logs []model.AuditLog
+	if err := query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&logs).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询审计日志失败: %v", err)
+	}
+
+	return logs, total, nil
+}
+
+// Export 以NDJSON格式逐行导出符合条件的审计日志，按时间正序便于增量采集
+func (s *auditService) Export(ctx context.Context, filter AuditFilter, w io.Writer) error {
+	rows, err := s.filtered(ctx, filter).Order("id ASC").Rows()
+	if err != nil {
+		return fmt.Errorf("查询审计日志失败: %v", err)
+	}
+	defer rows.Close()
+
+	encoder := json.NewEncoder(w)
+	for rows.Next() {
+		var entry model.AuditLog
+		if err := s.db.ScanRows(rows, &entry); err != nil {
+			return fmt.Errorf("读取审计日志失败: %v", err)
+		}
+		if err := encoder.Encode(&entry); err != nil {
+			return fmt.Errorf("写入导出数据失败: %v", err)
+		}
+	}
+
+	return rows.Err()
+}
+
+// filtered 构建带过滤条件的查询
+func (s *auditService) filtered(ctx context.Context, filter AuditFilter) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&model.AuditLog{})
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	return query
+}
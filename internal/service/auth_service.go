@@ -2,6 +2,10 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -10,27 +14,81 @@ import (
 	"gorm.io/gorm"
 
 	"shorturl/config"
+	"shorturl/internal/mail"
 	"shorturl/internal/model"
 )
 
+const (
+	defaultRefreshExpires = time.Hour * 24 * 30 // 刷新令牌默认有效期
+	refreshTokenBytes     = 32                  // 刷新令牌随机字节数
+)
+
+// TokenPair 登录或刷新后签发的令牌对
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// LoginResult 密码校验通过后的登录结果
+// 启用了两步验证的账户只返回ChallengeToken，需再调用VerifyTwoFactor换取令牌
+type LoginResult struct {
+	Tokens             *TokenPair
+	ChallengeToken     string
+	MustChangePassword bool // 管理员重置过密码，需先修改密码
+	// TwoFactorSetupRequired 管理员策略要求先启用两步验证，启用前只能访问两步验证设置和退出登录接口
+	TwoFactorSetupRequired bool
+}
+
+// ClientInfo 发起认证请求的客户端信息，记录在会话中
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
 // AuthService 认证服务接口
 type AuthService interface {
 	Register(ctx context.Context, username, password, email string) (*model.User, error)
-	Login(ctx context.Context, username, password string) (string, error)
+	Login(ctx context.Context, username, password string, client ClientInfo) (*LoginResult, error)
+	VerifyTwoFactor(ctx context.Context, challengeToken, code string, client ClientInfo) (*TokenPair, error)
+	SetupTwoFactor(ctx context.Context, userID uint) (*TwoFactorSetup, error)
+	EnableTwoFactor(ctx context.Context, userID uint, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userID uint, password, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error)
+	TwoFactorSetupRequired(user *model.User) bool
+	Refresh(ctx context.Context, refreshToken string, client ClientInfo) (*TokenPair, error)
+	IssueTokens(ctx context.Context, user *model.User, client ClientInfo) (*LoginResult, error)
+	Logout(ctx context.Context, tokenString string) error
+	LogoutAll(ctx context.Context, userID uint) error
 	VerifyToken(ctx context.Context, tokenString string) (*model.User, error)
 	ResetPassword(ctx context.Context, userID uint, newPassword string) error
+	ChangePassword(ctx context.Context, userID uint, currentPassword, newPassword string, client ClientInfo) (*TokenPair, error)
+	RequestPasswordReset(ctx context.Context, email, ip string) error
+	ResetPasswordWithToken(ctx context.Context, token, newPassword string) error
+	ResetPasswordTemporary(ctx context.Context, userID uint) (string, error)
+	RevokeUserSessions(ctx context.Context, userID uint) error
+	SetUserRole(ctx context.Context, userID uint, role string) error
+	SetUserPlan(ctx context.Context, userID uint, plan string) error
+	CreateUser(ctx context.Context, username, password, email, role string) (*model.User, string, error)
+	UpdateUser(ctx context.Context, userID uint, update UserUpdate) (*model.User, error)
+	SetUserDisabled(ctx context.Context, userID uint, disabled bool) error
+	DeleteUser(ctx context.Context, userID, transferTo uint) ([]string, error)
+	ListLoginThrottles(ctx context.Context, lockedOnly bool) ([]model.LoginThrottle, error)
+	ClearLoginThrottle(ctx context.Context, id uint) (*model.LoginThrottle, error)
 }
 
 type authService struct {
 	db     *gorm.DB
 	config *config.Config
+	mailer mail.Mailer
 }
 
 // NewAuthService 创建认证服务
-func NewAuthService(db *gorm.DB, cfg *config.Config) AuthService {
+func NewAuthService(db *gorm.DB, cfg *config.Config, mailer mail.Mailer) AuthService {
 	return &authService{
 		db:     db,
 		config: cfg,
+		mailer: mailer,
 	}
 }
 
@@ -57,6 +115,7 @@ func (s *authService) Register(ctx context.Context, username, password, email st
 		Username:    username,
 		Password:    string(hashedPassword),
 		Email:       email,
+		Role:        model.RoleEditor,
 		LastLoginAt: time.Now(),
 	}
 
@@ -68,38 +127,340 @@ func (s *authService) Register(ctx context.Context, username, password, email st
 }
 
 // Login 用户登录
-func (s *authService) Login(ctx context.Context, username, password string) (string, error) {
+func (s *authService) Login(ctx context.Context, username, password string, client ClientInfo) (*LoginResult, error) {
+	if err := s.checkLoginAllowed(ctx, username, client.IP); err != nil {
+		return nil, err
+	}
+
+	// 用户不存在与密码错误走相同的流程，避免通过响应时间枚举用户名
 	var user model.User
-	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
-		return "", fmt.Errorf("用户不存在")
+	if err := s.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		compareDummyPassword(password)
+		s.recordLoginFailure(ctx, username, client.IP)
+		return nil, fmt.Errorf("用户名或密码错误")
+	}
+	if user.Password == "" {
+		compareDummyPassword(password)
+		s.recordLoginFailure(ctx, username, client.IP)
+		return nil, fmt.Errorf("用户名或密码错误")
 	}
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", fmt.Errorf("密码错误")
+		s.recordLoginFailure(ctx, username, client.IP)
+		return nil, fmt.Errorf("用户名或密码错误")
+	}
+	if user.Disabled {
+		return nil, ErrAccountDisabled
 	}
 
+	// 已启用两步验证时保留失败计数，直到第二步也验证通过
+	if user.TOTPEnabled {
+		challenge, err := s.signChallengeToken(&user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{ChallengeToken: challenge}, nil
+	}
+
+	s.clearAccountFailures(ctx, user.Username)
+
 	// 更新最后登录时间
 	s.db.Model(&user).UpdateColumn("last_login_at", time.Now())
 
+	tokens, err := s.createSession(ctx, &user, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{
+		Tokens:                 tokens,
+		MustChangePassword:     user.MustChangePassword,
+		TwoFactorSetupRequired: s.TwoFactorSetupRequired(&user),
+	}, nil
+}
+
+// Refresh 使用刷新令牌换取新的令牌对，旧刷新令牌随即失效
+func (s *authService) Refresh(ctx context.Context, refreshToken string, client ClientInfo) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+
+	var session model.Session
+	if err := s.db.WithContext(ctx).Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+		// 已轮换过的刷新令牌再次出现，说明令牌可能被盗用，吊销整个会话
+		var reused model.Session
+		if s.db.WithContext(ctx).Where("previous_token_hash = ?", hash).First(&reused).Error == nil {
+			s.revokeSession(ctx, reused.ID)
+			return nil, fmt.Errorf("刷新令牌已被使用，会话已吊销")
+		}
+		return nil, fmt.Errorf("无效的刷新令牌")
+	}
+
+	if session.RevokedAt != nil {
+		return nil, fmt.Errorf("会话已吊销")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, fmt.Errorf("刷新令牌已过期")
+	}
+
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, session.UserID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	newRefreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// 轮换刷新令牌，条件更新保证并发刷新时只有一个请求成功
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND refresh_token_hash = ?", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  hashToken(newRefreshToken),
+			"previous_token_hash": hash,
+			"ip":                  client.IP,
+			"user_agent":          truncateRunes(client.UserAgent, 512),
+			"last_used_at":        now,
+			"expires_at":          now.Add(s.refreshExpires()),
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("轮换刷新令牌失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("无效的刷新令牌")
+	}
+
+	accessToken, expiresAt, err := s.signAccessToken(&user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// IssueTokens 为已通过其他方式认证(如单点登录)的用户签发令牌对
+// 与密码登录相同，已启用两步验证时只返回挑战令牌，需再调用 VerifyTwoFactor
+func (s *authService) IssueTokens(ctx context.Context, user *model.User, client ClientInfo) (*LoginResult, error) {
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	if user.TOTPEnabled {
+		challenge, err := s.signChallengeToken(user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{ChallengeToken: challenge}, nil
+	}
+
+	tokens, err := s.createSession(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Tokens: tokens, TwoFactorSetupRequired: s.TwoFactorSetupRequired(user)}, nil
+}
+
+// Logout 吊销访问令牌所属的会话
+func (s *authService) Logout(ctx context.Context, tokenString string) error {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return err
+	}
+
+	sessionID, ok := claims["sid"].(float64)
+	if !ok {
+		return fmt.Errorf("无效的令牌")
+	}
+
+	return s.revokeSession(ctx, uint(sessionID))
+}
+
+// LogoutAll 注销用户在所有设备上的登录
+func (s *authService) LogoutAll(ctx context.Context, userID uint) error {
+	return s.RevokeUserSessions(ctx, userID)
+}
+
+// RevokeUserSessions 吊销用户的全部会话并使已签发的访问令牌失效
+func (s *authService) RevokeUserSessions(ctx context.Context, userID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, userID)
+	})
+}
+
+// revokeUserSessions 在事务中递增令牌版本并吊销用户的全部会话
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&model.User{}).Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return fmt.Errorf("更新令牌版本失败: %v", err)
+	}
+
+	if err := tx.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("吊销会话失败: %v", err)
+	}
+
+	return nil
+}
+
+// VerifyToken 验证JWT令牌
+func (s *authService) VerifyToken(ctx context.Context, tokenString string) (*model.User, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("无效的令牌")
+	}
+	sessionID, ok := claims["sid"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("无效的令牌")
+	}
+	version, _ := claims["ver"].(float64)
+
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, uint(userID)).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+
+	// 密码重置或注销全部设备后令牌版本递增，旧令牌立即失效
+	if int(version) != user.TokenVersion {
+		return nil, fmt.Errorf("令牌已失效")
+	}
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", uint(sessionID), user.ID).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("检查会话失败: %v", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("会话已失效")
+	}
+
+	return &user, nil
+}
+
+// ResetPassword 重置用户密码，同时清除需修改密码的标记
+func (s *authService) ResetPassword(ctx context.Context, userID uint, newPassword string) error {
+	// 哈希密码
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("密码加密失败: %v", err)
+	}
+
+	// 更新密码和注销所有已登录的会话在同一事务中完成，不会出现密码已改但旧会话仍有效的情况
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password":             string(hashedPassword),
+			"must_change_password": false,
+		}).Error; err != nil {
+			return fmt.Errorf("更新密码失败: %v", err)
+		}
+		return revokeUserSessions(tx, userID)
+	})
+}
+
+// SetUserRole 修改用户角色，不允许移除系统中最后一个管理员
+func (s *authService) SetUserRole(ctx context.Context, userID uint, role string) error {
+	if !model.ValidRole(role) {
+		return fmt.Errorf("无效的角色: %s", role)
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("用户不存在")
+		}
+
+		if user.Role == model.RoleAdmin && role != model.RoleAdmin && !user.Disabled {
+			if err := ensureOtherAdmin(tx, user.ID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"role":     role,
+			"is_admin": role == model.RoleAdmin,
+		}).Error; err != nil {
+			return fmt.Errorf("更新角色失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// createSession 创建服务端会话并签发令牌对
+func (s *authService) createSession(ctx context.Context, user *model.User, client ClientInfo) (*TokenPair, error) {
+	// 所有登录方式最终都在这里签发令牌，统一拦截已禁用的账户
+	if user.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &model.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		IP:               client.IP,
+		UserAgent:        truncateRunes(client.UserAgent, 512),
+		ExpiresAt:        now.Add(s.refreshExpires()),
+		LastUsedAt:       now,
+	}
+	if err := s.db.WithContext(ctx).Create(session).Error; err != nil {
+		return nil, fmt.Errorf("创建会话失败: %v", err)
+	}
+
+	accessToken, expiresAt, err := s.signAccessToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// signAccessToken 签发绑定会话的访问令牌
+func (s *authService) signAccessToken(user *model.User, sessionID uint) (string, time.Time, error) {
+	expiresAt := time.Now().Add(time.Duration(s.config.Auth.Expires) * time.Hour)
+
 	// 生成JWT令牌
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id":  user.ID,
 		"username": user.Username,
 		"is_admin": user.IsAdmin,
-		"exp":      time.Now().Add(time.Duration(s.config.Auth.Expires) * time.Hour).Unix(),
+		"sid":      sessionID,
+		"ver":      user.TokenVersion,
+		"exp":      expiresAt.Unix(),
 	})
 
 	tokenString, err := token.SignedString([]byte(s.config.Auth.SecretKey))
 	if err != nil {
-		return "", fmt.Errorf("生成令牌失败: %v", err)
+		return "", time.Time{}, fmt.Errorf("生成令牌失败: %v", err)
 	}
 
-	return tokenString, nil
+	return tokenString, expiresAt, nil
 }
 
-// VerifyToken 验证JWT令牌
-func (s *authService) VerifyToken(ctx context.Context, tokenString string) (*model.User, error) {
+// parseToken 校验签名与有效期并返回令牌声明
+func (s *authService) parseToken(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("无效的签名方法: %v", token.Header["alg"])
@@ -111,32 +472,48 @@ func (s *authService) VerifyToken(ctx context.Context, tokenString string) (*mod
 		return nil, fmt.Errorf("解析令牌失败: %v", err)
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := uint(claims["user_id"].(float64))
-
-		var user model.User
-		if err := s.db.First(&user, userID).Error; err != nil {
-			return nil, fmt.Errorf("用户不存在")
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("无效的令牌")
+	}
 
-		return &user, nil
+	// 两步验证挑战令牌不能当作访问令牌使用
+	if typ, _ := claims["typ"].(string); typ != "" {
+		return nil, fmt.Errorf("无效的令牌类型")
 	}
 
-	return nil, fmt.Errorf("无效的令牌")
+	return claims, nil
 }
 
-// ResetPassword 重置用户密码
-func (s *authService) ResetPassword(ctx context.Context, userID uint, newPassword string) error {
-	// 哈希密码
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
-	if err != nil {
-		return fmt.Errorf("密码加密失败: %v", err)
+// revokeSession 吊销单个会话
+func (s *authService) revokeSession(ctx context.Context, sessionID uint) error {
+	if err := s.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("吊销会话失败: %v", err)
+	}
+	return nil
+}
+
+// refreshExpires 返回刷新令牌有效期
+func (s *authService) refreshExpires() time.Duration {
+	if s.config.Auth.RefreshExpires > 0 {
+		return time.Duration(s.config.Auth.RefreshExpires) * time.Hour
 	}
+	return defaultRefreshExpires
+}
 
-	// 更新用户密码
-	if err := s.db.Model(&model.User{}).Where("id = ?", userID).Update("password", string(hashedPassword)).Error; err != nil {
-		return fmt.Errorf("更新密码失败: %v", err)
+// generateRefreshToken 生成随机刷新令牌
+func generateRefreshToken() (string, error) {
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成刷新令牌失败: %v", err)
 	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
 
-	return nil
+// hashToken 计算令牌的SHA-256摘要，数据库中只保存摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"shorturl/config"
+	"shorturl/internal/model"
+)
+
+func TestRefreshTokenReuse(t *testing.T) {
+	tests := []struct {
+		name        string
+		replay      func(previous, current string) string // 轮换两次后提交的刷新令牌
+		wantErr     bool
+		wantRevoked bool
+	}{
+		{name: "当前令牌正常轮换", replay: func(previous, current string) string { return current }},
+		{name: "重放已轮换的令牌吊销会话", replay: func(previous, current string) string { return previous }, wantErr: true, wantRevoked: true},
+		{name: "未知令牌不影响会话", replay: func(previous, current string) string { return "unknown" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDB(t, &model.User{}, &model.Session{})
+			cfg := &config.Config{}
+			cfg.Auth.SecretKey = "test-secret"
+			cfg.Auth.Expires = 1
+			s := &authService{db: db, config: cfg}
+
+			user := &model.User{Username: "alice", Password: "x"}
+			if err := db.Create(user).Error; err != nil {
+				t.Fatalf("创建用户失败: %v", err)
+			}
+
+			client := ClientInfo{IP: "127.0.0.1", UserAgent: "test"}
+			issued, err := s.createSession(ctx, user, client)
+			if err != nil {
+				t.Fatalf("创建会话失败: %v", err)
+			}
+			previous, err := s.Refresh(ctx, issued.RefreshToken, client)
+			if err != nil {
+				t.Fatalf("首次刷新失败: %v", err)
+			}
+			current, err := s.Refresh(ctx, previous.RefreshToken, client)
+			if err != nil {
+				t.Fatalf("第二次刷新失败: %v", err)
+			}
+
+			_, err = s.Refresh(ctx, tt.replay(previous.RefreshToken, current.RefreshToken), client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Refresh() error = %v，期望出错 %v", err, tt.wantErr)
+			}
+
+			var session model.Session
+			if err := db.First(&session).Error; err != nil {
+				t.Fatalf("查询会话失败: %v", err)
+			}
+			if revoked := session.RevokedAt != nil; revoked != tt.wantRevoked {
+				t.Fatalf("会话吊销状态 = %v，期望 %v", revoked, tt.wantRevoked)
+			}
+			// 会话吊销后，持有当前令牌的一方同样无法继续刷新
+			if tt.wantRevoked {
+				if _, err := s.Refresh(ctx, current.RefreshToken, client); err == nil {
+					t.Fatalf("会话吊销后当前令牌仍可刷新")
+				}
+			}
+		})
+	}
+}
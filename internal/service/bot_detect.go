@@ -0,0 +1,140 @@
+package service
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// 识别为机器人访问的原因
+const (
+	BotReasonCrawler  = "crawler"  // User-Agent 为已知的爬虫、链接预览或命令行工具
+	BotReasonHeadless = "headless" // 无头浏览器、自动化工具，或缺少浏览器必带请求头的请求
+	BotReasonHead     = "head"     // HEAD 请求，只检查链接是否有效
+	BotReasonPrefetch = "prefetch" // 浏览器预加载或链接预览请求
+)
+
+// VisitInfo 一次访问的请求信息，在处理请求时提取，之后异步记录
+type VisitInfo struct {
+	IP        string
+	UserAgent string
+	Referer   string
+	BotReason string // 为空表示正常访问
+	// DoNotTrack 请求带有 DNT: 1 或 Sec-GPC: 1
+	DoNotTrack bool
+}
+
+// IsBot 是否为机器人访问
+func (v VisitInfo) IsBot() bool {
+	return v.BotReason != ""
+}
+
+// NewVisitInfo 从HTTP请求提取访问信息并识别机器人访问
+func NewVisitInfo(r *http.Request, ip string) VisitInfo {
+	return VisitInfo{
+		IP:         ip,
+		UserAgent:  r.UserAgent(),
+		Referer:    r.Referer(),
+		BotReason:  DetectBot(r),
+		DoNotTrack: doNotTrack(r),
+	}
+}
+
+// knownCrawlers 常见的爬虫和聊天软件、社交网络的链接预览，按顺序匹配，名称用于统计
+// 只收录专用于抓取的标识，应用内置浏览器的User-Agent也可能带有应用名称
+var knownCrawlers = []struct {
+	name  string
+	token string // User-Agent 中的标识，不区分大小写
+}{
+	{"Googlebot", "googlebot"},
+	{"Bingbot", "bingbot"},
+	{"Baiduspider", "baiduspider"},
+	{"YandexBot", "yandexbot"},
+	{"Bytespider", "bytespider"},
+	{"DuckDuckBot", "duckduckbot"},
+	{"Applebot", "applebot"},
+	{"Facebook", "facebookexternalhit"},
+	{"Facebook", "facebookcatalog"},
+	{"Twitter", "twitterbot"},
+	{"LinkedIn", "linkedinbot"},
+	{"Slack", "slackbot"},
+	{"Slack", "slack-imgproxy"},
+	{"Discord", "discordbot"},
+	{"Telegram", "telegrambot"},
+	{"WhatsApp", "whatsapp"},
+	{"Skype", "skypeuripreview"},
+	{"Microsoft Teams", "microsoftpreview"},
+	{"Reddit", "redditbot"},
+	{"Pinterest", "pinterestbot"},
+	{"VK", "vkshare"},
+	{"Mastodon", "mastodon"},
+	{"Iframely", "iframely"},
+	{"Embedly", "embedly"},
+	{"DingTalk", "dingtalkbot"},
+	{"curl", "curl/"},
+	{"Wget", "wget/"},
+	{"Python", "python-requests"},
+	{"Python", "python-urllib"},
+	{"Go", "go-http-client"},
+	{"OkHttp", "okhttp"},
+	{"Java", "java/"},
+	{"Node.js", "node-fetch"},
+	{"Node.js", "axios/"},
+}
+
+var (
+	// genericCrawlerPattern 不在列表中的其他爬虫
+	genericCrawlerPattern = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|preview|scraper|fetcher|libwww|httpclient`)
+	headlessPattern       = regexp.MustCompile(`(?i)headlesschrome|phantomjs|puppeteer|playwright|selenium|webdriver|lighthouse|cypress|jsdom`)
+)
+
+// crawlerName 返回已知爬虫的名称，不是爬虫时返回空字符串，无法归类的爬虫返回 "Other"
+func crawlerName(ua string) string {
+	lower := strings.ToLower(ua)
+	for _, c := range knownCrawlers {
+		if strings.Contains(lower, c.token) {
+			return c.name
+		}
+	}
+	if genericCrawlerPattern.MatchString(ua) {
+		return "Other"
+	}
+	return ""
+}
+
+// isBotUserAgent 只根据User-Agent判断是否为机器人
+func isBotUserAgent(ua string) bool {
+	return crawlerName(ua) != "" || headlessPattern.MatchString(ua)
+}
+
+// DetectBot 根据User-Agent、请求方法和请求头识别机器人访问，返回原因，正常访问返回空字符串
+// 浏览器打开链接时一定会发送 Accept-Language，自称浏览器却没有该请求头的通常是自动化工具
+func DetectBot(r *http.Request) string {
+	ua := strings.TrimSpace(r.UserAgent())
+	switch {
+	case r.Method == http.MethodHead:
+		return BotReasonHead
+	case isPrefetch(r.Header):
+		return BotReasonPrefetch
+	case ua == "":
+		return BotReasonHeadless
+	case crawlerName(ua) != "":
+		return BotReasonCrawler
+	case headlessPattern.MatchString(ua) || strings.Contains(r.Header.Get("Sec-CH-UA"), "HeadlessChrome"):
+		return BotReasonHeadless
+	case strings.HasPrefix(ua, "Mozilla/") && r.Header.Get("Accept-Language") == "":
+		return BotReasonHeadless
+	}
+	return ""
+}
+
+// isPrefetch 判断是否为浏览器的预加载或预览请求
+func isPrefetch(h http.Header) bool {
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		v := strings.ToLower(h.Get(name))
+		if strings.Contains(v, "prefetch") || strings.Contains(v, "preview") || strings.Contains(v, "prerender") {
+			return true
+		}
+	}
+	return false
+}
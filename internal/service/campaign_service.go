@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"shorturl/internal/model"
+)
+
+const (
+	maxCampaignNameLength = 128
+	maxDestinationLength  = 2048 // 与 URL.OriginalURL 的长度一致
+)
+
+// CampaignSummary 营销活动及其链接数和总访问量
+type CampaignSummary struct {
+	model.Campaign
+	LinksCount  int64 `json:"links_count"`
+	TotalVisits int64 `json:"total_visits"`
+}
+
+// CampaignUpdate 修改营销活动，字段为nil表示不修改
+type CampaignUpdate struct {
+	Name        *string
+	Description *string
+}
+
+// CampaignLinkStats 活动中单个链接的访问量
+type CampaignLinkStats struct {
+	ShortCode   string `json:"short_code"`
+	OriginalURL string `json:"original_url"`
+	model.UTMParams
+	TotalVisits int64 `json:"total_visits"`
+	RangeVisits int64 `json:"range_visits"` // 时间范围内的访问量，不含机器人访问
+}
+
+// CampaignStats 营销活动的汇总统计，各项口径与单个链接的统计相同
+type CampaignStats struct {
+	Campaign model.Campaign `json:"campaign"`
+	model.Stats
+	Links []CampaignLinkStats `json:"links"` // 按时间范围内的访问量排序
+	// 按链接的UTM参数汇总时间范围内的访问量，未填写的参数不计入
+	Sources  []model.Breakdown `json:"utm_sources"`
+	Mediums  []model.Breakdown `json:"utm_mediums"`
+	Contents []model.Breakdown `json:"utm_contents"`
+}
+
+// CampaignService 营销活动服务接口
+type CampaignService interface {
+	CreateCampaign(ctx context.Context, userID, workspaceID uint, name, description string) (*model.Campaign, error)
+	ListCampaigns(ctx context.Context, userID, workspaceID uint) ([]CampaignSummary, error)
+	GetCampaign(ctx context.Context, id uint) (*model.Campaign, error)
+	UpdateCampaign(ctx context.Context, id uint, update CampaignUpdate) (*model.Campaign, error)
+	DeleteCampaign(ctx context.Context, id uint) error
+	AssignURL(ctx context.Context, shortCode string, campaignID uint) error
+	GetCampaignStats(ctx context.Context, id uint, r StatsRange) (*CampaignStats, error)
+}
+
+type campaignService struct {
+	db         *gorm.DB
+	urlService URLService
+}
+
+// NewCampaignService 创建营销活动服务
+func NewCampaignService(db *gorm.DB, urlService URLService) CampaignService {
+	return &campaignService{
+		db:         db,
+		urlService: urlService,
+	}
+}
+
+// campaignScope 团队空间的活动，或用户个人的活动
+func campaignScope(userID, workspaceID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if workspaceID != 0 {
+			return db.Where("workspace_id = ?", workspaceID)
+		}
+		return db.Where("user_id = ? AND workspace_id = 0", userID)
+	}
+}
+
+// CreateCampaign 创建营销活动，workspaceID为0时创建个人活动
+func (s *campaignService) CreateCampaign(ctx context.Context, userID, workspaceID uint, name, description string) (*model.Campaign, error) {
+	campaign := &model.Campaign{
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		Description: strings.TrimSpace(description),
+	}
+	if err := s.setName(ctx, campaign, name); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Create(campaign).Error; err != nil {
+		return nil, fmt.Errorf("创建营销活动失败: %v", err)
+	}
+	return campaign, nil
+}
+
+// setName 校验活动名称，同一空间内不允许重名
+func (s *campaignService) setName(ctx context.Context, campaign *model.Campaign, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("活动名称不能为空")
+	}
+	if utf8.RuneCountInString(name) > maxCampaignNameLength {
+		return fmt.Errorf("活动名称不能超过%d个字符", maxCampaignNameLength)
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Campaign{}).
+		Scopes(campaignScope(campaign.UserID, campaign.WorkspaceID)).
+		Where("name = ? AND id <> ?", name, campaign.ID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("查询营销活动失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("已存在同名的营销活动: %s", name)
+	}
+	campaign.Name = name
+	return nil
+}
+
+// ListCampaigns 获取团队空间或用户个人的营销活动，最近创建的在前
+func (s *campaignService) ListCampaigns(ctx context.Context, userID, workspaceID uint) ([]CampaignSummary, error) {
+	var campaigns []model.Campaign
+	if err := s.db.WithContext(ctx).Scopes(campaignScope(userID, workspaceID)).
+		Order("id DESC").Find(&campaigns).Error; err != nil {
+		return nil, fmt.Errorf("获取营销活动失败: %v", err)
+	}
+
+	summaries := make([]CampaignSummary, 0, len(campaigns))
+	if len(campaigns) == 0 {
+		return summaries, nil
+	}
+	ids := make([]uint, len(campaigns))
+	for i, campaign := range campaigns {
+		ids[i] = campaign.ID
+	}
+
+	var counts []struct {
+		CampaignID  uint
+		LinksCount  int64
+		TotalVisits int64
+	}
+	if err := s.db.WithContext(ctx).Model(&model.URL{}).
+		Select("campaign_id, COUNT(*) as links_count, COALESCE(SUM(visits), 0) as total_visits").
+		Where("campaign_id IN ?", ids).
+		Group("campaign_id").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("统计活动链接失败: %v", err)
+	}
+	byID := make(map[uint]int)
+	for i, count := range counts {
+		byID[count.CampaignID] = i
+	}
+
+	for _, campaign := range campaigns {
+		summary := CampaignSummary{Campaign: campaign}
+		if i, ok := byID[campaign.ID]; ok {
+			summary.LinksCount = counts[i].LinksCount
+			summary.TotalVisits = counts[i].TotalVisits
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// GetCampaign 获取营销活动
+func (s *campaignService) GetCampaign(ctx context.Context, id uint) (*model.Campaign, error) {
+	var campaign model.Campaign
+	if err := s.db.WithContext(ctx).First(&campaign, id).Error; err != nil {
+		return nil, fmt.Errorf("营销活动不存在")
+	}
+	return &campaign, nil
+}
+
+// UpdateCampaign 修改营销活动的名称或说明，已创建链接中的 utm_campaign 不随之修改
+func (s *campaignService) UpdateCampaign(ctx context.Context, id uint, update CampaignUpdate) (*model.Campaign, error) {
+	campaign, err := s.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.Name != nil {
+		if err := s.setName(ctx, campaign, *update.Name); err != nil {
+			return nil, err
+		}
+		updates["name"] = campaign.Name
+	}
+	if update.Description != nil {
+		campaign.Description = strings.TrimSpace(*update.Description)
+		updates["description"] = campaign.Description
+	}
+	if len(updates) == 0 {
+		return campaign, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(campaign).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("更新营销活动失败: %v", err)
+	}
+	return campaign, nil
+}
+
+// DeleteCampaign 删除营销活动，其中的链接保留，只是不再属于任何活动
+func (s *campaignService) DeleteCampaign(ctx context.Context, id uint) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.URL{}).Where("campaign_id = ?", id).Update("campaign_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Campaign{}, id).Error
+	})
+	if err != nil {
+		return fmt.Errorf("删除营销活动失败: %v", err)
+	}
+	return nil
+}
+
+// AssignURL 将链接归入营销活动，campaignID为0时移出活动
+// 目标地址中已有的UTM参数不会修改
+func (s *campaignService) AssignURL(ctx context.Context, shortCode string, campaignID uint) error {
+	result := s.db.WithContext(ctx).Model(&model.URL{}).
+		Where("short_code = ?", shortCode).
+		Update("campaign_id", campaignID)
+	if result.Error != nil {
+		return fmt.Errorf("修改链接所属活动失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("短链接不存在")
+	}
+	return nil
+}
+
+// GetCampaignStats 汇总活动中全部链接的访问统计，并按链接和UTM参数分组
+func (s *campaignService) GetCampaignStats(ctx context.Context, id uint, r StatsRange) (*CampaignStats, error) {
+	campaign, err := s.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []*model.URL
+	if err := s.db.WithContext(ctx).Where("campaign_id = ?", id).Find(&urls).Error; err != nil {
+		return nil, fmt.Errorf("获取活动链接失败: %v", err)
+	}
+
+	stats := &CampaignStats{
+		Campaign: *campaign,
+		Stats:    *s.urlService.GetLinksStats(ctx, urls, r),
+		Links:    make([]CampaignLinkStats, 0, len(urls)),
+	}
+
+	urlIDs := make([]uint, len(urls))
+	for i, url := range urls {
+		urlIDs[i] = url.ID
+	}
+	counts := s.urlService.VisitCounts(ctx, urlIDs, r)
+
+	sources, mediums, contents := map[string]int64{}, map[string]int64{}, map[string]int64{}
+	for _, url := range urls {
+		visits := counts[url.ID]
+		stats.Links = append(stats.Links, CampaignLinkStats{
+			ShortCode:   url.ShortCode,
+			OriginalURL: url.OriginalURL,
+			UTMParams:   url.UTMParams,
+			TotalVisits: url.Visits,
+			RangeVisits: visits,
+		})
+		sources[url.Source] += visits
+		mediums[url.Medium] += visits
+		contents[url.Content] += visits
+	}
+	sort.SliceStable(stats.Links, func(i, j int) bool {
+		if stats.Links[i].RangeVisits != stats.Links[j].RangeVisits {
+			return stats.Links[i].RangeVisits > stats.Links[j].RangeVisits
+		}
+		return stats.Links[i].TotalVisits > stats.Links[j].TotalVisits
+	})
+	stats.Sources = sortedBreakdown(sources)
+	stats.Mediums = sortedBreakdown(mediums)
+	stats.Contents = sortedBreakdown(contents)
+
+	return stats, nil
+}
+
+// sortedBreakdown 按访问量从高到低排列，忽略空值
+func sortedBreakdown(counts map[string]int64) []model.Breakdown {
+	result := make([]model.Breakdown, 0, len(counts))
+	for name, count := range counts {
+		if name != "" {
+			result = append(result, model.Breakdown{Name: name, Count: count})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// utmFields UTM参数在查询字符串中的名称，按追加的顺序排列
+var utmFields = []struct {
+	name  string
+	value func(p *model.UTMParams) *string
+}{
+	{"utm_source", func(p *model.UTMParams) *string { return &p.Source }},
+	{"utm_medium", func(p *model.UTMParams) *string { return &p.Medium }},
+	{"utm_campaign", func(p *model.UTMParams) *string { return &p.Campaign }},
+	{"utm_term", func(p *model.UTMParams) *string { return &p.Term }},
+	{"utm_content", func(p *model.UTMParams) *string { return &p.Content }},
+}
+
+// NormalizeUTM 去掉UTM参数首尾的空白
+func NormalizeUTM(utm model.UTMParams) model.UTMParams {
+	for _, field := range utmFields {
+		value := field.value(&utm)
+		*value = strings.TrimSpace(*value)
+	}
+	return utm
+}
+
+// AppendUTM 将UTM参数追加到目标地址的查询字符串，覆盖地址中已有的同名参数
+// 其余参数保持原有顺序和编码，锚点保留在末尾；没有填写任何UTM参数时原样返回
+func AppendUTM(destination string, utm model.UTMParams) (string, error) {
+	var params []string
+	set := make(map[string]bool)
+	for _, field := range utmFields {
+		if value := *field.value(&utm); value != "" {
+			params = append(params, field.name+"="+url.QueryEscape(value))
+			set[field.name] = true
+		}
+	}
+	if len(params) == 0 {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", fmt.Errorf("目标地址格式不正确")
+	}
+	var kept []string
+	if u.RawQuery != "" {
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			name, _, _ := strings.Cut(param, "=")
+			if param == "" || set[strings.ToLower(name)] {
+				continue
+			}
+			kept = append(kept, param)
+		}
+	}
+	u.RawQuery = strings.Join(append(kept, params...), "&")
+	u.ForceQuery = false
+
+	result := u.String()
+	if len(result) > maxDestinationLength {
+		return "", fmt.Errorf("添加UTM参数后目标地址超过%d个字符", maxDestinationLength)
+	}
+	return result, nil
+}
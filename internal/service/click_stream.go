@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	redisClient "shorturl/internal/cache"
+	"shorturl/internal/model"
+)
+
+const (
+	clickStreamChannel     = "shorturl:clicks"
+	clickListenersKey      = "shorturl:clicks:listeners"
+	clickListenersTTL      = time.Second * 15
+	clickListenersInterval = time.Second * 5
+	clickEventBuffer       = 1000
+	clickSubscriberBuffer  = 64
+	clickOwnerCacheTTL     = time.Minute
+	maxClickStreamsPerUser = 5
+)
+
+// ClickEvent 实时访问事件
+type ClickEvent struct {
+	ShortCode      string    `json:"short_code"`
+	Browser        string    `json:"browser"`
+	BrowserVersion string    `json:"browser_version"`
+	OS             string    `json:"os"`
+	Device         string    `json:"device"`
+	Referer        string    `json:"referer"`
+	RefererHost    string    `json:"referer_host"`
+	Time           time.Time `json:"time"`
+
+	userAgent string // 原始User-Agent，发布前解析
+}
+
+// ClickFilter 订阅范围，指定ShortCode时只接收该链接的事件；
+// 否则接收WorkspaceID对应团队空间的链接，WorkspaceID为0时接收UserID的个人链接
+type ClickFilter struct {
+	ShortCode   string
+	UserID      uint
+	WorkspaceID uint
+}
+
+// ClickSubscription 实时访问订阅，Events 在取消订阅或服务关闭后被关闭
+type ClickSubscription struct {
+	Events <-chan ClickEvent
+
+	id     uint64
+	stream *clickStream
+}
+
+// Close 取消订阅
+func (sub *ClickSubscription) Close() {
+	sub.stream.unsubscribe(sub.id)
+}
+
+// ClickStream 实时访问事件总线，启用Redis时通过发布订阅在多个实例间分发
+type ClickStream interface {
+	Publish(shortCode, userAgent, referer string)
+	Subscribe(subscriberID uint, filter ClickFilter) (*ClickSubscription, error)
+	Close()
+}
+
+type clickSubscriber struct {
+	ch         chan ClickEvent
+	filter     ClickFilter
+	subscriber uint
+}
+
+type clickOwner struct {
+	userID      uint
+	workspaceID uint
+}
+
+type clickStream struct {
+	db     *gorm.DB
+	redis  redisClient.RedisClient
+	events chan ClickEvent
+	owners *cache.Cache // 短码 -> clickOwner，按用户或团队空间订阅时使用
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// fanout 为true时事件经Redis分发，本实例也从Redis接收自己发布的事件
+	fanout bool
+	// listening 集群中是否有实例存在订阅者，没有时不解析也不发布事件
+	listening atomic.Bool
+
+	mutex  sync.Mutex
+	nextID uint64
+	subs   map[uint64]*clickSubscriber
+	closed bool
+}
+
+// NewClickStream 创建实时访问事件总线，redis 为nil或未启用时只在本实例内分发
+func NewClickStream(db *gorm.DB, redis redisClient.RedisClient) ClickStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &clickStream{
+		db:     db,
+		redis:  redis,
+		events: make(chan ClickEvent, clickEventBuffer),
+		owners: cache.New(clickOwnerCacheTTL, clickOwnerCacheTTL*2),
+		cancel: cancel,
+		subs:   make(map[uint64]*clickSubscriber),
+	}
+
+	if redis != nil && redis.Enabled() {
+		messages, err := redis.Subscribe(ctx, clickStreamChannel)
+		if err != nil {
+			logrus.Warnf("订阅实时访问频道失败，只推送本实例的访问: %v", err)
+		} else {
+			s.fanout = true
+			s.wg.Add(2)
+			go s.receive(messages)
+			go s.announceListeners(ctx)
+		}
+	}
+
+	s.wg.Add(1)
+	go s.process(ctx)
+	return s
+}
+
+// Publish 发布一次访问，不阻塞调用方；没有订阅者时直接丢弃
+func (s *clickStream) Publish(shortCode, userAgent, referer string) {
+	if !s.listening.Load() {
+		return
+	}
+	select {
+	case s.events <- ClickEvent{ShortCode: shortCode, Referer: referer, Time: time.Now(), userAgent: userAgent}:
+	default:
+		// 缓冲区已满时丢弃，实时推送不保证送达
+	}
+}
+
+// Subscribe 订阅实时访问事件，每个用户同时打开的订阅数有上限
+func (s *clickStream) Subscribe(subscriberID uint, filter ClickFilter) (*ClickSubscription, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("服务正在关闭")
+	}
+	count := 0
+	for _, sub := range s.subs {
+		if sub.subscriber == subscriberID {
+			count++
+		}
+	}
+	if count >= maxClickStreamsPerUser {
+		return nil, fmt.Errorf("同时打开的实时访问连接不能超过%d个", maxClickStreamsPerUser)
+	}
+
+	s.nextID++
+	sub := &clickSubscriber{
+		ch:         make(chan ClickEvent, clickSubscriberBuffer),
+		filter:     filter,
+		subscriber: subscriberID,
+	}
+	s.subs[s.nextID] = sub
+	s.updateListening()
+
+	return &ClickSubscription{Events: sub.ch, id: s.nextID, stream: s}, nil
+}
+
+// Close 停止分发并关闭所有订阅，使打开的事件流结束
+func (s *clickStream) Close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	for id, sub := range s.subs {
+		close(sub.ch)
+		delete(s.subs, id)
+	}
+	s.mutex.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *clickStream) unsubscribe(id uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if sub, ok := s.subs[id]; ok {
+		close(sub.ch)
+		delete(s.subs, id)
+		s.updateListening()
+	}
+}
+
+// updateListening 根据本实例的订阅者更新发布开关，调用方需持有锁
+// 启用Redis时开关由 announceListeners 根据整个集群的订阅情况维护
+func (s *clickStream) updateListening() {
+	if len(s.subs) > 0 {
+		s.listening.Store(true)
+	} else if !s.fanout {
+		s.listening.Store(false)
+	}
+}
+
+// process 解析访问信息后发布到Redis，或直接分发给本实例的订阅者
+func (s *clickStream) process(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.events:
+			ua := ParseUserAgent(event.userAgent)
+			event.Browser = ua.Browser
+			event.BrowserVersion = ua.BrowserVersion
+			event.OS = ua.OS
+			event.Device = ua.Device
+			event.RefererHost = refererHost(event.Referer)
+
+			if !s.fanout {
+				s.dispatch(ctx, event)
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := s.redis.Publish(ctx, clickStreamChannel, data); err != nil {
+				logrus.Warnf("发布实时访问事件失败: %v", err)
+			}
+		}
+	}
+}
+
+// receive 分发从Redis收到的事件
+func (s *clickStream) receive(messages <-chan string) {
+	defer s.wg.Done()
+	ctx := context.Background()
+	for msg := range messages {
+		var event ClickEvent
+		if err := json.Unmarshal([]byte(msg), &event); err != nil {
+			continue
+		}
+		s.dispatch(ctx, event)
+	}
+}
+
+// announceListeners 本实例有订阅者时定期刷新Redis中的标记，并据此判断集群中是否有实例需要事件
+func (s *clickStream) announceListeners(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(clickListenersInterval)
+	defer ticker.Stop()
+
+	for {
+		s.mutex.Lock()
+		local := len(s.subs) > 0
+		s.mutex.Unlock()
+
+		if local {
+			if err := s.redis.Set(ctx, clickListenersKey, "1", clickListenersTTL); err != nil {
+				logrus.Warnf("更新实时访问订阅标记失败: %v", err)
+			}
+			s.listening.Store(true)
+		} else {
+			_, err := s.redis.Get(ctx, clickListenersKey)
+			s.listening.Store(err == nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch 将事件发送给范围匹配的订阅者，订阅者处理不过来时丢弃
+func (s *clickStream) dispatch(ctx context.Context, event ClickEvent) {
+	// 查询链接归属可能访问数据库，不在持有锁时进行
+	s.mutex.Lock()
+	needOwner := false
+	for _, sub := range s.subs {
+		if sub.filter.ShortCode == "" {
+			needOwner = true
+			break
+		}
+	}
+	s.mutex.Unlock()
+
+	var owner *clickOwner
+	if needOwner {
+		owner = s.lookupOwner(ctx, event.ShortCode)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, sub := range s.subs {
+		if !sub.matches(event.ShortCode, owner) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
+
+// matches 判断事件是否在订阅范围内，owner 为nil表示链接归属未知
+func (sub *clickSubscriber) matches(shortCode string, owner *clickOwner) bool {
+	if sub.filter.ShortCode != "" {
+		return sub.filter.ShortCode == shortCode
+	}
+	if owner == nil || owner.workspaceID != sub.filter.WorkspaceID {
+		return false
+	}
+	return sub.filter.WorkspaceID != 0 || owner.userID == sub.filter.UserID
+}
+
+// lookupOwner 查询链接所属的用户和团队空间，结果短时间缓存
+func (s *clickStream) lookupOwner(ctx context.Context, shortCode string) *clickOwner {
+	if v, ok := s.owners.Get(shortCode); ok {
+		return v.(*clickOwner)
+	}
+
+	var url model.URL
+	if err := s.db.WithContext(ctx).Select("user_id", "workspace_id").
+		Where("short_code = ?", shortCode).
+		First(&url).Error; err != nil {
+		return nil
+	}
+	owner := &clickOwner{userID: url.UserID, workspaceID: url.WorkspaceID}
+	s.owners.SetDefault(shortCode, owner)
+	return owner
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	hllPrecision = 12 // 4096个寄存器，标准误差约1.6%
+	hllRegisters = 1 << hllPrecision
+	// hllSparseMax 稀疏表示的最大寄存器数，超过后转为稠密表示，此时两种表示的大小相近
+	hllSparseMax = hllRegisters / 4
+
+	hllFormatSparse = 0
+	hllFormatDense  = 1
+)
+
+// hyperLogLog 估算不同元素数量的HyperLogLog
+// 访客较少时只保存非零寄存器，避免每个链接每天都占用完整的寄存器数组
+type hyperLogLog struct {
+	sparse map[uint16]uint8
+	dense  []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{sparse: make(map[uint16]uint8)}
+}
+
+// add 添加一个元素，hash 须为均匀分布的64位哈希值
+func (h *hyperLogLog) add(hash uint64) {
+	idx := uint16(hash >> (64 - hllPrecision))
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	h.set(idx, rank)
+}
+
+func (h *hyperLogLog) set(idx uint16, rank uint8) {
+	if h.dense != nil {
+		if rank > h.dense[idx] {
+			h.dense[idx] = rank
+		}
+		return
+	}
+	if rank > h.sparse[idx] {
+		h.sparse[idx] = rank
+		if len(h.sparse) > hllSparseMax {
+			h.toDense()
+		}
+	}
+}
+
+func (h *hyperLogLog) toDense() {
+	h.dense = make([]uint8, hllRegisters)
+	for idx, rank := range h.sparse {
+		h.dense[idx] = rank
+	}
+	h.sparse = nil
+}
+
+// merge 合并另一个HyperLogLog，结果为两者的并集
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	if other.dense != nil {
+		for idx, rank := range other.dense {
+			if rank > 0 {
+				h.set(uint16(idx), rank)
+			}
+		}
+		return
+	}
+	for idx, rank := range other.sparse {
+		h.set(idx, rank)
+	}
+}
+
+// count 估算不同元素的数量，基数较小时使用线性计数修正
+func (h *hyperLogLog) count() int64 {
+	m := float64(hllRegisters)
+	sum, zeros := 0.0, 0
+	if h.dense != nil {
+		for _, rank := range h.dense {
+			sum += math.Ldexp(1, -int(rank))
+			if rank == 0 {
+				zeros++
+			}
+		}
+	} else {
+		zeros = hllRegisters - len(h.sparse)
+		sum = float64(zeros)
+		for _, rank := range h.sparse {
+			sum += math.Ldexp(1, -int(rank))
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(estimate + 0.5)
+}
+
+// marshal 序列化，首字节为表示方式，稀疏表示为按序号排列的(2字节序号, 1字节值)
+func (h *hyperLogLog) marshal() []byte {
+	if h.dense != nil {
+		return append([]byte{hllFormatDense}, h.dense...)
+	}
+	idxs := make([]int, 0, len(h.sparse))
+	for idx := range h.sparse {
+		idxs = append(idxs, int(idx))
+	}
+	sort.Ints(idxs)
+
+	data := make([]byte, 1, 1+3*len(idxs))
+	data[0] = hllFormatSparse
+	for _, idx := range idxs {
+		data = binary.BigEndian.AppendUint16(data, uint16(idx))
+		data = append(data, h.sparse[uint16(idx)])
+	}
+	return data
+}
+
+func unmarshalHyperLogLog(data []byte) (*hyperLogLog, error) {
+	h := newHyperLogLog()
+	if len(data) == 0 {
+		return h, nil
+	}
+	switch data[0] {
+	case hllFormatDense:
+		if len(data) != 1+hllRegisters {
+			return nil, fmt.Errorf("HyperLogLog数据长度错误: %d", len(data))
+		}
+		h.sparse = nil
+		h.dense = append([]uint8(nil), data[1:]...)
+	case hllFormatSparse:
+		if (len(data)-1)%3 != 0 {
+			return nil, fmt.Errorf("HyperLogLog数据长度错误: %d", len(data))
+		}
+		for i := 1; i < len(data); i += 3 {
+			idx := binary.BigEndian.Uint16(data[i:])
+			if idx >= hllRegisters {
+				return nil, fmt.Errorf("HyperLogLog寄存器序号错误: %d", idx)
+			}
+			h.set(idx, data[i+2])
+		}
+	default:
+		return nil, fmt.Errorf("未知的HyperLogLog数据格式: %d", data[0])
+	}
+	return h, nil
+}
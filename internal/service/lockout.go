@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shorturl/internal/model"
+)
+
+const (
+	defaultMaxFailures       = 5
+	defaultIPMaxFailures     = 20
+	defaultLockoutDuration   = time.Minute * 15
+	defaultMaxLockout        = time.Hour * 24
+	defaultFailureResetAfter = time.Hour
+)
+
+// LoginLockedError 账户或IP因登录失败次数过多被临时锁定
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("登录失败次数过多，请在%d分钟后重试", int(e.RetryAfter.Minutes())+1)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyPassword 用户不存在时也执行一次bcrypt比较，使响应时间与密码错误时一致
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("shorturl-dummy-password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// checkLoginAllowed 检查用户名和IP是否处于锁定状态
+func (s *authService) checkLoginAllowed(ctx context.Context, username, ip string) error {
+	if s.config.Auth.Lockout.Disabled {
+		return nil
+	}
+
+	var throttles []model.LoginThrottle
+	if err := s.db.WithContext(ctx).
+		Where("(scope = ? AND identifier = ?) OR (scope = ? AND identifier = ?)",
+			model.LoginThrottleAccount, username, model.LoginThrottleIP, ip).
+		Where("locked_until > ?", time.Now()).
+		Find(&throttles).Error; err != nil {
+		// 查询失败时不阻止登录，避免数据库异常导致所有用户无法登录
+		logrus.Errorf("查询登录锁定状态失败: %v", err)
+		return nil
+	}
+
+	var retryAfter time.Duration
+	for _, t := range throttles {
+		if d := time.Until(*t.LockedUntil); d > retryAfter {
+			retryAfter = d
+		}
+	}
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordLoginFailure 记录一次登录失败，达到阈值后锁定，每次锁定时长翻倍
+func (s *authService) recordLoginFailure(ctx context.Context, username, ip string) {
+	if s.config.Auth.Lockout.Disabled {
+		return
+	}
+
+	lc := s.config.Auth.Lockout
+	accountMax := lc.MaxFailures
+	if accountMax <= 0 {
+		accountMax = defaultMaxFailures
+	}
+	ipMax := lc.IPMaxFailures
+	if ipMax <= 0 {
+		ipMax = defaultIPMaxFailures
+	}
+
+	if username != "" {
+		s.incrementThrottle(ctx, model.LoginThrottleAccount, username, accountMax)
+	}
+	if ip != "" {
+		s.incrementThrottle(ctx, model.LoginThrottleIP, ip, ipMax)
+	}
+}
+
+// clearAccountFailures 登录成功后清除该账户的失败计数，IP维度的计数保留
+func (s *authService) clearAccountFailures(ctx context.Context, username string) {
+	if err := s.db.WithContext(ctx).
+		Where("scope = ? AND identifier = ?", model.LoginThrottleAccount, username).
+		Delete(&model.LoginThrottle{}).Error; err != nil {
+		logrus.Errorf("清除登录失败记录失败: %v", err)
+	}
+}
+
+func (s *authService) incrementThrottle(ctx context.Context, scope, key string, maxFailures int) {
+	now := time.Now()
+	identifier := truncateRunes(key, 255)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 先确保记录存在，再用 SELECT ... FOR UPDATE 锁定，并发的失败请求依次累加，不会互相覆盖计数；
+		// SQLite 不支持行锁，但插入语句已使事务成为唯一的写事务，其他事务须等待提交后才能读写
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.LoginThrottle{Scope: scope, Identifier: identifier}).Error; err != nil {
+			return err
+		}
+		var t model.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("scope = ? AND identifier = ?", scope, identifier).
+			First(&t).Error; err != nil {
+			return err
+		}
+
+		// 已锁定期间的请求在检查阶段就被拒绝，这里只处理未锁定的情况
+		if t.LockedUntil != nil && t.LockedUntil.After(now) {
+			return nil
+		}
+		// 长时间没有失败记录，重新计数；锁定期间的请求不计入失败，从锁定结束时开始计算，
+		// 否则锁定时长超过重置间隔时，解锁后的第一次失败就会清零锁定次数，锁定时长无法继续翻倍
+		quietSince := t.LastFailedAt
+		if t.LockedUntil != nil && t.LockedUntil.After(quietSince) {
+			quietSince = *t.LockedUntil
+		}
+		if !quietSince.IsZero() && now.Sub(quietSince) > s.failureResetAfter() {
+			t.Failures = 0
+			t.Lockouts = 0
+		}
+
+		t.Failures++
+		t.LastFailedAt = now
+		if t.Failures >= maxFailures {
+			t.Lockouts++
+			t.Failures = 0
+			until := now.Add(s.lockoutDuration(t.Lockouts))
+			t.LockedUntil = &until
+			logrus.Warnf("登录失败次数过多，已锁定 %s=%s 至 %s", scope, key, until.Format(time.RFC3339))
+		}
+		return tx.Save(&t).Error
+	})
+	if err != nil {
+		logrus.Errorf("记录登录失败次数失败: %v", err)
+	}
+}
+
+// lockoutDuration 计算第n次锁定的时长
+func (s *authService) lockoutDuration(n int) time.Duration {
+	base := defaultLockoutDuration
+	if s.config.Auth.Lockout.LockoutMinutes > 0 {
+		base = time.Duration(s.config.Auth.Lockout.LockoutMinutes) * time.Minute
+	}
+	max := defaultMaxLockout
+	if s.config.Auth.Lockout.MaxLockoutMinutes > 0 {
+		max = time.Duration(s.config.Auth.Lockout.MaxLockoutMinutes) * time.Minute
+	}
+
+	d := base
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// failureResetAfter 返回失败计数的重置间隔
+func (s *authService) failureResetAfter() time.Duration {
+	if s.config.Auth.Lockout.ResetMinutes > 0 {
+		return time.Duration(s.config.Auth.Lockout.ResetMinutes) * time.Minute
+	}
+	return defaultFailureResetAfter
+}
+
+// ListLoginThrottles 获取仍在计数窗口内或处于锁定状态的登录失败记录
+func (s *authService) ListLoginThrottles(ctx context.Context, lockedOnly bool) ([]model.LoginThrottle, error) {
+	now := time.Now()
+	query := s.db.WithContext(ctx).Model(&model.LoginThrottle{})
+	if lockedOnly {
+		query = query.Where("locked_until > ?", now)
+	} else {
+		since := now.Add(-s.failureResetAfter())
+		query = query.Where("locked_until > ? OR last_failed_at > ?", since, since)
+	}
+
+	var throttles []model.LoginThrottle
+	if err := query.Order("last_failed_at DESC").Limit(500).Find(&throttles).Error; err != nil {
+		return nil, fmt.Errorf("获取登录锁定记录失败: %v", err)
+	}
+	return throttles, nil
+}
+
+// ClearLoginThrottle 解除锁定并清空失败计数
+func (s *authService) ClearLoginThrottle(ctx context.Context, id uint) (*model.LoginThrottle, error) {
+	var t model.LoginThrottle
+	if err := s.db.WithContext(ctx).First(&t, id).Error; err != nil {
+		return nil, fmt.Errorf("记录不存在")
+	}
+	if err := s.db.WithContext(ctx).Delete(&t).Error; err != nil {
+		return nil, fmt.Errorf("解除锁定失败: %v", err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"shorturl/config"
+	"shorturl/internal/model"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		lockout config.LockoutConfig
+		n       int
+		want    time.Duration
+	}{
+		{name: "默认首次锁定", n: 1, want: 15 * time.Minute},
+		{name: "默认第二次翻倍", n: 2, want: 30 * time.Minute},
+		{name: "默认第四次", n: 4, want: 2 * time.Hour},
+		{name: "默认不超过上限", n: 10, want: 24 * time.Hour},
+		{name: "自定义时长", lockout: config.LockoutConfig{LockoutMinutes: 5}, n: 3, want: 20 * time.Minute},
+		{name: "自定义上限", lockout: config.LockoutConfig{LockoutMinutes: 5, MaxLockoutMinutes: 12}, n: 3, want: 12 * time.Minute},
+		{name: "上限小于首次时长", lockout: config.LockoutConfig{LockoutMinutes: 30, MaxLockoutMinutes: 10}, n: 1, want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Auth.Lockout = tt.lockout
+			s := &authService{config: cfg}
+			if got := s.lockoutDuration(tt.n); got != tt.want {
+				t.Fatalf("lockoutDuration(%d) = %v，期望 %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncrementThrottleResetWindow(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	ptr := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name         string
+		existing     *model.LoginThrottle // 为空表示没有失败记录
+		wantFailures int
+		wantLockouts int
+		wantLocked   bool
+	}{
+		{
+			name:         "首次失败",
+			wantFailures: 1,
+		},
+		{
+			name:         "窗口内继续累加",
+			existing:     &model.LoginThrottle{Failures: 1, LastFailedAt: ago(30 * time.Minute)},
+			wantFailures: 2,
+		},
+		{
+			name:         "超过重置间隔重新计数",
+			existing:     &model.LoginThrottle{Failures: 2, Lockouts: 1, LastFailedAt: ago(2 * time.Hour)},
+			wantFailures: 1,
+		},
+		{
+			name:         "达到次数后锁定",
+			existing:     &model.LoginThrottle{Failures: 2, LastFailedAt: ago(time.Minute)},
+			wantLockouts: 1,
+			wantLocked:   true,
+		},
+		{
+			// 锁定时长超过重置间隔时，从锁定结束开始计算，锁定次数保留以便继续翻倍
+			name: "从锁定结束时开始计算重置间隔",
+			existing: &model.LoginThrottle{Lockouts: 3, LastFailedAt: ago(3 * time.Hour),
+				LockedUntil: ptr(ago(10 * time.Minute))},
+			wantFailures: 1,
+			wantLockouts: 3,
+		},
+		{
+			name: "锁定结束后超过重置间隔清零",
+			existing: &model.LoginThrottle{Lockouts: 3, LastFailedAt: ago(5 * time.Hour),
+				LockedUntil: ptr(ago(2 * time.Hour))},
+			wantFailures: 1,
+		},
+		{
+			name: "锁定期间不计入失败",
+			existing: &model.LoginThrottle{Lockouts: 1, LastFailedAt: ago(time.Minute),
+				LockedUntil: ptr(now.Add(10 * time.Minute))},
+			wantLockouts: 1,
+			wantLocked:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDB(t, &model.LoginThrottle{})
+			cfg := &config.Config{}
+			cfg.Auth.Lockout.ResetMinutes = 60
+			s := &authService{db: db, config: cfg}
+
+			if tt.existing != nil {
+				tt.existing.Scope = model.LoginThrottleAccount
+				tt.existing.Identifier = "alice"
+				if err := db.Create(tt.existing).Error; err != nil {
+					t.Fatalf("创建失败记录失败: %v", err)
+				}
+			}
+
+			s.incrementThrottle(ctx, model.LoginThrottleAccount, "alice", 3)
+
+			var got model.LoginThrottle
+			if err := db.Where("scope = ? AND identifier = ?", model.LoginThrottleAccount, "alice").First(&got).Error; err != nil {
+				t.Fatalf("查询失败记录失败: %v", err)
+			}
+			if got.Failures != tt.wantFailures || got.Lockouts != tt.wantLockouts {
+				t.Fatalf("failures=%d lockouts=%d，期望 failures=%d lockouts=%d",
+					got.Failures, got.Lockouts, tt.wantFailures, tt.wantLockouts)
+			}
+			if locked := got.LockedUntil != nil && got.LockedUntil.After(time.Now()); locked != tt.wantLocked {
+				t.Fatalf("锁定状态 = %v，期望 %v", locked, tt.wantLocked)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+
+	"shorturl/config"
+	"shorturl/internal/model"
+)
+
+const (
+	oidcStateTTL         = time.Minute * 10 // 授权请求状态有效期
+	defaultUsernameClaim = "preferred_username"
+	defaultGroupsClaim   = "groups"
+)
+
+// OIDCLoginResult 单点登录回调处理结果
+type OIDCLoginResult struct {
+	User     *model.User
+	ReturnTo string // 登录完成后跳转的本站路径
+	Mode     string // web 写入Cookie并跳转，api 返回JSON令牌
+}
+
+// OIDCService OpenID Connect单点登录服务接口
+type OIDCService interface {
+	Enabled() bool
+	AuthCodeURL(ctx context.Context, returnTo, mode string) (authURL string, state string, err error)
+	HandleCallback(ctx context.Context, code, state, stateToken string) (*OIDCLoginResult, error)
+}
+
+type oidcService struct {
+	db     *gorm.DB
+	config *config.Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauth2   *oauth2.Config
+}
+
+// NewOIDCService 创建单点登录服务
+func NewOIDCService(db *gorm.DB, cfg *config.Config) OIDCService {
+	return &oidcService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// Enabled 返回是否启用了单点登录
+func (s *oidcService) Enabled() bool {
+	return s.config.Auth.OIDC.Enabled
+}
+
+// init 延迟执行服务发现，身份提供方暂时不可用时不影响服务启动
+func (s *oidcService) init(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.provider != nil {
+		return nil
+	}
+
+	cfg := s.config.Auth.OIDC
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return fmt.Errorf("OIDC服务发现失败: %v", err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+
+	s.provider = provider
+	s.verifier = provider.Verifier(&oidc.Config{ClientID: cfg.ClientID})
+	s.oauth2 = &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+
+	logrus.Infof("OIDC服务发现成功: %s", cfg.Issuer)
+	return nil
+}
+
+// AuthCodeURL 生成授权地址，并返回需要写入Cookie的签名状态
+func (s *oidcService) AuthCodeURL(ctx context.Context, returnTo, mode string) (string, string, error) {
+	if !s.Enabled() {
+		return "", "", fmt.Errorf("未启用单点登录")
+	}
+	if err := s.init(ctx); err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	// 状态、nonce和PKCE校验码签名后保存在客户端，多实例部署时无需共享存储
+	stateToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state":     state,
+		"nonce":     nonce,
+		"verifier":  verifier,
+		"return_to": returnTo,
+		"mode":      mode,
+		"exp":       time.Now().Add(oidcStateTTL).Unix(),
+	}).SignedString([]byte(s.config.Auth.SecretKey))
+	if err != nil {
+		return "", "", fmt.Errorf("签名授权状态失败: %v", err)
+	}
+
+	authURL := s.oauth2.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	)
+
+	return authURL, stateToken, nil
+}
+
+// HandleCallback 校验回调参数、兑换授权码并返回对应的本地用户
+func (s *oidcService) HandleCallback(ctx context.Context, code, state, stateToken string) (*OIDCLoginResult, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("未启用单点登录")
+	}
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+
+	saved, err := s.parseState(stateToken)
+	if err != nil {
+		return nil, err
+	}
+	if saved["state"] != state {
+		return nil, fmt.Errorf("授权状态不匹配")
+	}
+
+	token, err := s.oauth2.Exchange(ctx, code, oauth2.VerifierOption(saved["verifier"]))
+	if err != nil {
+		return nil, fmt.Errorf("兑换授权码失败: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("响应中缺少ID令牌")
+	}
+
+	idToken, err := s.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("校验ID令牌失败: %v", err)
+	}
+	if idToken.Nonce != saved["nonce"] {
+		return nil, fmt.Errorf("ID令牌nonce不匹配")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("解析ID令牌声明失败: %v", err)
+	}
+
+	user, err := s.provisionUser(ctx, idToken.Issuer, idToken.Subject, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCLoginResult{
+		User:     user,
+		ReturnTo: saved["return_to"],
+		Mode:     saved["mode"],
+	}, nil
+}
+
+// parseState 校验并解析授权状态
+func (s *oidcService) parseState(stateToken string) (map[string]string, error) {
+	token, err := jwt.Parse(stateToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("无效的签名方法: %v", token.Header["alg"])
+		}
+		return []byte(s.config.Auth.SecretKey), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("授权状态无效或已过期: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("授权状态无效")
+	}
+
+	result := make(map[string]string)
+	for _, key := range []string{"state", "nonce", "verifier", "return_to", "mode"} {
+		value, _ := claims[key].(string)
+		result[key] = value
+	}
+	return result, nil
+}
+
+// provisionUser 按外部身份查找用户，首次登录时自动创建本地账户
+func (s *oidcService) provisionUser(ctx context.Context, issuer, subject string, claims map[string]interface{}) (*model.User, error) {
+	cfg := s.config.Auth.OIDC
+	externalID := issuer + "|" + subject
+	email, _ := claims["email"].(string)
+
+	var user model.User
+	err := s.db.WithContext(ctx).Where("external_id = ?", externalID).First(&user).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("查询用户失败: %v", err)
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		username, err := s.uniqueUsername(ctx, usernameFromClaims(claims, cfg.UsernameClaim, subject))
+		if err != nil {
+			return nil, err
+		}
+
+		// 单点登录账户不使用本地密码，写入无法猜测的随机哈希
+		secret, err := randomString(32)
+		if err != nil {
+			return nil, err
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("密码加密失败: %v", err)
+		}
+
+		user = model.User{
+			Username:     username,
+			Password:     string(hashedPassword),
+			Email:        email,
+			Role:         model.RoleEditor,
+			AuthProvider: "oidc",
+			ExternalID:   externalID,
+		}
+		if err := s.db.WithContext(ctx).Create(&user).Error; err != nil {
+			return nil, fmt.Errorf("创建用户失败: %v", err)
+		}
+		logrus.Infof("单点登录自动创建用户: %s", username)
+	}
+
+	updates := map[string]interface{}{"last_login_at": time.Now()}
+	if email != "" {
+		updates["email"] = email
+	}
+
+	// 配置了管理员组时，每次登录按身份提供方的组信息同步管理员权限
+	demote := false
+	if len(cfg.AdminGroups) > 0 {
+		groupsClaim := cfg.GroupsClaim
+		if groupsClaim == "" {
+			groupsClaim = defaultGroupsClaim
+		}
+		if containsAny(claimStrings(claims[groupsClaim]), cfg.AdminGroups) {
+			updates["role"] = model.RoleAdmin
+			updates["is_admin"] = true
+		} else if user.Role == model.RoleAdmin {
+			demote = true
+		}
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 身份提供方的组配置有误时不能移除最后一个管理员，保留权限并提示检查配置
+		if demote {
+			if err := ensureOtherAdmin(tx, user.ID); err != nil {
+				logrus.Warnf("单点登录用户 %s 不在管理员组中，但未移除其管理员权限: %v", user.Username, err)
+			} else {
+				updates["role"] = model.RoleEditor
+				updates["is_admin"] = false
+			}
+		}
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("更新用户信息失败: %v", err)
+	}
+	if err := s.db.WithContext(ctx).First(&user, user.ID).Error; err != nil {
+		return nil, fmt.Errorf("获取用户失败: %v", err)
+	}
+
+	return &user, nil
+}
+
+// uniqueUsername 用户名冲突时追加数字后缀
+func (s *oidcService) uniqueUsername(ctx context.Context, base string) (string, error) {
+	base = truncateRunes(base, 56)
+
+	candidate := base
+	for i := 1; i <= 100; i++ {
+		var count int64
+		if err := s.db.WithContext(ctx).Model(&model.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("检查用户失败: %v", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	return "", fmt.Errorf("无法生成唯一用户名")
+}
+
+// usernameFromClaims 从声明中选取用户名，依次尝试配置的声明、邮箱前缀和subject
+func usernameFromClaims(claims map[string]interface{}, claim, subject string) string {
+	if claim == "" {
+		claim = defaultUsernameClaim
+	}
+	if name, ok := claims[claim].(string); ok && name != "" {
+		return name
+	}
+	if email, ok := claims["email"].(string); ok && email != "" {
+		return strings.SplitN(email, "@", 2)[0]
+	}
+	return subject
+}
+
+// claimStrings 将字符串或字符串数组形式的声明统一转换为切片
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// containsAny 判断两个切片是否有交集
+func containsAny(values, targets []string) bool {
+	for _, v := range values {
+		for _, t := range targets {
+			if v == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// randomString 生成URL安全的随机字符串
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"shorturl/internal/mail"
+	"shorturl/internal/model"
+)
+
+const (
+	minPasswordLength            = 6
+	defaultPasswordResetExpires  = time.Minute * 30 // 找回密码链接默认有效期
+	defaultPasswordResetsPerHour = 5
+	temporaryPasswordLength      = 12
+	// 临时密码字符集，去掉了容易混淆的 0/O、1/l/I
+	temporaryPasswordChars = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// ErrOIDCPassword 单点登录账户的密码由身份提供方管理
+var ErrOIDCPassword = errors.New("单点登录账户请在身份提供方修改密码")
+
+// ErrPasswordResetRateLimited 同一IP或邮箱申请找回密码过于频繁
+var ErrPasswordResetRateLimited = errors.New("申请过于频繁，请稍后再试")
+
+// ChangePassword 校验当前密码后修改密码，吊销其他会话并为当前客户端签发新令牌
+func (s *authService) ChangePassword(ctx context.Context, userID uint, currentPassword, newPassword string, client ClientInfo) (*TokenPair, error) {
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	if user.AuthProvider == "oidc" {
+		return nil, ErrOIDCPassword
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return nil, fmt.Errorf("当前密码错误")
+	}
+	if err := validateNewPassword(newPassword); err != nil {
+		return nil, err
+	}
+	if currentPassword == newPassword {
+		return nil, fmt.Errorf("新密码不能与当前密码相同")
+	}
+
+	if err := s.ResetPassword(ctx, user.ID, newPassword); err != nil {
+		return nil, err
+	}
+
+	// 令牌版本已递增，重新加载后签发的令牌才有效
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("获取用户失败: %v", err)
+	}
+	return s.createSession(ctx, &user, client)
+}
+
+// RequestPasswordReset 为邮箱对应的本地账户生成找回密码链接并发送邮件
+// 邮箱没有唯一约束，多个本地账户使用同一邮箱时为每个账户分别发送链接，邮件中注明用户名。
+// 邮箱不存在时同样返回成功，避免泄露账户是否存在；同一IP或邮箱申请过于频繁时返回 ErrPasswordResetRateLimited
+func (s *authService) RequestPasswordReset(ctx context.Context, email, ip string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return fmt.Errorf("请输入邮箱")
+	}
+	if err := s.limitPasswordResets(ctx, email, ip); err != nil {
+		return err
+	}
+
+	var users []model.User
+	if err := s.db.WithContext(ctx).
+		Where("email = ? AND auth_provider = ?", email, "local").
+		Order("id").Find(&users).Error; err != nil {
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+	if len(users) == 0 {
+		// 不记录邮箱，避免日志中留下他人提交的邮箱地址
+		return nil
+	}
+
+	tokens := make([]string, len(users))
+	for i := range users {
+		token, err := generateRefreshToken()
+		if err != nil {
+			return err
+		}
+		tokens[i] = token
+	}
+
+	now := time.Now()
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, user := range users {
+			// 新链接生成后，之前未使用的链接全部作废
+			if err := tx.Model(&model.PasswordResetToken{}).
+				Where("user_id = ? AND used_at IS NULL", user.ID).
+				Update("used_at", now).Error; err != nil {
+				return fmt.Errorf("作废旧的找回密码链接失败: %v", err)
+			}
+			if err := tx.Create(&model.PasswordResetToken{
+				UserID:    user.ID,
+				TokenHash: hashToken(tokens[i]),
+				IP:        ip,
+				ExpiresAt: now.Add(s.passwordResetExpires()),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("创建找回密码链接失败: %v", err)
+	}
+
+	msgs := make([]*mail.Message, len(users))
+	for i, user := range users {
+		link := strings.TrimRight(s.config.Server.BaseURL, "/") + "/admin?reset_token=" + url.QueryEscape(tokens[i])
+		msgs[i] = &mail.Message{
+			To:      user.Email,
+			Subject: "重置您的短链接服务密码",
+			Body: fmt.Sprintf("%s，您好:\n\n我们收到了重置账户 %s 密码的请求。请在 %d 分钟内打开以下链接设置新密码:\n\n%s\n\n如果这不是您本人的操作，请忽略此邮件，您的密码不会改变。\n",
+				user.Username, user.Username, int(s.passwordResetExpires().Minutes()), link),
+		}
+	}
+
+	// 异步发送，响应时间不因账户是否存在而不同
+	go func() {
+		for _, msg := range msgs {
+			sendCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+			if err := s.mailer.Send(sendCtx, msg); err != nil {
+				logrus.Errorf("发送找回密码邮件失败: %v", err)
+			}
+			cancel()
+		}
+	}()
+
+	return nil
+}
+
+// limitPasswordResets 统计最近一小时同一IP和同一邮箱的找回密码请求，未超出限制时记录本次请求
+// 邮箱不存在的请求同样计数，限制结果不会泄露账户是否存在
+func (s *authService) limitPasswordResets(ctx context.Context, email, ip string) error {
+	limit := s.config.Auth.PasswordResetsPerHour
+	if limit <= 0 {
+		limit = defaultPasswordResetsPerHour
+	}
+	emailHash := hashToken(strings.ToLower(email))
+	since := time.Now().Add(-time.Hour)
+
+	db := s.db.WithContext(ctx)
+	// 清理超出统计窗口的记录
+	if err := db.Where("created_at <= ?", since).Delete(&model.PasswordResetRequest{}).Error; err != nil {
+		logrus.Warnf("清理找回密码请求记录失败: %v", err)
+	}
+
+	var byIP, byEmail int64
+	if err := db.Model(&model.PasswordResetRequest{}).
+		Where("ip = ? AND created_at > ?", ip, since).
+		Count(&byIP).Error; err != nil {
+		return fmt.Errorf("查询找回密码请求失败: %v", err)
+	}
+	if err := db.Model(&model.PasswordResetRequest{}).
+		Where("email_hash = ? AND created_at > ?", emailHash, since).
+		Count(&byEmail).Error; err != nil {
+		return fmt.Errorf("查询找回密码请求失败: %v", err)
+	}
+	if byIP >= int64(limit) || byEmail >= int64(limit) {
+		return ErrPasswordResetRateLimited
+	}
+
+	if err := db.Create(&model.PasswordResetRequest{EmailHash: emailHash, IP: ip}).Error; err != nil {
+		return fmt.Errorf("记录找回密码请求失败: %v", err)
+	}
+	return nil
+}
+
+// ResetPasswordWithToken 使用找回密码令牌设置新密码，令牌只能使用一次
+func (s *authService) ResetPasswordWithToken(ctx context.Context, token, newPassword string) error {
+	if err := validateNewPassword(newPassword); err != nil {
+		return err
+	}
+
+	var userID uint
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record model.PasswordResetToken
+		if err := tx.Where("token_hash = ? AND used_at IS NULL", hashToken(token)).
+			First(&record).Error; err != nil {
+			return fmt.Errorf("链接无效或已使用")
+		}
+		if time.Now().After(record.ExpiresAt) {
+			return fmt.Errorf("链接已过期，请重新申请")
+		}
+
+		// 以条件更新占用令牌，防止并发请求重复使用
+		result := tx.Model(&model.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", record.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("更新找回密码链接失败: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("链接无效或已使用")
+		}
+
+		userID = record.UserID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.ResetPassword(ctx, userID, newPassword)
+}
+
+// ResetPasswordTemporary 管理员重置密码，生成随机临时密码并要求用户下次登录后修改
+func (s *authService) ResetPasswordTemporary(ctx context.Context, userID uint) (string, error) {
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return "", fmt.Errorf("用户不存在")
+	}
+	// 单点登录账户无法修改密码，设置临时密码后会因必须修改密码而无法使用
+	if user.AuthProvider == "oidc" {
+		return "", ErrOIDCPassword
+	}
+
+	password, err := generateTemporaryPassword()
+	if err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("密码加密失败: %v", err)
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password":             string(hashedPassword),
+			"must_change_password": true,
+		}).Error; err != nil {
+			return fmt.Errorf("更新密码失败: %v", err)
+		}
+		return revokeUserSessions(tx, userID)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+// passwordResetExpires 返回找回密码链接有效期
+func (s *authService) passwordResetExpires() time.Duration {
+	if s.config.Auth.PasswordResetExpires > 0 {
+		return time.Duration(s.config.Auth.PasswordResetExpires) * time.Minute
+	}
+	return defaultPasswordResetExpires
+}
+
+// validateNewPassword 校验新密码强度
+func validateNewPassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("密码长度至少为%d个字符", minPasswordLength)
+	}
+	return nil
+}
+
+// generateTemporaryPassword 生成随机临时密码
+func generateTemporaryPassword() (string, error) {
+	max := big.NewInt(int64(len(temporaryPasswordChars)))
+	buf := make([]byte, temporaryPasswordLength)
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("生成随机数失败: %v", err)
+		}
+		buf[i] = temporaryPasswordChars[n.Int64()]
+	}
+	return string(buf), nil
+}
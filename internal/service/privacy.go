@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"shorturl/config"
+	"shorturl/internal/model"
+)
+
+// 访问明细中IP的保存方式
+const (
+	IPModeFull     = "full"
+	IPModeTruncate = "truncate" // IPv4 保留前三段，IPv6 保留前48位
+	IPModeHash     = "hash"     // 带密钥的哈希，无法还原，但同一IP的哈希相同，可以按IP删除
+	IPModeNone     = "none"
+)
+
+const ipHashPrefix = "h:" // 区分保存的哈希值和IP
+
+// ipAnonymizer 写入访问明细前按配置处理IP
+type ipAnonymizer struct {
+	mode string
+	key  []byte
+}
+
+func newIPAnonymizer(cfg *config.Config) *ipAnonymizer {
+	a := &ipAnonymizer{mode: cfg.Privacy.IPMode}
+	switch a.mode {
+	case "":
+		a.mode = IPModeFull
+	case IPModeFull, IPModeTruncate, IPModeNone:
+	case IPModeHash:
+		key := cfg.Privacy.IPHashKey
+		if key == "" {
+			key = "visit-ip:" + cfg.Auth.SecretKey
+		}
+		sum := sha256.Sum256([]byte(key))
+		a.key = sum[:]
+	default:
+		// 配置错误时按最保守的方式处理，不保存IP
+		logrus.Warnf("未知的IP保存方式 %q，将不保存访问IP", a.mode)
+		a.mode = IPModeNone
+	}
+	return a
+}
+
+// anonymize 返回写入访问明细的IP
+func (a *ipAnonymizer) anonymize(ip string) string {
+	switch a.mode {
+	case IPModeTruncate:
+		return truncateIP(ip)
+	case IPModeHash:
+		return a.hash(ip)
+	case IPModeNone:
+		return ""
+	}
+	return ip
+}
+
+func (a *ipAnonymizer) hash(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(ip))
+	return ipHashPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// storedForms 返回同一IP在访问明细中可能的保存形式，用于按IP删除
+// 包括完整IP(切换保存方式之前写入的明细)和当前方式处理后的值；truncate 方式下会匹配同一网段的全部访问
+func (a *ipAnonymizer) storedForms(ip string) []string {
+	forms := []string{ip}
+	if stored := a.anonymize(ip); stored != "" && stored != ip {
+		forms = append(forms, stored)
+	}
+	return forms
+}
+
+// truncateIP IPv4 将最后一段置0，IPv6 保留前48位；无法解析时返回空字符串
+func truncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// doNotTrack 判断访问者是否通过 DNT 或 Global Privacy Control 请求不被跟踪
+func doNotTrack(r *http.Request) bool {
+	return r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1"
+}
+
+// SetNoTracking 设置链接是否记录访问明细，关闭后只累计访问次数
+func (s *urlService) SetNoTracking(ctx context.Context, shortCode string, noTracking bool) error {
+	result := s.db.WithContext(ctx).Model(&model.URL{}).Where("short_code = ?", shortCode).Update("no_tracking", noTracking)
+	if result.Error != nil {
+		return fmt.Errorf("更新链接跟踪设置失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("短链接不存在")
+	}
+	s.InvalidateCache(ctx, shortCode)
+	return nil
+}
+
+// EraseURLVisits 删除链接的全部访问数据: 访问明细、汇总统计、独立访客和访问次数，返回删除的明细条数
+func (s *urlService) EraseURLVisits(ctx context.Context, shortCode string) (int64, error) {
+	var url model.URL
+	if err := s.db.WithContext(ctx).Select("id").Where("short_code = ?", shortCode).First(&url).Error; err != nil {
+		return 0, errors.New("短链接不存在")
+	}
+
+	erasedAt := time.Now()
+	var erased int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 锁定汇总进度，与进行中的汇总互斥；汇总提交时会发现明细已被删除并重新读取
+		if err := tx.Model(&model.RollupState{}).Where("name = ?", rollupStateName).
+			Update("last_visit_id", gorm.Expr("last_visit_id")).Error; err != nil {
+			return err
+		}
+		result := tx.Where("url_id = ?", url.ID).Delete(&model.URLVisit{})
+		if result.Error != nil {
+			return result.Error
+		}
+		erased = result.RowsAffected
+		if err := tx.Where("url_id = ?", url.ID).Delete(&model.HourlyVisitRollup{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("url_id = ?", url.ID).Delete(&model.DailyVisitRollup{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.URL{}).Where("id = ?", url.ID).Update("visits", 0).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("删除访问数据失败: %v", err)
+	}
+
+	// 尚未同步的访问次数
+	if counter, ok := s.statsCounters.Load(shortCode); ok {
+		atomic.StoreInt64(counter.(*int64), 0)
+	}
+	if err := s.uniques.erase(ctx, url.ID); err != nil {
+		logrus.Warnf("删除独立访客数据失败: %v", err)
+	}
+	s.InvalidateCache(ctx, shortCode)
+
+	// 删除前已缓冲、尚未写入的明细会在下次批量写入时提交，稍后再删除一次
+	s.eraseLater(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("url_id = ? AND created_at <= ?", url.ID, erasedAt)
+	})
+	return erased, nil
+}
+
+// EraseVisitsByIP 删除某个IP的访问明细，urlIDs 为 nil 时删除全部链接的明细，返回删除的条数
+// 汇总统计和独立访客数据不含IP，予以保留；truncate 方式下同一网段的明细无法区分，会一并删除
+func (s *urlService) EraseVisitsByIP(ctx context.Context, ip string, urlIDs []uint) (int64, error) {
+	if net.ParseIP(ip) == nil {
+		return 0, errors.New("无效的IP地址")
+	}
+	if urlIDs != nil && len(urlIDs) == 0 {
+		return 0, nil
+	}
+
+	forms := s.privacy.storedForms(ip)
+	scope := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("ip IN ?", forms)
+		if urlIDs != nil {
+			tx = tx.Where("url_id IN ?", urlIDs)
+		}
+		return tx
+	}
+
+	erasedAt := time.Now()
+	result := scope(s.db.WithContext(ctx)).Delete(&model.URLVisit{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("删除访问明细失败: %v", result.Error)
+	}
+	s.eraseLater(func(tx *gorm.DB) *gorm.DB {
+		return scope(tx).Where("created_at <= ?", erasedAt)
+	})
+	return result.RowsAffected, nil
+}
+
+// eraseLater 等待缓冲中的明细写入后再删除一次符合条件的明细
+func (s *urlService) eraseLater(scope func(tx *gorm.DB) *gorm.DB) {
+	time.AfterFunc(flushInterval*2, func() {
+		if err := scope(s.db).Delete(&model.URLVisit{}).Error; err != nil {
+			logrus.Warnf("删除缓冲中的访问明细失败: %v", err)
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shorturl/config"
+	"shorturl/internal/model"
+)
+
+// 套餐中可开放的功能，目前只有自定义短码，不支持自定义域名
+const (
+	FeatureCustomAlias = "custom_alias" // 自定义短码
+)
+
+// planFeatures 支持的套餐功能
+var planFeatures = map[string]bool{FeatureCustomAlias: true}
+
+// 套餐限额项
+const (
+	QuotaActiveLinks = "max_active_links"
+	QuotaLinksPerDay = "max_links_per_day"
+	QuotaExpiry      = "max_expiry_days"
+)
+
+// aliasPattern 自定义短码只允许字母、数字、下划线和连字符
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,10}$`)
+
+// reservedAliases 与页面路由冲突的短码
+var reservedAliases = map[string]bool{
+	"api": true, "static": true, "admin": true, "dashboard": true, "report": true, "preview": true,
+}
+
+// QuotaExceededError 超出套餐限额或使用了套餐未开放的功能
+type QuotaExceededError struct {
+	Limit string // 限额项或功能名称
+	Max   int
+}
+
+func (e *QuotaExceededError) Error() string {
+	switch e.Limit {
+	case QuotaActiveLinks:
+		return fmt.Sprintf("有效链接数量已达套餐上限(%d个)，请删除不再使用的链接或升级套餐", e.Max)
+	case QuotaLinksPerDay:
+		return fmt.Sprintf("今日创建的链接数量已达套餐上限(%d个)", e.Max)
+	case QuotaExpiry:
+		return fmt.Sprintf("链接有效期不能超过%d天", e.Max)
+	default:
+		return fmt.Sprintf("当前套餐不支持该功能: %s", e.Limit)
+	}
+}
+
+// AliasError 自定义短码格式不正确或已被占用
+type AliasError struct {
+	Reason string
+}
+
+func (e *AliasError) Error() string {
+	return e.Reason
+}
+
+// QuotaUsage 用户当前用量与套餐限额
+type QuotaUsage struct {
+	Plan        string            `json:"plan"`
+	Limits      config.PlanConfig `json:"limits"`
+	ActiveLinks int64             `json:"active_links"`
+	LinksToday  int64             `json:"links_today"`
+	Unlimited   bool              `json:"unlimited"` // 未配置套餐时为true
+}
+
+// GetQuotaUsage 获取用户的套餐用量
+func (s *urlService) GetQuotaUsage(ctx context.Context, userID uint) (*QuotaUsage, error) {
+	db := s.db.WithContext(ctx)
+	planName, plan, ok, err := s.userPlan(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &QuotaUsage{Plan: planName, Unlimited: !ok}
+	if ok {
+		usage.Limits = *plan
+	}
+	if usage.ActiveLinks, err = countActiveLinks(db, userID); err != nil {
+		return nil, err
+	}
+	if usage.LinksToday, err = countLinksToday(db, userID); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// checkQuota 检查创建链接是否超出用户套餐限额，返回按套餐调整后的有效期
+// 未指定有效期时使用默认的1年，超过套餐上限则缩短为上限；显式指定的有效期超过上限时报错。
+// 须在写入链接的事务中调用: 用 SELECT ... FOR UPDATE 锁定用户记录，同一用户并发创建链接时依次统计和写入，
+// 不会同时通过检查而超出限额；SQLite 不支持行锁，但同一时间只允许一个写事务，读取后数据被修改时写入会失败
+func (s *urlService) checkQuota(tx *gorm.DB, userID uint, alias string, expiration time.Duration) (time.Duration, error) {
+	if expiration == 0 {
+		expiration = defaultURLExpiration
+	}
+	if userID == 0 {
+		return expiration, nil
+	}
+
+	_, plan, ok, err := s.userPlan(tx.Clauses(clause.Locking{Strength: "UPDATE"}), userID)
+	if err != nil || !ok {
+		return expiration, err
+	}
+
+	if alias != "" && !planHasFeature(plan, FeatureCustomAlias) {
+		return 0, &QuotaExceededError{Limit: FeatureCustomAlias}
+	}
+
+	if plan.MaxExpiryDays > 0 {
+		max := time.Duration(plan.MaxExpiryDays) * time.Hour * 24
+		if expiration > max {
+			if expiration != defaultURLExpiration {
+				return 0, &QuotaExceededError{Limit: QuotaExpiry, Max: plan.MaxExpiryDays}
+			}
+			expiration = max
+		}
+	}
+
+	if plan.MaxActiveLinks > 0 {
+		active, err := countActiveLinks(tx, userID)
+		if err != nil {
+			return 0, err
+		}
+		if active >= int64(plan.MaxActiveLinks) {
+			return 0, &QuotaExceededError{Limit: QuotaActiveLinks, Max: plan.MaxActiveLinks}
+		}
+	}
+
+	if plan.MaxLinksPerDay > 0 {
+		today, err := countLinksToday(tx, userID)
+		if err != nil {
+			return 0, err
+		}
+		if today >= int64(plan.MaxLinksPerDay) {
+			return 0, &QuotaExceededError{Limit: QuotaLinksPerDay, Max: plan.MaxLinksPerDay}
+		}
+	}
+
+	return expiration, nil
+}
+
+// userPlan 获取用户的套餐，ok为false表示未配置套餐，不做限制
+func (s *urlService) userPlan(db *gorm.DB, userID uint) (string, *config.PlanConfig, bool, error) {
+	if len(s.config.Quota.Plans) == 0 {
+		return "", nil, false, nil
+	}
+
+	var user model.User
+	if err := db.Select("plan").First(&user, userID).Error; err != nil {
+		return "", nil, false, fmt.Errorf("获取用户套餐失败: %v", err)
+	}
+
+	name := user.Plan
+	if name == "" {
+		name = s.config.Quota.DefaultPlan
+	}
+	plan, ok := s.config.Quota.Plans[name]
+	if !ok {
+		// 套餐已从配置中删除时按默认套餐处理，避免用户失去限制
+		name = s.config.Quota.DefaultPlan
+		if plan, ok = s.config.Quota.Plans[name]; !ok {
+			return "", nil, false, nil
+		}
+	}
+	return name, &plan, true, nil
+}
+
+// countActiveLinks 统计用户创建的未过期链接，包括团队空间中的链接
+func countActiveLinks(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	if err := db.Model(&model.URL{}).
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("统计链接数量失败: %v", err)
+	}
+	return count, nil
+}
+
+// countLinksToday 统计用户今天创建的链接，已删除的链接也计算在内
+func countLinksToday(db *gorm.DB, userID uint) (int64, error) {
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var count int64
+	if err := db.Unscoped().Model(&model.URL{}).
+		Where("user_id = ? AND created_at >= ?", userID, startOfDay).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("统计链接数量失败: %v", err)
+	}
+	return count, nil
+}
+
+// validateAlias 校验自定义短码的格式和可用性
+func validateAlias(db *gorm.DB, alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return &AliasError{Reason: "自定义短码应为3到10位字母、数字、下划线或连字符"}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return &AliasError{Reason: "该短码为系统保留，请更换"}
+	}
+
+	// 已删除的链接仍占用唯一索引
+	var count int64
+	if err := db.Unscoped().Model(&model.URL{}).
+		Where("short_code = ?", alias).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("检查短码失败: %v", err)
+	}
+	if count > 0 {
+		return &AliasError{Reason: "该短码已被使用"}
+	}
+	return nil
+}
+
+func planHasFeature(plan *config.PlanConfig, feature string) bool {
+	for _, f := range plan.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// warnUnknownFeatures 套餐中配置了不支持的功能时打印警告，这些功能不会生效
+func warnUnknownFeatures(plans map[string]config.PlanConfig) {
+	for name, plan := range plans {
+		for _, f := range plan.Features {
+			if !planFeatures[f] {
+				logrus.Warnf("套餐 %s 配置了不支持的功能 %q，已忽略", name, f)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+)
+
+// 来源类型
+const (
+	RefererDirect   = "direct"   // 没有来源，如直接输入、书签或应用内打开
+	RefererSearch   = "search"   // 搜索引擎
+	RefererSocial   = "social"   // 社交网络和聊天软件
+	RefererEmail    = "email"    // 网页版邮箱和邮件客户端
+	RefererReferral = "referral" // 其他网站
+)
+
+// RefererInfo 规范化后的来源
+type RefererInfo struct {
+	URL      string // 去掉跟踪参数和锚点后的来源地址
+	Domain   string // 小写域名，去掉 www. 和 m. 前缀；Android 应用为包名
+	Category string
+}
+
+// refererSources 已知来源的域名(包括其子域名)，末尾为 ".*" 时匹配任意顶级域名，如 google.com.hk
+// Android 应用打开链接时来源为 android-app://包名，同样按包名匹配
+var refererSources = []struct {
+	category string
+	domains  []string
+}{
+	// 网页版邮箱要排在搜索引擎之前，mail.google.com 不能归为搜索
+	{RefererEmail, []string{
+		"mail.google.com", "outlook.live.com", "outlook.office.com", "outlook.office365.com", "mail.yahoo.com",
+		"mail.qq.com", "exmail.qq.com", "mail.163.com", "mail.126.com", "mail.aliyun.com", "mail.yandex.ru",
+		"mail.proton.me", "com.google.android.gm", "com.microsoft.office.outlook",
+	}},
+	{RefererSearch, []string{
+		"google.*", "bing.com", "baidu.com", "yandex.*", "duckduckgo.com", "search.yahoo.com", "sogou.com",
+		"so.com", "sm.cn", "naver.com", "ecosia.org", "search.brave.com", "startpage.com",
+		"com.google.android.googlequicksearchbox",
+	}},
+	{RefererSocial, []string{
+		"t.co", "twitter.com", "x.com", "facebook.com", "fb.com", "messenger.com", "instagram.com",
+		"linkedin.com", "lnkd.in", "reddit.com", "pinterest.com", "tiktok.com", "youtube.com", "t.me",
+		"web.telegram.org", "whatsapp.com", "discord.com", "slack.com", "news.ycombinator.com", "threads.net",
+		"weibo.com", "weibo.cn", "t.cn", "weixin.qq.com", "zhihu.com", "douban.com", "douyin.com",
+		"xiaohongshu.com", "bilibili.com",
+		"com.twitter.android", "com.facebook.katana", "com.linkedin.android", "org.telegram.messenger",
+		"com.tencent.mm", "com.sina.weibo", "com.reddit.frontpage",
+	}},
+}
+
+// trackingParams 来源地址中的跟踪参数，统计时去掉，避免同一页面分散到多个分组；utm_ 开头的参数同样去掉
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "gbraid": true, "wbraid": true, "dclid": true, "msclkid": true,
+	"yclid": true, "twclid": true, "ttclid": true, "li_fat_id": true, "igshid": true, "mc_cid": true,
+	"mc_eid": true, "_ga": true, "_gl": true, "_hsenc": true, "_hsmi": true, "mkt_tok": true,
+	"spm": true, "share_source": true, "share_medium": true,
+}
+
+// ParseReferer 规范化来源地址，识别来源域名和类型
+func ParseReferer(referer string) RefererInfo {
+	referer = strings.TrimSpace(referer)
+	if referer == "" {
+		return RefererInfo{Category: RefererDirect}
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		// 无法解析的来源保持原样，不计入域名统计
+		return RefererInfo{URL: referer, Category: RefererReferral}
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.RawQuery = stripTrackingParams(u.RawQuery)
+	info := RefererInfo{URL: u.String(), Domain: refererHost(referer), Category: RefererReferral}
+	for _, source := range refererSources {
+		for _, domain := range source.domains {
+			if matchDomain(info.Domain, domain) {
+				info.Category = source.category
+				return info
+			}
+		}
+	}
+	return info
+}
+
+// stripTrackingParams 去掉查询字符串中的跟踪参数，其余参数保持原有顺序和编码
+func stripTrackingParams(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if name, err := url.QueryUnescape(name); err == nil {
+			name = strings.ToLower(name)
+			if trackingParams[name] || strings.HasPrefix(name, "utm_") {
+				continue
+			}
+		}
+		if param != "" {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// matchDomain 判断域名是否为指定域名或其子域名
+func matchDomain(host, domain string) bool {
+	if name, ok := strings.CutSuffix(domain, ".*"); ok {
+		// 任意顶级域名: 名称之后最多两级，如 google.com、google.com.hk
+		labels := strings.Split(host, ".")
+		for i, label := range labels {
+			if label == name && i < len(labels)-1 && len(labels)-i <= 3 {
+				return true
+			}
+		}
+		return false
+	}
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// refererHost 返回来源地址的域名，去掉 www. 和 m. 前缀；无法解析时返回空字符串
+func refererHost(referer string) string {
+	if referer == "" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "m."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	return host
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"shorturl/config"
+	"shorturl/internal/model"
+)
+
+const defaultReportsPerHour = 5
+
+// ErrReportRateLimited 同一IP提交举报过于频繁
+var ErrReportRateLimited = errors.New("举报过于频繁，请稍后再试")
+
+// 处置举报时对链接执行的操作
+const (
+	ReportActionDismiss = "dismiss" // 驳回举报，链接保持不变
+	ReportActionDisable = "disable" // 停用链接
+	ReportActionDelete  = "delete"  // 删除链接
+)
+
+// ReportFilter 举报查询条件，零值字段不参与过滤
+type ReportFilter struct {
+	Status    string
+	ShortCode string
+	Page      int
+	PageSize  int
+}
+
+// ReportSummary 按链接汇总的举报数量
+type ReportSummary struct {
+	ShortCode      string    `json:"short_code"`
+	OriginalURL    string    `json:"original_url"`
+	Disabled       bool      `json:"disabled"`
+	Total          int64     `json:"total"`
+	Pending        int64     `json:"pending"`
+	LastReportedAt time.Time `json:"last_reported_at"`
+}
+
+// ReportService 违规举报服务接口
+type ReportService interface {
+	SubmitReport(ctx context.Context, report *model.AbuseReport) error
+	ListReports(ctx context.Context, filter ReportFilter) ([]model.AbuseReport, int64, error)
+	SummarizeReports(ctx context.Context, pendingOnly bool) ([]ReportSummary, error)
+	ResolveReport(ctx context.Context, id uint, action, note string, moderatorID uint) (int64, error)
+}
+
+type reportService struct {
+	db         *gorm.DB
+	config     *config.Config
+	urlService URLService
+}
+
+// NewReportService 创建违规举报服务
+func NewReportService(db *gorm.DB, cfg *config.Config, urlService URLService) ReportService {
+	return &reportService{
+		db:         db,
+		config:     cfg,
+		urlService: urlService,
+	}
+}
+
+// SubmitReport 提交举报，按IP限制频率，同一IP对同一链接只保留一条待处理的举报
+func (s *reportService) SubmitReport(ctx context.Context, report *model.AbuseReport) error {
+	if !model.ValidReportCategory(report.Category) {
+		return fmt.Errorf("无效的举报类型: %s", report.Category)
+	}
+	report.Description = strings.TrimSpace(report.Description)
+	report.ReporterEmail = strings.TrimSpace(report.ReporterEmail)
+
+	var url model.URL
+	if err := s.db.WithContext(ctx).Select("id").
+		Where("short_code = ?", report.ShortCode).
+		First(&url).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("短链接不存在")
+		}
+		return fmt.Errorf("查询短链接失败: %v", err)
+	}
+
+	limit := s.config.Moderation.ReportsPerHour
+	if limit <= 0 {
+		limit = defaultReportsPerHour
+	}
+	var recent int64
+	if err := s.db.WithContext(ctx).Model(&model.AbuseReport{}).
+		Where("reporter_ip = ? AND created_at > ?", report.ReporterIP, time.Now().Add(-time.Hour)).
+		Count(&recent).Error; err != nil {
+		return fmt.Errorf("查询举报记录失败: %v", err)
+	}
+	if recent >= int64(limit) {
+		return ErrReportRateLimited
+	}
+
+	var duplicate int64
+	if err := s.db.WithContext(ctx).Model(&model.AbuseReport{}).
+		Where("reporter_ip = ? AND short_code = ? AND status = ?", report.ReporterIP, report.ShortCode, model.ReportStatusPending).
+		Count(&duplicate).Error; err != nil {
+		return fmt.Errorf("查询举报记录失败: %v", err)
+	}
+	if duplicate > 0 {
+		return fmt.Errorf("您已举报过该链接，我们会尽快处理")
+	}
+
+	report.ID = 0
+	report.Status = model.ReportStatusPending
+	if err := s.db.WithContext(ctx).Create(report).Error; err != nil {
+		return fmt.Errorf("提交举报失败: %v", err)
+	}
+	return nil
+}
+
+// ListReports 分页查询举报，按时间倒序
+func (s *reportService) ListReports(ctx context.Context, filter ReportFilter) ([]model.AbuseReport, int64, error) {
+	query := s.db.WithContext(ctx).Model(&model.AbuseReport{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ShortCode != "" {
+		query = query.Where("short_code = ?", filter.ShortCode)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计举报失败: %v", err)
+	}
+
+	page, pageSize := filter.Page, filter.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	var reports []model.AbuseReport
+	if err := query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&reports).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询举报失败: %v", err)
+	}
+	return reports, total, nil
+}
+
+// SummarizeReports 按链接汇总举报数量，待处理数量多的排在前面
+func (s *reportService) SummarizeReports(ctx context.Context, pendingOnly bool) ([]ReportSummary, error) {
+	var rows []struct {
+		ReportSummary
+		LatestID uint
+	}
+	// SQLite 对聚合后的时间列返回字符串，这里取最新举报的ID，再单独查询时间
+	query := s.db.WithContext(ctx).Model(&model.AbuseReport{}).
+		Select("abuse_reports.short_code, urls.original_url, urls.disabled, COUNT(*) AS total, "+
+			"SUM(CASE WHEN abuse_reports.status = ? THEN 1 ELSE 0 END) AS pending, "+
+			"MAX(abuse_reports.id) AS latest_id", model.ReportStatusPending).
+		Joins("LEFT JOIN urls ON urls.short_code = abuse_reports.short_code AND urls.deleted_at IS NULL").
+		Group("abuse_reports.short_code, urls.original_url, urls.disabled")
+	if pendingOnly {
+		query = query.Having("SUM(CASE WHEN abuse_reports.status = ? THEN 1 ELSE 0 END) > 0", model.ReportStatusPending)
+	}
+	if err := query.Order("pending DESC, total DESC").Limit(500).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("汇总举报失败: %v", err)
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.LatestID)
+	}
+	var latest []model.AbuseReport
+	if len(ids) > 0 {
+		if err := s.db.WithContext(ctx).Select("id, created_at").Where("id IN ?", ids).Find(&latest).Error; err != nil {
+			return nil, fmt.Errorf("汇总举报失败: %v", err)
+		}
+	}
+	reportedAt := make(map[uint]time.Time, len(latest))
+	for _, r := range latest {
+		reportedAt[r.ID] = r.CreatedAt
+	}
+
+	summaries := make([]ReportSummary, 0, len(rows))
+	for _, row := range rows {
+		row.LastReportedAt = reportedAt[row.LatestID]
+		summaries = append(summaries, row.ReportSummary)
+	}
+	return summaries, nil
+}
+
+// ResolveReport 处理举报并一并处置被举报的链接
+// 停用或删除链接时，该链接所有待处理的举报一起标记为已处置；驳回只影响这一条举报
+// 返回被更新的举报数量
+func (s *reportService) ResolveReport(ctx context.Context, id uint, action, note string, moderatorID uint) (int64, error) {
+	var report model.AbuseReport
+	if err := s.db.WithContext(ctx).First(&report, id).Error; err != nil {
+		return 0, fmt.Errorf("举报不存在")
+	}
+	if report.Status != model.ReportStatusPending {
+		return 0, fmt.Errorf("举报已处理")
+	}
+
+	status := model.ReportStatusActioned
+	switch action {
+	case ReportActionDismiss:
+		status = model.ReportStatusDismissed
+	case ReportActionDisable:
+		reason := note
+		if reason == "" {
+			reason = "收到举报: " + report.Category
+		}
+		if err := s.urlService.DisableURL(ctx, report.ShortCode, reason, moderatorID); err != nil {
+			return 0, err
+		}
+	case ReportActionDelete:
+		if err := s.urlService.DeleteURL(ctx, report.ShortCode); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("无效的处理方式: %s", action)
+	}
+
+	query := s.db.WithContext(ctx).Model(&model.AbuseReport{}).Where("status = ?", model.ReportStatusPending)
+	if status == model.ReportStatusDismissed {
+		query = query.Where("id = ?", report.ID)
+	} else {
+		query = query.Where("short_code = ?", report.ShortCode)
+	}
+	result := query.Updates(map[string]interface{}{
+		"status":      status,
+		"resolution":  note,
+		"resolved_by": moderatorID,
+		"resolved_at": time.Now(),
+	})
+	if result.Error != nil {
+		return 0, fmt.Errorf("更新举报状态失败: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
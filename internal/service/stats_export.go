@@ -0,0 +1,317 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"shorturl/internal/model"
+)
+
+// 统计数据的导出格式
+const (
+	ExportCSV  = "csv"
+	ExportJSON = "json"
+	ExportXLSX = "xlsx"
+)
+
+const (
+	exportBatchSize  = 1000 // 每次读取的访问明细条数
+	exportTimeFormat = "2006-01-02 15:04:05"
+	utf8BOM          = "\xEF\xBB\xBF"
+)
+
+// ExportOptions 统计导出的格式和内容
+type ExportOptions struct {
+	Format        string
+	IncludeVisits bool // 包含时间范围内的访问明细，超过保留天数已删除的明细无法导出
+	BOM           bool // CSV 以 UTF-8 BOM 开头，Excel 据此识别编码，否则中文会显示为乱码
+}
+
+// ExportContentType 返回导出格式的 Content-Type，不支持的格式返回空字符串
+func ExportContentType(format string) string {
+	switch format {
+	case ExportCSV:
+		return "text/csv; charset=utf-8"
+	case ExportJSON:
+		return "application/json; charset=utf-8"
+	case ExportXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return ""
+}
+
+// statsTableWriter 以表格形式写入导出数据，CSV 中各表格以空行分隔，XLSX 中每个表格一个工作表
+// 单元格的值为 string、int64、float64 或 bool
+type statsTableWriter interface {
+	table(name string, header ...string) error
+	row(values ...interface{}) error
+	close() error
+}
+
+// statsBreakdown 导出的分布统计: 表格名称、维度列名和数据
+type statsBreakdown struct {
+	name   string
+	column string
+	rows   []model.Breakdown
+}
+
+func exportBreakdowns(stats *model.Stats) []statsBreakdown {
+	referers := make([]model.Breakdown, 0, len(stats.TopReferers))
+	for _, ref := range stats.TopReferers {
+		referers = append(referers, model.Breakdown{Name: ref.URL, Count: ref.Count})
+	}
+	userAgents := make([]model.Breakdown, 0, len(stats.TopUserAgents))
+	for _, ua := range stats.TopUserAgents {
+		userAgents = append(userAgents, model.Breakdown{Name: ua.Name, Count: ua.Count})
+	}
+
+	return []statsBreakdown{
+		{"来源", "来源地址", referers},
+		{"来源域名", "来源域名", stats.RefererDomains},
+		{"来源类型", "来源类型", stats.RefererCategories},
+		{"User-Agent", "User-Agent", userAgents},
+		{"浏览器", "浏览器", stats.Browsers},
+		{"浏览器版本", "浏览器版本", stats.BrowserVersions},
+		{"操作系统", "操作系统", stats.OperatingSystems},
+		{"设备", "设备类型", stats.Devices},
+		{"国家", "国家或地区", stats.Countries},
+		{"地区", "地区", stats.Regions},
+		{"城市", "城市", stats.Cities},
+		{"机器人识别原因", "识别原因", stats.Bots.Reasons},
+		{"机器人名称", "名称", stats.Bots.Agents},
+	}
+}
+
+var visitExportHeader = []string{
+	"时间", "IP", "来源地址", "来源域名", "来源类型", "浏览器", "浏览器版本", "操作系统", "设备类型",
+	"国家或地区", "地区", "城市", "User-Agent", "机器人", "识别原因", "代表访问次数",
+}
+
+func visitExportRow(v *model.URLVisit, loc *time.Location) []interface{} {
+	return []interface{}{
+		v.CreatedAt.In(loc).Format(exportTimeFormat), v.IP, v.RefererURL, v.RefererDomain, v.RefererCategory,
+		v.Browser, v.BrowserVersion, v.OS, v.Device, v.Country, v.Region, v.City, v.UserAgent,
+		v.Bot, v.BotReason, v.Weight,
+	}
+}
+
+// ExportStats 按格式将短链接的统计数据写入 w，可选包含时间范围内的访问明细
+// 访问明细分批读取并直接写出，不会全部加载到内存；写出过程中出错时已写出的内容无法撤回
+func (s *urlService) ExportStats(ctx context.Context, shortCode string, r StatsRange, opts ExportOptions, w io.Writer) error {
+	var url model.URL
+	if err := s.db.WithContext(ctx).Where("short_code = ?", shortCode).First(&url).Error; err != nil {
+		return fmt.Errorf("获取短链接信息失败: %v", err)
+	}
+	stats := s.GetLinksStats(ctx, []*model.URL{&url}, r)
+
+	bw := bufio.NewWriter(w)
+	var err error
+	switch opts.Format {
+	case ExportJSON:
+		err = s.exportJSON(ctx, bw, &url, stats, r, opts.IncludeVisits)
+	case ExportCSV:
+		if opts.BOM {
+			if _, err := bw.WriteString(utf8BOM); err != nil {
+				return fmt.Errorf("写入导出数据失败: %v", err)
+			}
+		}
+		err = s.exportTables(ctx, &csvTableWriter{w: csv.NewWriter(bw)}, &url, stats, r, opts.IncludeVisits)
+	case ExportXLSX:
+		err = s.exportTables(ctx, newXLSXWriter(bw), &url, stats, r, opts.IncludeVisits)
+	default:
+		return fmt.Errorf("不支持的导出格式: %s", opts.Format)
+	}
+	if err != nil {
+		return fmt.Errorf("写入导出数据失败: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("写入导出数据失败: %v", err)
+	}
+	return nil
+}
+
+// exportTables 依次写入概要、访问趋势、各维度分布和访问明细
+func (s *urlService) exportTables(ctx context.Context, tw statsTableWriter, url *model.URL, stats *model.Stats, r StatsRange, includeVisits bool) error {
+	if err := tw.table("概要", "项目", "值"); err != nil {
+		return err
+	}
+	summary := [][]interface{}{
+		{"短链接", url.ShortCode},
+		{"原始链接", url.OriginalURL},
+		{"开始时间", stats.From.In(r.Location).Format(exportTimeFormat)},
+		{"结束时间", stats.To.In(r.Location).Format(exportTimeFormat)},
+		{"时区", stats.Timezone},
+		{"时间粒度", stats.Interval},
+		{"总访问量", stats.TotalVisits},
+		{"独立访客", stats.UniqueVisitors},
+		{"时间段访问量", stats.RangeVisits},
+		{"时间段独立访客", stats.RangeUniques},
+		{"机器人访问", stats.Bots.Visits},
+		{"抽样记录", stats.Sampled},
+	}
+	for _, row := range summary {
+		if err := tw.row(row...); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.table("访问趋势", "时间", "访问量", "独立访客"); err != nil {
+		return err
+	}
+	for _, day := range stats.DailyVisits {
+		if err := tw.row(day.Date, day.Count, day.Uniques); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range exportBreakdowns(stats) {
+		if err := tw.table(b.name, b.column, "访问量"); err != nil {
+			return err
+		}
+		for _, item := range b.rows {
+			if err := tw.row(item.Name, item.Count); err != nil {
+				return err
+			}
+		}
+	}
+
+	if includeVisits {
+		if err := tw.table("访问明细", visitExportHeader...); err != nil {
+			return err
+		}
+		err := s.eachVisit(ctx, url.ID, r, func(v *model.URLVisit) error {
+			return tw.row(visitExportRow(v, r.Location)...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.close()
+}
+
+// exportJSON 写入 {"short_code", "original_url", "exported_at", "stats", "visits"}，访问明细逐条写出
+func (s *urlService) exportJSON(ctx context.Context, w io.Writer, url *model.URL, stats *model.Stats, r StatsRange, includeVisits bool) error {
+	head, err := json.Marshal(map[string]interface{}{
+		"short_code":   url.ShortCode,
+		"original_url": url.OriginalURL,
+		"exported_at":  time.Now().In(r.Location),
+		"stats":        stats,
+	})
+	if err != nil {
+		return err
+	}
+	if !includeVisits {
+		_, err := w.Write(append(head, '\n'))
+		return err
+	}
+
+	// 去掉结尾的 }，在其后追加 visits 数组
+	if _, err := w.Write(head[:len(head)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"visits":[`); err != nil {
+		return err
+	}
+	first := true
+	err = s.eachVisit(ctx, url.ID, r, func(v *model.URLVisit) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// eachVisit 按ID顺序分批读取链接在时间范围内的访问明细，包括机器人访问
+func (s *urlService) eachVisit(ctx context.Context, urlID uint, r StatsRange, fn func(v *model.URLVisit) error) error {
+	var batch []*model.URLVisit
+	var fnErr error
+	// SQLite 以文本保存时间，与 newVisitScope 一样按服务器时区比较
+	result := s.db.WithContext(ctx).
+		Where("url_id = ? AND created_at >= ? AND created_at < ?", urlID, r.From.In(time.Local), r.To.In(time.Local)).
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, v := range batch {
+				if fnErr = fn(v); fnErr != nil {
+					return fnErr
+				}
+			}
+			return nil
+		})
+	if fnErr != nil {
+		return fnErr
+	}
+	if result.Error != nil {
+		return fmt.Errorf("查询访问明细失败: %v", result.Error)
+	}
+	return nil
+}
+
+// csvTableWriter 各表格以空行分隔，首行为表头
+type csvTableWriter struct {
+	w      *csv.Writer
+	tables int
+}
+
+func (t *csvTableWriter) table(_ string, header ...string) error {
+	if t.tables > 0 {
+		if err := t.w.Write(nil); err != nil {
+			return err
+		}
+	}
+	t.tables++
+	return t.w.Write(header)
+}
+
+func (t *csvTableWriter) row(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			record[i] = strconv.FormatBool(v)
+		case string:
+			record[i] = csvSafe(v)
+		default:
+			return errors.New("不支持的单元格类型")
+		}
+	}
+	return t.w.Write(record)
+}
+
+func (t *csvTableWriter) close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// csvSafe 来源地址、User-Agent 等由访问者控制，以 = + - @ 开头时在电子表格中会被当作公式执行，加单引号前缀
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
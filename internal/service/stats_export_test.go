@@ -0,0 +1,30 @@
+package service
+
+import "testing"
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "空字符串", in: "", want: ""},
+		{name: "普通文本", in: "https://example.com/", want: "https://example.com/"},
+		{name: "等号开头的公式", in: `=HYPERLINK("http://evil","x")`, want: `'=HYPERLINK("http://evil","x")`},
+		{name: "加号开头", in: "+1+1", want: "'+1+1"},
+		{name: "减号开头", in: "-2+3", want: "'-2+3"},
+		{name: "at 开头", in: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "制表符开头", in: "\t=1", want: "'\t=1"},
+		{name: "回车开头", in: "\r=1", want: "'\r=1"},
+		{name: "中间的等号不处理", in: "a=b", want: "a=b"},
+		{name: "中文", in: "微信", want: "微信"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvSafe(tt.in); got != tt.want {
+				t.Fatalf("csvSafe(%q) = %q，期望 %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
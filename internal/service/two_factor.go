@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"shorturl/internal/model"
+)
+
+const (
+	totpPeriod         = 30              // TOTP时间步长(秒)
+	totpDigits         = 6               // 验证码位数
+	totpSkew           = 1               // 允许前后偏差的时间步数
+	totpSecretBytes    = 20              // 密钥长度，与HMAC-SHA1输出一致
+	challengeTTL       = time.Minute * 5 // 两步验证挑战令牌有效期
+	recoveryCodeCount  = 10              // 每次生成的恢复码数量
+	defaultTOTPIssuer  = "ShortURL"
+	challengeTokenType = "2fa_challenge"
+)
+
+// TwoFactorSetup 绑定身份验证器所需的信息
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+	QRCode     string `json:"qr_code"` // PNG格式的data URI
+}
+
+// VerifyTwoFactor 校验挑战令牌和验证码(或恢复码)后签发令牌对
+func (s *authService) VerifyTwoFactor(ctx context.Context, challengeToken, code string, client ClientInfo) (*TokenPair, error) {
+	token, err := jwt.Parse(challengeToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("无效的签名方法: %v", token.Header["alg"])
+		}
+		return []byte(s.config.Auth.SecretKey), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("挑战令牌无效或已过期: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["typ"] != challengeTokenType {
+		return nil, fmt.Errorf("无效的挑战令牌")
+	}
+
+	userID, _ := claims["user_id"].(float64)
+	version, _ := claims["ver"].(float64)
+
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, uint(userID)).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	if int(version) != user.TokenVersion || !user.TOTPEnabled {
+		return nil, fmt.Errorf("挑战令牌已失效")
+	}
+
+	// 验证码错误同样计入登录失败次数，防止在挑战令牌有效期内暴力猜测
+	if err := s.checkLoginAllowed(ctx, user.Username, client.IP); err != nil {
+		return nil, err
+	}
+	if err := s.checkSecondFactor(ctx, &user, code, true); err != nil {
+		s.recordLoginFailure(ctx, user.Username, client.IP)
+		return nil, err
+	}
+
+	s.clearAccountFailures(ctx, user.Username)
+	s.db.Model(&user).UpdateColumn("last_login_at", time.Now())
+
+	return s.createSession(ctx, &user, client)
+}
+
+// SetupTwoFactor 生成新的待确认密钥，确认前不会影响登录
+func (s *authService) SetupTwoFactor(ctx context.Context, userID uint) (*TwoFactorSetup, error) {
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("已启用两步验证")
+	}
+
+	buf := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %v", err)
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+
+	if err := s.db.WithContext(ctx).Model(&user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("保存密钥失败: %v", err)
+	}
+
+	issuer := s.config.Auth.TOTPIssuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	otpauthURL := (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + user.Username,
+		RawQuery: params.Encode(),
+	}).String()
+
+	png, err := qrcode.Encode(otpauthURL, qrcode.Medium, 256)
+	if err != nil {
+		return nil, fmt.Errorf("生成二维码失败: %v", err)
+	}
+
+	return &TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURL: otpauthURL,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// EnableTwoFactor 校验验证码确认绑定，并返回一组新的恢复码
+func (s *authService) EnableTwoFactor(ctx context.Context, userID uint, code string) ([]string, error) {
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("已启用两步验证")
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("请先生成两步验证密钥")
+	}
+
+	if err := s.checkSecondFactor(ctx, &user, code, false); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("totp_enabled", true).Error; err != nil {
+			return fmt.Errorf("启用两步验证失败: %v", err)
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor 校验密码和验证码后关闭两步验证
+// 单点登录账户没有本地密码，只校验验证码或恢复码，password 被忽略
+func (s *authService) DisableTwoFactor(ctx context.Context, userID uint, password, code string) error {
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return fmt.Errorf("用户不存在")
+	}
+	if !user.TOTPEnabled {
+		return fmt.Errorf("未启用两步验证")
+	}
+
+	if user.AuthProvider == "local" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+			return fmt.Errorf("密码错误")
+		}
+	}
+	if err := s.checkSecondFactor(ctx, &user, code, true); err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return fmt.Errorf("关闭两步验证失败: %v", err)
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("删除恢复码失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// RegenerateRecoveryCodes 作废旧恢复码并生成新的一组
+func (s *authService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+	if !user.TOTPEnabled {
+		return nil, fmt.Errorf("未启用两步验证")
+	}
+	if err := s.checkSecondFactor(ctx, &user, code, false); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// TwoFactorSetupRequired 判断用户是否因管理员策略必须先启用两步验证
+func (s *authService) TwoFactorSetupRequired(user *model.User) bool {
+	return s.config.Auth.RequireAdmin2FA && user.IsAdmin && !user.TOTPEnabled
+}
+
+// checkSecondFactor 校验TOTP验证码，allowRecovery为true时也接受恢复码
+func (s *authService) checkSecondFactor(ctx context.Context, user *model.User, code string, allowRecovery bool) error {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	if len(code) == totpDigits {
+		step, ok := validateTOTP(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return fmt.Errorf("验证码错误")
+		}
+
+		// 条件更新时间步，同一验证码只能使用一次
+		result := s.db.WithContext(ctx).Model(&model.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			UpdateColumn("totp_last_step", step)
+		if result.Error != nil {
+			return fmt.Errorf("更新验证状态失败: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("验证码已使用")
+		}
+		return nil
+	}
+
+	if !allowRecovery {
+		return fmt.Errorf("验证码错误")
+	}
+
+	result := s.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("校验恢复码失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("验证码错误")
+	}
+	return nil
+}
+
+// signChallengeToken 签发两步验证挑战令牌
+func (s *authService) signChallengeToken(user *model.User) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":     challengeTokenType,
+		"user_id": user.ID,
+		"ver":     user.TokenVersion,
+		"exp":     time.Now().Add(challengeTTL).Unix(),
+	})
+
+	tokenString, err := token.SignedString([]byte(s.config.Auth.SecretKey))
+	if err != nil {
+		return "", fmt.Errorf("生成挑战令牌失败: %v", err)
+	}
+	return tokenString, nil
+}
+
+// replaceRecoveryCodes 删除用户现有恢复码并生成新的一组，仅保存摘要
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("删除恢复码失败: %v", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]model.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("生成恢复码失败: %v", err)
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		records = append(records, model.RecoveryCode{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, fmt.Errorf("保存恢复码失败: %v", err)
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode 忽略恢复码中的大小写和分隔符
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
+
+// validateTOTP 按RFC 6238校验验证码，返回匹配的时间步
+func validateTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil || len(key) == 0 {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		step := current + offset
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode 计算指定时间步的验证码 (RFC 4226 动态截断)
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
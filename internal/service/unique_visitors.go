@@ -0,0 +1,363 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"shorturl/config"
+	redisClient "shorturl/internal/cache"
+	"shorturl/internal/model"
+)
+
+const (
+	uniqueVisitorPrefix = "uv:"
+	// uniqueDailyRetention 每日独立访客数据的保留时间，全部时间的数据一直保留
+	uniqueDailyRetention = time.Hour * 24 * 90
+	uniqueDayFormat      = "2006-01-02"
+)
+
+// uniqueVisitors 按链接和日期估算独立访客数
+// 访客以IP和User-Agent的带密钥哈希标识，只写入HyperLogLog，不保存可还原的访客信息
+type uniqueVisitors interface {
+	add(ctx context.Context, urlID uint, at time.Time, info VisitInfo)
+	// count 估算多个链接在若干天(YYYY-MM-DD)内的独立访客数(并集)，未指定日期时为全部时间
+	count(ctx context.Context, urlIDs []uint, days ...string) int64
+	// countEach 分别估算每组日期内的独立访客数，结果与 dayGroups 一一对应，用于一次查询整个时间序列
+	countEach(ctx context.Context, links LinkSet, dayGroups [][]string) []int64
+	// flush 将内存中的数据写入数据库，使用Redis时无需处理
+	flush(ctx context.Context) error
+	// erase 删除链接的全部独立访客数据
+	erase(ctx context.Context, urlID uint) error
+}
+
+// newUniqueVisitors 启用Redis时使用Redis的HyperLogLog，多个实例共享；否则在进程内计数并定期写入数据库
+func newUniqueVisitors(db *gorm.DB, redis redisClient.RedisClient, cfg *config.Config) uniqueVisitors {
+	key := sha256.Sum256([]byte("unique-visitor:" + cfg.Auth.SecretKey))
+	if redis.Enabled() {
+		return &redisUniqueVisitors{redis: redis, key: key[:]}
+	}
+	return &localUniqueVisitors{
+		db:      db,
+		key:     key[:],
+		pending: make(map[sketchKey]*hyperLogLog),
+	}
+}
+
+// visitorHash 计算访客标识，同一访客在所有链接上的标识相同
+func visitorHash(key []byte, info VisitInfo) uint64 {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(info.IP))
+	mac.Write([]byte{0})
+	mac.Write([]byte(info.UserAgent))
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// redisUniqueVisitors 使用Redis的 PFADD/PFCOUNT，每个链接一个全部时间的键和每天一个键
+type redisUniqueVisitors struct {
+	redis redisClient.RedisClient
+	key   []byte
+}
+
+func uniqueVisitorKey(urlID uint, day string) string {
+	if day == "" {
+		return uniqueVisitorPrefix + strconv.FormatUint(uint64(urlID), 10)
+	}
+	return fmt.Sprintf("%s%d:%s", uniqueVisitorPrefix, urlID, day)
+}
+
+func (u *redisUniqueVisitors) add(ctx context.Context, urlID uint, at time.Time, info VisitInfo) {
+	member := strconv.FormatUint(visitorHash(u.key, info), 16)
+	if err := u.redis.PFAdd(ctx, uniqueVisitorKey(urlID, ""), 0, member); err != nil {
+		logrus.Debugf("记录独立访客失败: %v", err)
+		return
+	}
+	if err := u.redis.PFAdd(ctx, uniqueVisitorKey(urlID, at.Format(uniqueDayFormat)), uniqueDailyRetention, member); err != nil {
+		logrus.Debugf("记录每日独立访客失败: %v", err)
+	}
+}
+
+func (u *redisUniqueVisitors) count(ctx context.Context, urlIDs []uint, days ...string) int64 {
+	if len(days) == 0 {
+		days = []string{""}
+	}
+	return u.countEach(ctx, LinkSet{IDs: urlIDs}, [][]string{days})[0]
+}
+
+func (u *redisUniqueVisitors) countEach(ctx context.Context, links LinkSet, dayGroups [][]string) []int64 {
+	counts := make([]int64, len(dayGroups))
+	if links.empty() || len(dayGroups) == 0 {
+		return counts
+	}
+	// 每个链接每天一个键，须取出全部链接ID
+	urlIDs, err := links.ids(ctx)
+	if err != nil {
+		logrus.Warnf("查询独立访客数失败: %v", err)
+		return counts
+	}
+	keySets := make([][]string, len(dayGroups))
+	for i, days := range dayGroups {
+		for _, id := range urlIDs {
+			for _, day := range days {
+				keySets[i] = append(keySets[i], uniqueVisitorKey(id, day))
+			}
+		}
+	}
+	// 没有日期的组不查询，PFCOUNT 至少需要一个键
+	var query [][]string
+	for _, keys := range keySets {
+		if len(keys) > 0 {
+			query = append(query, keys)
+		}
+	}
+	if len(query) == 0 {
+		return counts
+	}
+	result, err := u.redis.PFCountEach(ctx, query)
+	if err != nil {
+		logrus.Warnf("查询独立访客数失败: %v", err)
+		return counts
+	}
+	for i, keys := range keySets {
+		if len(keys) > 0 {
+			counts[i], result = result[0], result[1:]
+		}
+	}
+	return counts
+}
+
+func (u *redisUniqueVisitors) flush(context.Context) error {
+	return nil
+}
+
+func (u *redisUniqueVisitors) erase(ctx context.Context, urlID uint) error {
+	// 每日的键在保留时间后自动过期，只需删除保留时间内的键
+	now := time.Now()
+	keys := []string{uniqueVisitorKey(urlID, "")}
+	for d := time.Duration(0); d <= uniqueDailyRetention; d += time.Hour * 24 {
+		keys = append(keys, uniqueVisitorKey(urlID, now.Add(-d).Format(uniqueDayFormat)))
+	}
+	return u.redis.Del(ctx, keys...)
+}
+
+type sketchKey struct {
+	urlID uint
+	day   string
+}
+
+// localUniqueVisitors 进程内的HyperLogLog，随访问次数一起定期合并到 visitor_sketches 表
+// 合并取寄存器最大值，重复合并不影响结果
+type localUniqueVisitors struct {
+	db  *gorm.DB
+	key []byte
+
+	mu       sync.Mutex
+	pending  map[sketchKey]*hyperLogLog // 尚未写入数据库
+	flushing map[sketchKey]*hyperLogLog // 正在写入数据库，查询时同样计入
+	flushMu  sync.Mutex                 // 同一时间只进行一次写入
+}
+
+func (u *localUniqueVisitors) add(_ context.Context, urlID uint, at time.Time, info VisitInfo) {
+	hash := visitorHash(u.key, info)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, k := range []sketchKey{{urlID, ""}, {urlID, at.Format(uniqueDayFormat)}} {
+		h, ok := u.pending[k]
+		if !ok {
+			h = newHyperLogLog()
+			u.pending[k] = h
+		}
+		h.add(hash)
+	}
+}
+
+func (u *localUniqueVisitors) count(ctx context.Context, urlIDs []uint, days ...string) int64 {
+	if len(days) == 0 {
+		days = []string{""}
+	}
+	return u.countEach(ctx, LinkSet{IDs: urlIDs}, [][]string{days})[0]
+}
+
+// countEach 一次读取所有日期的数据，先按日期合并各链接，再按组合并各日期
+func (u *localUniqueVisitors) countEach(ctx context.Context, links LinkSet, dayGroups [][]string) []int64 {
+	counts := make([]int64, len(dayGroups))
+	if links.empty() {
+		return counts
+	}
+	byDay := make(map[string]*hyperLogLog)
+	for _, days := range dayGroups {
+		for _, day := range days {
+			byDay[day] = newHyperLogLog()
+		}
+	}
+	if len(byDay) == 0 {
+		return counts
+	}
+	days := make([]string, 0, len(byDay))
+	for day := range byDay {
+		days = append(days, day)
+	}
+
+	var batch []model.VisitorSketch
+	err := u.db.WithContext(ctx).Where("url_id IN ? AND day IN ?", links.arg(), days).
+		FindInBatches(&batch, 500, func(*gorm.DB, int) error {
+			for _, sketch := range batch {
+				if h, err := unmarshalHyperLogLog(sketch.Data); err == nil {
+					byDay[sketch.Day].merge(h)
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		logrus.Warnf("查询独立访客数失败: %v", err)
+	}
+
+	for k, h := range u.pendingSketches(ctx, links, days) {
+		byDay[k.day].merge(h)
+	}
+
+	for i, days := range dayGroups {
+		merged := newHyperLogLog()
+		for _, day := range days {
+			merged.merge(byDay[day])
+		}
+		counts[i] = merged.count()
+	}
+	return counts
+}
+
+// pendingSketches 返回 links 在指定日期尚未写入数据库的数据
+// 使用子查询时先找出最近有访问的链接，再查询其中属于 links 的部分
+func (u *localUniqueVisitors) pendingSketches(ctx context.Context, links LinkSet, days []string) map[sketchKey]*hyperLogLog {
+	urlIDs := links.IDs
+	if links.Query != nil {
+		inDays := make(map[string]bool, len(days))
+		for _, day := range days {
+			inDays[day] = true
+		}
+		seen := make(map[uint]bool)
+		var candidates []uint
+		u.mu.Lock()
+		for _, m := range []map[sketchKey]*hyperLogLog{u.pending, u.flushing} {
+			for k := range m {
+				if inDays[k.day] && !seen[k.urlID] {
+					seen[k.urlID] = true
+					candidates = append(candidates, k.urlID)
+				}
+			}
+		}
+		u.mu.Unlock()
+
+		urlIDs = nil
+		if len(candidates) > 0 {
+			err := u.db.WithContext(ctx).Model(&model.URL{}).
+				Where("id IN ? AND id IN ?", candidates, links.arg()).Pluck("id", &urlIDs).Error
+			if err != nil {
+				logrus.Warnf("查询独立访客数失败: %v", err)
+			}
+		}
+	}
+
+	result := make(map[sketchKey]*hyperLogLog)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, id := range urlIDs {
+		for _, day := range days {
+			k := sketchKey{id, day}
+			for _, m := range []map[sketchKey]*hyperLogLog{u.pending, u.flushing} {
+				if h, ok := m[k]; ok {
+					if result[k] == nil {
+						result[k] = newHyperLogLog()
+					}
+					result[k].merge(h)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// flush 将内存中的数据合并到数据库，并删除超过保留时间的每日数据
+func (u *localUniqueVisitors) flush(ctx context.Context) error {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	u.mu.Lock()
+	u.flushing, u.pending = u.pending, make(map[sketchKey]*hyperLogLog)
+	flushing := u.flushing
+	u.mu.Unlock()
+
+	var failed int
+	for k, h := range flushing {
+		if err := u.save(ctx, k, h); err != nil {
+			logrus.Debugf("写入独立访客数据失败: %v", err)
+			failed++
+			// 放回待写入数据，下次重试
+			u.mu.Lock()
+			if p, ok := u.pending[k]; ok {
+				p.merge(h)
+			} else {
+				u.pending[k] = h
+			}
+			u.mu.Unlock()
+		}
+	}
+
+	u.mu.Lock()
+	u.flushing = nil
+	u.mu.Unlock()
+
+	cutoff := time.Now().Add(-uniqueDailyRetention).Format(uniqueDayFormat)
+	if err := u.db.WithContext(ctx).Where("day <> '' AND day < ?", cutoff).Delete(&model.VisitorSketch{}).Error; err != nil {
+		logrus.Warnf("清理过期的独立访客数据失败: %v", err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("写入独立访客数据失败: %d 项", failed)
+	}
+	return nil
+}
+
+func (u *localUniqueVisitors) erase(ctx context.Context, urlID uint) error {
+	// 等待进行中的写入完成，避免删除后又写入
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	u.mu.Lock()
+	for k := range u.pending {
+		if k.urlID == urlID {
+			delete(u.pending, k)
+		}
+	}
+	u.mu.Unlock()
+
+	return u.db.WithContext(ctx).Where("url_id = ?", urlID).Delete(&model.VisitorSketch{}).Error
+}
+
+func (u *localUniqueVisitors) save(ctx context.Context, k sketchKey, h *hyperLogLog) error {
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sketch model.VisitorSketch
+		if err := tx.Where("url_id = ? AND day = ?", k.urlID, k.day).Limit(1).Find(&sketch).Error; err != nil {
+			return err
+		}
+		if sketch.ID == 0 {
+			return tx.Create(&model.VisitorSketch{URLID: k.urlID, Day: k.day, Data: h.marshal()}).Error
+		}
+
+		merged, err := unmarshalHyperLogLog(sketch.Data)
+		if err != nil {
+			// 数据损坏时以本次数据覆盖
+			merged = newHyperLogLog()
+		}
+		merged.merge(h)
+		return tx.Model(&sketch).Update("data", merged.marshal()).Error
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"math/rand"
 	"strings"
 	"sync"
@@ -16,36 +17,86 @@ import (
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"shorturl/config"
 	redisClient "shorturl/internal/cache" // 重命名Redis客户端导入
+	"shorturl/internal/geoip"
 	"shorturl/internal/model"
 )
 
 const (
 	urlCachePrefix   = "url:"
 	statsCachePrefix = "stats:"
-	urlTTL           = time.Hour * 24
-	statsTTL         = time.Hour
-	syncInterval     = time.Minute * 10
-	localCacheTTL    = time.Minute * 5  // 本地缓存TTL
-	cleanupInterval  = time.Minute * 10 // 本地缓存清理间隔
-	maxBatchSize     = 100              // 最大批处理大小
-	flushInterval    = time.Second * 5  // 批处理刷新间隔
-	numLockShards    = 32               // 锁分片数量
-	maxVisitBuffer   = 5000             // 更大的访问记录缓冲区
+	// disabledCacheMarker 缓存中停用链接的标记，后接停用原因
+	disabledCacheMarker = "\x00disabled:"
+	// cacheInvalidateChannel 链接修改后通知其他实例删除本地缓存，消息内容为短码
+	cacheInvalidateChannel = "url:invalidate"
+	urlTTL                 = time.Hour * 24
+	statsTTL               = time.Hour
+	syncInterval           = time.Minute * 10
+	localCacheTTL          = time.Minute * 5  // 本地缓存TTL
+	cleanupInterval        = time.Minute * 10 // 本地缓存清理间隔
+	maxBatchSize           = 100              // 最大批处理大小
+	flushInterval          = time.Second * 5  // 批处理刷新间隔
+	visitWriteQueue        = 16               // 等待写入数据库的最大批次数
+	visitWriteTimeout      = time.Second * 10 // 写入一批访问明细的超时时间，须小于 rollupDelay
+	numLockShards          = 32               // 锁分片数量
+	maxVisitBuffer         = 5000             // 默认的访问记录缓冲区大小
+	urlIDCacheTTL          = time.Minute      // 链接ID和跟踪设置的缓存时间，其他实例修改跟踪设置后最迟在此时间后生效
+	// defaultURLExpiration 未指定有效期时的默认值
+	defaultURLExpiration = time.Hour * 24 * 365
 )
 
 // URLService 短链接服务接口
 type URLService interface {
-	CreateShortURL(ctx context.Context, originalURL string, userID uint, expiration time.Duration) (*model.URL, error)
+	CreateShortURL(ctx context.Context, originalURL, alias string, userID, workspaceID uint, expiration time.Duration, campaignID uint, utm model.UTMParams, noTracking bool) (*model.URL, error)
 	GetOriginalURL(ctx context.Context, shortCode string) (string, error)
-	TrackVisit(ctx context.Context, shortCode, ip, userAgent, referer string) error
-	DeleteURL(ctx context.Context, shortCode string, userID uint) error
+	GetURL(ctx context.Context, shortCode string) (*model.URL, error)
+	TrackVisit(ctx context.Context, shortCode string, info VisitInfo) error
+	DeleteURL(ctx context.Context, shortCode string) error
+	InvalidateCache(ctx context.Context, shortCodes ...string)
+	DisableURL(ctx context.Context, shortCode, reason string, moderatorID uint) error
+	EnableURL(ctx context.Context, shortCode string) error
+	SearchURLs(ctx context.Context, filter URLFilter) ([]*URLWithOwner, int64, error)
 	GetURLsByUser(ctx context.Context, userID uint) ([]*model.URL, error)
-	GetURLStats(ctx context.Context, shortCode string) (*model.Stats, error)
+	GetURLsByWorkspace(ctx context.Context, workspaceID uint) ([]*model.URL, error)
+	GetURLStats(ctx context.Context, shortCode string, r StatsRange) (*model.Stats, error)
+	GetLinksStats(ctx context.Context, urls []*model.URL, r StatsRange) *model.Stats
+	VisitCounts(ctx context.Context, urlIDs []uint, r StatsRange) map[uint]int64
+	VisitSeries(ctx context.Context, links LinkSet, r StatsRange) []model.DailyVisit
+	VisitBreakdown(ctx context.Context, links LinkSet, r StatsRange, dimension string, limit int) []model.Breakdown
+	ExportStats(ctx context.Context, shortCode string, r StatsRange, opts ExportOptions, w io.Writer) error
+	GetQuotaUsage(ctx context.Context, userID uint) (*QuotaUsage, error)
 	CleanupExpiredURLs(ctx context.Context) (*model.Message, error)
+	VisitLogStats() VisitLogStats
+	SetNoTracking(ctx context.Context, shortCode string, noTracking bool) error
+	EraseURLVisits(ctx context.Context, shortCode string) (int64, error)
+	EraseVisitsByIP(ctx context.Context, ip string, urlIDs []uint) (int64, error)
 	Close() // 添加关闭方法以正确关闭同步goroutine
 }
 
+// URLDisabledError 短链接已被审核员停用
+type URLDisabledError struct {
+	Reason string
+}
+
+func (e *URLDisabledError) Error() string {
+	return "短链接已被停用"
+}
+
+// URLFilter 链接搜索条件
+type URLFilter struct {
+	Query        string // 短码精确匹配或原始URL模糊匹配
+	DisabledOnly bool
+	Page         int
+	PageSize     int
+}
+
+// URLWithOwner 附带创建者用户名的链接
+type URLWithOwner struct {
+	model.URL
+	OwnerName string `json:"owner_name"`
+}
+
 // ShardedMutex 分片锁，用于减少锁竞争
 type ShardedMutex struct {
 	locks [numLockShards]sync.Mutex
@@ -72,45 +123,93 @@ func (sm *ShardedMutex) getShard(key string) uint32 {
 
 type urlService struct {
 	db            *gorm.DB
+	config        *config.Config
+	webhooks      WebhookService          // 发布链接事件
+	clicks        ClickStream             // 实时访问推送
+	geo           geoip.Resolver          // 访问IP的地理位置查询
 	redis         redisClient.RedisClient // 重命名为redis以明确其功能
 	memCache      *cache.Cache            // 重命名为memCache以区分本地内存缓存
 	syncCtx       context.Context
 	syncCtxCancel context.CancelFunc
-	visitChan     chan *model.URLVisit // 访问记录通道
-	visitBatch    []*model.URLVisit    // 批量访问记录
-	visitMutex    sync.Mutex           // 保护批处理的互斥锁
-	statsMutex    ShardedMutex         // 替换为分片锁
-	statsCounters sync.Map             // 使用sync.Map替换map+mutex
-	urlIDCache    map[string]uint      // 缓存shortCode -> URL ID的映射
-	urlIDMutex    sync.RWMutex         // 保护urlIDCache的读写锁
-	memCacheSize  int                  // 本地缓存大小限制
-	visitCounter  int64                // 用于统计处理的访问数
+	visitChan     chan *model.URLVisit   // 访问记录通道
+	visitBatch    []*model.URLVisit      // 批量访问记录
+	visitMutex    sync.Mutex             // 保护批处理的互斥锁
+	visitWrites   chan []*model.URLVisit // 待写入数据库的批次
+	visitDone     chan struct{}          // 批处理goroutine退出后关闭
+	writeDone     chan struct{}          // 写入goroutine写完全部批次后关闭
+	syncDone      chan struct{}          // 同步任务完成最后一次同步后关闭
+	statsMutex    ShardedMutex           // 替换为分片锁
+	statsCounters sync.Map               // 短码 -> *int64，尚未同步的访问次数
+	urlIDCache    map[string]trackInfo   // 缓存shortCode -> URL ID和跟踪设置
+	urlIDMutex    sync.RWMutex           // 保护urlIDCache的读写锁
+	memCacheSize  int                    // 本地缓存大小限制
+	visitLog      *visitLogger           // 访问明细的记录方式和计数
+	uniques       uniqueVisitors         // 独立访客估算
+	privacy       *ipAnonymizer          // 访问IP的保存方式
+}
+
+// trackInfo 记录访问时需要的链接信息
+type trackInfo struct {
+	id         uint
+	noTracking bool
+	cachedAt   time.Time
 }
 
 // NewURLService 创建URL服务
-func NewURLService(db *gorm.DB, redis redisClient.RedisClient) URLService {
+func NewURLService(db *gorm.DB, redis redisClient.RedisClient, cfg *config.Config, webhooks WebhookService, clicks ClickStream, geo geoip.Resolver) URLService {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	bufferSize := cfg.Analytics.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = maxVisitBuffer
+	}
+
 	// 创建本地缓存
 	memCache := cache.New(localCacheTTL, cleanupInterval)
 
 	service := &urlService{
 		db:            db,
+		config:        cfg,
+		webhooks:      webhooks,
+		clicks:        clicks,
+		geo:           geo,
 		redis:         redis,    // Redis缓存
 		memCache:      memCache, // 本地缓存
 		syncCtx:       ctx,
 		syncCtxCancel: cancel,
-		visitChan:     make(chan *model.URLVisit, maxVisitBuffer), // 增加通道缓冲大小
+		visitChan:     make(chan *model.URLVisit, bufferSize),
 		visitBatch:    make([]*model.URLVisit, 0, maxBatchSize),
-		urlIDCache:    make(map[string]uint),
+		visitWrites:   make(chan []*model.URLVisit, visitWriteQueue),
+		visitDone:     make(chan struct{}),
+		writeDone:     make(chan struct{}),
+		syncDone:      make(chan struct{}),
+		urlIDCache:    make(map[string]trackInfo),
 		memCacheSize:  10000, // 默认缓存10000个URL ID
+		visitLog:      newVisitLogger(cfg.Analytics),
+		uniques:       newUniqueVisitors(db, redis, cfg),
+		privacy:       newIPAnonymizer(cfg),
 	}
 
+	warnUnknownFeatures(cfg.Quota.Plans)
+
 	// 启动后台同步任务
 	go service.startSyncTask()
 
 	// 启动批处理访问记录的worker
 	go service.processVisitBatch()
+	go service.writeVisits()
+
+	// 为历史访问记录补充解析出的维度，之后定期将访问明细汇总到汇总表
+	go service.runRollups(ctx)
+
+	// 多实例部署时接收其他实例的缓存失效通知
+	if redis.Enabled() {
+		if messages, err := redis.Subscribe(ctx, cacheInvalidateChannel); err != nil {
+			logrus.Warnf("订阅缓存失效通知失败，其他实例修改的链接最长 %v 后生效: %v", localCacheTTL, err)
+		} else {
+			go service.receiveInvalidations(messages)
+		}
+	}
 
 	// 初始化工作池
 	service.initWorkerPools()
@@ -120,6 +219,7 @@ func NewURLService(db *gorm.DB, redis redisClient.RedisClient) URLService {
 
 // 启动后台同步任务
 func (s *urlService) startSyncTask() {
+	defer close(s.syncDone)
 	ticker := time.NewTicker(syncInterval)
 	defer ticker.Stop()
 
@@ -132,6 +232,9 @@ func (s *urlService) startSyncTask() {
 			} else {
 				logrus.Info("成功同步访问统计数据到数据库")
 			}
+			if err := s.uniques.flush(s.syncCtx); err != nil {
+				logrus.Errorf("同步独立访客数据失败: %v", err)
+			}
 		case <-s.syncCtx.Done():
 			// 收到取消信号，执行最后一次同步并退出
 			logrus.Info("正在关闭访问统计同步任务，执行最后一次同步...")
@@ -145,118 +248,112 @@ func (s *urlService) startSyncTask() {
 
 // processVisitBatch 批量处理访问记录
 func (s *urlService) processVisitBatch() {
+	defer close(s.visitDone)
 	ticker := time.NewTicker(flushInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case visit := <-s.visitChan:
-			s.visitMutex.Lock()
-			s.visitBatch = append(s.visitBatch, visit)
-
 			// 如果达到批处理大小，立即写入数据库
-			if len(s.visitBatch) >= maxBatchSize {
+			if s.appendVisit(visit) >= maxBatchSize {
 				s.flushVisitBatch()
 			}
-			s.visitMutex.Unlock()
 
 		case <-ticker.C:
 			// 定时刷新，即使未达到最大批处理大小
-			s.visitMutex.Lock()
-			if len(s.visitBatch) > 0 {
-				s.flushVisitBatch()
-			}
-			s.visitMutex.Unlock()
+			s.flushVisitBatch()
+			s.visitLog.reportLosses()
 
 		case <-s.syncCtx.Done():
-			// 服务关闭时，确保所有记录都写入数据库
-			s.visitMutex.Lock()
-			if len(s.visitBatch) > 0 {
-				s.flushVisitBatch()
+			// 服务关闭时，确保缓冲区中的所有记录都写入数据库
+			for len(s.visitChan) > 0 {
+				if s.appendVisit(<-s.visitChan) >= maxBatchSize {
+					s.flushVisitBatch()
+				}
 			}
-			s.visitMutex.Unlock()
+			s.flushVisitBatch()
+			close(s.visitWrites)
 			return
 		}
 	}
 }
 
-// flushVisitBatch 将批处理的访问记录写入数据库
+// appendVisit 将访问记录加入当前批次，返回批次大小
+func (s *urlService) appendVisit(visit *model.URLVisit) int {
+	s.visitMutex.Lock()
+	defer s.visitMutex.Unlock()
+	s.visitBatch = append(s.visitBatch, visit)
+	return len(s.visitBatch)
+}
+
+// flushVisitBatch 将当前批次交给写入goroutine，写入跟不上时阻塞，新的访问记录在缓冲区满后丢弃
 func (s *urlService) flushVisitBatch() {
+	s.visitMutex.Lock()
 	if len(s.visitBatch) == 0 {
+		s.visitMutex.Unlock()
 		return
 	}
-
 	// 复制当前批次并清空批处理数组
 	batch := make([]*model.URLVisit, len(s.visitBatch))
 	copy(batch, s.visitBatch)
 	s.visitBatch = s.visitBatch[:0]
+	s.visitMutex.Unlock()
 
-	// 异步写入数据库
-	go func(visits []*model.URLVisit) {
-		// 优化：合并相同URL ID的访问记录，只记录计数
-		visitCount := make(map[uint]int64)
-		// 保留每个URL ID的第一条访问记录用于详细信息
-		visitDetails := make(map[uint]*model.URLVisit)
-
-		for _, visit := range visits {
-			visitCount[visit.URLID]++
-			// 只保留每个URL ID的第一条记录作为详细信息
-			if _, exists := visitDetails[visit.URLID]; !exists {
-				visitDetails[visit.URLID] = visit
-			}
-		}
-
-		// 批量更新计数
-		for urlID, count := range visitCount {
-			if err := s.db.Model(&model.URL{}).Where("id = ?", urlID).
-				UpdateColumn("visits", gorm.Expr("visits + ?", count)).Error; err != nil {
-				logrus.Warnf("更新访问计数失败: %v", err)
-			}
-		}
+	s.visitWrites <- batch
+}
 
-		// 只存储一些典型的访问记录，不是全部
-		// 比如每个URL只存储一条或几条记录，而不是所有记录
-		var samplesToSave []*model.URLVisit
-		for _, visit := range visitDetails {
-			samplesToSave = append(samplesToSave, visit)
+// writeVisits 按顺序逐批写入访问明细，直到 visitWrites 关闭
+// 只有一个goroutine写入，ID的分配顺序与提交顺序一致，汇总进度按ID推进时不会跳过提交较晚的明细
+func (s *urlService) writeVisits() {
+	defer close(s.writeDone)
+	for visits := range s.visitWrites {
+		// 访问次数由统计计数器单独累计，这里只写入明细
+		s.enrichVisits(visits)
+		if err := s.insertVisits(visits); err != nil {
+			s.visitLog.failed.Add(int64(len(visits)))
+			logrus.Warnf("保存访问记录失败: %v", err)
+			continue
 		}
+		s.visitLog.recorded.Add(int64(len(visits)))
+	}
+}
 
-		if len(samplesToSave) > 0 {
-			if err := s.db.CreateInBatches(samplesToSave, 10).Error; err != nil {
-				logrus.Warnf("保存访问记录样本失败: %v", err)
-			}
-		}
-	}(batch)
+// insertVisits 写入一批访问明细并记录写入时间
+// 写入限时 visitWriteTimeout，超时回滚，保证写入时间早于汇总截止时间的明细都已提交或已放弃(见 rollupDelay)
+func (s *urlService) insertVisits(visits []*model.URLVisit) error {
+	ctx, cancel := context.WithTimeout(context.Background(), visitWriteTimeout)
+	defer cancel()
+	now := time.Now()
+	for _, v := range visits {
+		v.RecordedAt = &now
+	}
+	return s.db.WithContext(ctx).CreateInBatches(visits, maxBatchSize).Error
 }
 
-// updateLocalStatsCounter 更新本地统计计数器 (优化版)
+// updateLocalStatsCounter 更新本地统计计数器
+// 启用Redis时累计到一定数量后转存到Redis，否则由定时同步任务直接写入数据库
 func (s *urlService) updateLocalStatsCounter(shortCode string, value int64) {
-	// 使用sync.Map代替mutex+map，减少锁竞争
-	actual, _ := s.statsCounters.LoadOrStore(shortCode, int64(0))
-	currentVal := actual.(int64)
-	newVal := currentVal + value
+	actual, _ := s.statsCounters.LoadOrStore(shortCode, new(int64))
+	counter := actual.(*int64)
+	if atomic.AddInt64(counter, value) < 10 || !s.redis.Enabled() {
+		return
+	}
 
-	// 当计数器达到一定值时同步到Redis
-	if newVal >= 10 {
-		if s.redis.Enabled() {
-			// 使用sync.Map的原子操作
-			s.statsCounters.Store(shortCode, int64(0))
-
-			// 异步操作Redis，避免阻塞
-			go func(sc string, val int64) {
-				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-				defer cancel()
-				if _, err := s.redis.Incr(ctx, statsCachePrefix+sc, val); err != nil {
-					// 操作失败时，将值加回本地计数器
-					actual, _ := s.statsCounters.LoadOrStore(sc, int64(0))
-					s.statsCounters.Store(sc, actual.(int64)+val)
-					logrus.Warnf("增加Redis计数器失败: %v", err)
-				}
-			}(shortCode, newVal)
-		}
-	} else {
-		s.statsCounters.Store(shortCode, newVal)
+	val := atomic.SwapInt64(counter, 0)
+	if val <= 0 {
+		return
 	}
+	// 异步操作Redis，避免阻塞
+	go func(sc string, val int64) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := s.redis.Incr(ctx, statsCachePrefix+sc, val); err != nil {
+			// 操作失败时，将值加回本地计数器
+			atomic.AddInt64(counter, val)
+			logrus.Warnf("增加Redis计数器失败: %v", err)
+		}
+	}(shortCode, val)
 }
 
 // SyncVisitCountsToDB 将Redis中的访问计数同步到数据库
@@ -266,11 +363,8 @@ func (s *urlService) SyncVisitCountsToDB(ctx context.Context) error {
 
 	// 使用sync.Map的Range方法遍历所有计数器
 	s.statsCounters.Range(func(key, value interface{}) bool {
-		shortCode := key.(string)
-		count := value.(int64)
-		if count > 0 {
-			countersCopy[shortCode] = count
-			s.statsCounters.Store(shortCode, int64(0)) // 重置计数器
+		if count := atomic.SwapInt64(value.(*int64), 0); count > 0 {
+			countersCopy[key.(string)] = count
 		}
 		return true
 	})
@@ -343,52 +437,77 @@ func (s *urlService) SyncVisitCountsToDB(ctx context.Context) error {
 
 // Close 关闭服务，停止后台任务
 func (s *urlService) Close() {
-	// 通知所有goroutine退出
+	// 通知所有goroutine退出，等待缓冲的访问记录写入数据库
 	s.syncCtxCancel()
+	<-s.visitDone
+	<-s.writeDone
+	<-s.syncDone
 
 	// 确保所有处理都已完成
 	// 最后同步一次统计数据
 	if err := s.SyncVisitCountsToDB(context.Background()); err != nil {
 		logrus.Errorf("最终同步访问统计数据失败: %v", err)
 	}
+	if err := s.uniques.flush(context.Background()); err != nil {
+		logrus.Errorf("最终同步独立访客数据失败: %v", err)
+	}
 
 	// 关闭本地缓存
 	s.memCache.Flush() // 更新引用
 }
 
-// CreateShortURL 创建短链接
-func (s *urlService) CreateShortURL(ctx context.Context, originalURL string, userID uint, expiration time.Duration) (*model.URL, error) {
-	// 生成短码
-	shortCode := s.generateShortCode(originalURL)
-
-	// 检查短码是否已存在
-	var count int64
-	if err := s.db.Model(&model.URL{}).Where("short_code = ?", shortCode).Count(&count).Error; err != nil {
-		return nil, fmt.Errorf("检查短码失败: %v", err)
-	}
+// CreateShortURL 创建短链接，workspaceID为0时创建个人链接，alias不为空时使用自定义短码
+// campaignID不为0时归入营销活动，utm为已追加到originalURL中的UTM参数，noTracking为true时不记录访问明细
+// 创建前检查用户套餐限额，超出时返回 *QuotaExceededError
+func (s *urlService) CreateShortURL(ctx context.Context, originalURL, alias string, userID, workspaceID uint, expiration time.Duration, campaignID uint, utm model.UTMParams, noTracking bool) (*model.URL, error) {
+	var url *model.URL
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		expiration, err := s.checkQuota(tx, userID, alias, expiration)
+		if err != nil {
+			return err
+		}
 
-	// 如果短码已存在，添加随机字符
-	if count > 0 {
-		shortCode = shortCode[:len(shortCode)-1] + s.randomChar()
-	}
+		shortCode := alias
+		if shortCode != "" {
+			if err := validateAlias(tx, shortCode); err != nil {
+				return err
+			}
+		} else {
+			// 生成短码
+			shortCode = s.generateShortCode(originalURL)
 
-	// 设置过期时间
-	expiresAt := time.Now().Add(expiration)
-	if expiration == 0 {
-		expiresAt = time.Now().AddDate(1, 0, 0) // 默认1年
-	}
+			// 检查短码是否已存在
+			var count int64
+			if err := tx.Model(&model.URL{}).Where("short_code = ?", shortCode).Count(&count).Error; err != nil {
+				return fmt.Errorf("检查短码失败: %v", err)
+			}
 
-	// 创建短链接记录
-	url := &model.URL{
-		ShortCode:   shortCode,
-		OriginalURL: originalURL,
-		UserID:      userID,
-		ExpiresAt:   expiresAt,
-	}
+			// 如果短码已存在，添加随机字符
+			if count > 0 {
+				shortCode = shortCode[:len(shortCode)-1] + s.randomChar()
+			}
+		}
 
-	if err := s.db.Create(url).Error; err != nil {
-		return nil, fmt.Errorf("创建短链接失败: %v", err)
+		// 创建短链接记录，限额检查和写入在同一事务中
+		url = &model.URL{
+			ShortCode:   shortCode,
+			OriginalURL: originalURL,
+			UserID:      userID,
+			WorkspaceID: workspaceID,
+			ExpiresAt:   time.Now().Add(expiration),
+			CampaignID:  campaignID,
+			UTMParams:   utm,
+			NoTracking:  noTracking,
+		}
+		if err := tx.Create(url).Error; err != nil {
+			return fmt.Errorf("创建短链接失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	shortCode, expiresAt := url.ShortCode, url.ExpiresAt
 
 	// 缓存短链接
 	if s.redis.Enabled() { // 更新引用
@@ -398,6 +517,18 @@ func (s *urlService) CreateShortURL(ctx context.Context, originalURL string, use
 		}
 	}
 
+	s.webhooks.Publish(LinkEvent{
+		Type:      model.WebhookEventLinkCreated,
+		ShortCode: shortCode,
+		UserID:    userID,
+		Data: map[string]interface{}{
+			"original_url": originalURL,
+			"workspace_id": workspaceID,
+			"campaign_id":  campaignID,
+			"expires_at":   expiresAt,
+		},
+	})
+
 	return url, nil
 }
 
@@ -405,7 +536,7 @@ func (s *urlService) CreateShortURL(ctx context.Context, originalURL string, use
 func (s *urlService) GetOriginalURL(ctx context.Context, shortCode string) (string, error) {
 	// 零分配检查本地缓存 - 避免不必要的临时对象
 	if cachedURL, found := s.memCache.Get(shortCode); found {
-		return cachedURL.(string), nil
+		return resolveCachedURL(cachedURL.(string))
 	}
 
 	// 避免创建多个context对象
@@ -418,6 +549,9 @@ func (s *urlService) GetOriginalURL(ctx context.Context, shortCode string) (stri
 		if err == nil {
 			// 更新本地缓存并立即返回
 			s.memCache.Set(shortCode, originalURL, cache.DefaultExpiration)
+			if strings.HasPrefix(originalURL, disabledCacheMarker) {
+				return resolveCachedURL(originalURL)
+			}
 
 			// 非阻塞异步缓存ID - 使用独立goroutine池
 			select {
@@ -434,7 +568,7 @@ func (s *urlService) GetOriginalURL(ctx context.Context, shortCode string) (stri
 	// 数据库查询 - 使用预准备语句提高效率
 	var url model.URL
 	if err := s.db.WithContext(ctx).
-		Select("id, original_url, expires_at").
+		Select("id, original_url, expires_at, disabled, disabled_reason, no_tracking").
 		Where("short_code = ? AND expires_at > ?", shortCode, time.Now()).
 		First(&url).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -445,8 +579,14 @@ func (s *urlService) GetOriginalURL(ctx context.Context, shortCode string) (stri
 		return "", fmt.Errorf("获取短链接失败: %v", err)
 	}
 
+	// 停用状态同样写入缓存，避免每次访问都查询数据库
+	if url.Disabled {
+		s.cacheDisabled(ctx, shortCode, url.DisabledReason)
+		return "", &URLDisabledError{Reason: url.DisabledReason}
+	}
+
 	// 缓存URL ID
-	s.cacheURLIDDirect(shortCode, url.ID)
+	s.cacheURLIDDirect(shortCode, &url)
 
 	// 缓存到Redis - 异步操作
 	if s.redis.Enabled() {
@@ -468,34 +608,46 @@ func (s *urlService) GetOriginalURL(ctx context.Context, shortCode string) (stri
 	return url.OriginalURL, nil
 }
 
+// GetURL 获取短链接记录
+func (s *urlService) GetURL(ctx context.Context, shortCode string) (*model.URL, error) {
+	var url model.URL
+	if err := s.db.WithContext(ctx).Where("short_code = ?", shortCode).First(&url).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("短链接不存在")
+		}
+		return nil, fmt.Errorf("获取短链接失败: %v", err)
+	}
+	return &url, nil
+}
+
 // cacheURLID 从数据库获取并缓存URL ID
 func (s *urlService) cacheURLID(shortCode string, ctx context.Context) {
 	// 先检查是否已缓存
 	s.urlIDMutex.RLock()
-	_, exists := s.urlIDCache[shortCode]
+	entry, exists := s.urlIDCache[shortCode]
 	s.urlIDMutex.RUnlock()
 
-	if exists {
+	if exists && time.Since(entry.cachedAt) < urlIDCacheTTL {
 		return // 已缓存，直接返回
 	}
 
 	// 缓存未命中，需要查询数据库
 	var url model.URL
 	if err := s.db.WithContext(ctx).
-		Select("id").
+		Select("id", "no_tracking").
 		Where("short_code = ?", shortCode).
 		First(&url).Error; err == nil {
-		s.cacheURLIDDirect(shortCode, url.ID)
+		s.cacheURLIDDirect(shortCode, &url)
 	}
 }
 
 // cacheURLIDDirect 直接缓存URL ID
-func (s *urlService) cacheURLIDDirect(shortCode string, urlID uint) {
+func (s *urlService) cacheURLIDDirect(shortCode string, url *model.URL) {
 	s.urlIDMutex.Lock()
 	defer s.urlIDMutex.Unlock()
 
 	// 检查缓存大小限制
-	if len(s.urlIDCache) >= s.memCacheSize {
+	if _, exists := s.urlIDCache[shortCode]; !exists && len(s.urlIDCache) >= s.memCacheSize {
 		// 简单的缓存淘汰策略：随机删除一个条目
 		for key := range s.urlIDCache {
 			delete(s.urlIDCache, key)
@@ -503,170 +655,376 @@ func (s *urlService) cacheURLIDDirect(shortCode string, urlID uint) {
 		}
 	}
 
-	s.urlIDCache[shortCode] = urlID
+	s.urlIDCache[shortCode] = trackInfo{id: url.ID, noTracking: url.NoTracking, cachedAt: time.Now()}
 }
 
-// getURLID 获取URL ID (优先从缓存获取)
-func (s *urlService) getURLID(ctx context.Context, shortCode string) (uint, error) {
+// getURLID 获取URL ID和跟踪设置 (优先从缓存获取)
+func (s *urlService) getURLID(ctx context.Context, shortCode string) (trackInfo, error) {
 	// 先检查本地缓存
 	s.urlIDMutex.RLock()
-	id, exists := s.urlIDCache[shortCode]
+	entry, exists := s.urlIDCache[shortCode]
 	s.urlIDMutex.RUnlock()
 
-	if exists {
-		return id, nil
+	if exists && time.Since(entry.cachedAt) < urlIDCacheTTL {
+		return entry, nil
 	}
 
 	// 缓存未命中，查询数据库
 	var url model.URL
 	if err := s.db.WithContext(ctx).
-		Select("id").
+		Select("id", "no_tracking").
 		Where("short_code = ?", shortCode).
 		First(&url).Error; err != nil {
-		return 0, fmt.Errorf("获取短链接ID失败: %v", err)
+		return trackInfo{}, fmt.Errorf("获取短链接ID失败: %v", err)
 	}
 
 	// 缓存查询结果
-	s.cacheURLIDDirect(shortCode, url.ID)
+	s.cacheURLIDDirect(shortCode, &url)
 
-	return url.ID, nil
+	return trackInfo{id: url.ID, noTracking: url.NoTracking}, nil
 }
 
 // TrackVisit 异步记录访问 (进一步优化)
-func (s *urlService) TrackVisit(ctx context.Context, shortCode, ip, userAgent, referer string) error {
-	// 增加统计计数
-	atomic.AddInt64(&s.visitCounter, 1)
-
+// 机器人访问只记录明细用于单独统计，不计入访问次数，也不推送实时访问和Webhook
+// 链接关闭跟踪或访问者请求不被跟踪(按配置)时只计入访问次数；IP在写入明细前按配置匿名化
+func (s *urlService) TrackVisit(ctx context.Context, shortCode string, info VisitInfo) error {
 	// 查询URL ID - 优先从缓存获取
-	urlID, err := s.getURLID(ctx, shortCode)
+	url, err := s.getURLID(ctx, shortCode)
 	if err != nil {
 		return err
 	}
+	tracking := !url.noTracking && !(info.DoNotTrack && s.config.Privacy.HonorDoNotTrack)
+
+	if !info.IsBot() {
+		// 增加本地访问计数
+		s.updateLocalStatsCounter(shortCode, 1)
+
+		data := map[string]interface{}{}
+		if tracking {
+			s.uniques.add(ctx, url.id, time.Now(), info)
+			s.clicks.Publish(shortCode, info.UserAgent, info.Referer)
+			data = map[string]interface{}{
+				"ip":         s.privacy.anonymize(info.IP),
+				"user_agent": info.UserAgent,
+				"referer":    info.Referer,
+			}
+			if s.config.Privacy.DiscardUserAgent {
+				delete(data, "user_agent")
+			}
+		}
+		s.webhooks.Publish(LinkEvent{
+			Type:      model.WebhookEventLinkClicked,
+			ShortCode: shortCode,
+			Data:      data,
+		})
+	}
+	if !tracking {
+		return nil
+	}
 
-	// 增加本地访问计数
-	s.updateLocalStatsCounter(shortCode, 1)
-
-	// 在高负载下采样，不是每次访问都记录详细信息
-	// 只存储约10%的详细访问记录，但保持计数准确
-	if atomic.LoadInt64(&s.visitCounter)%10 != 0 {
-		// 跳过详细记录，只更新计数
+	// 访问次数已计入统计计数器，明细按配置全部记录、抽样记录或不记录
+	weight, ok := s.visitLog.sample()
+	if !ok {
 		return nil
 	}
 
-	// 创建访问记录并发送到通道
 	visit := &model.URLVisit{
-		URLID:      urlID,
-		IP:         ip,
-		UserAgent:  userAgent,
-		RefererURL: referer,
+		URLID:      url.id,
+		IP:         s.privacy.anonymize(info.IP),
+		ClientIP:   info.IP,
+		UserAgent:  info.UserAgent,
+		RefererURL: info.Referer,
+		Weight:     weight,
+		Bot:        info.IsBot(),
+		BotReason:  info.BotReason,
 		CreatedAt:  time.Now(),
 	}
 
-	// 非阻塞方式发送到通道
+	// 非阻塞方式发送到通道，写入跟不上时丢弃明细并计数，访问次数不受影响
 	select {
 	case s.visitChan <- visit:
-		// 成功发送
 	default:
-		// 通道已满，丢弃详细记录，但计数已经更新
+		s.visitLog.dropped.Add(1)
 	}
 
 	return nil
 }
 
-// DeleteURL 删除短链接
-func (s *urlService) DeleteURL(ctx context.Context, shortCode string, userID uint) error {
-	result := s.db.Where("short_code = ? AND user_id = ?", shortCode, userID).Delete(&model.URL{})
+// DeleteURL 删除短链接，调用方负责校验删除权限
+func (s *urlService) DeleteURL(ctx context.Context, shortCode string) error {
+	result := s.db.Where("short_code = ?", shortCode).Delete(&model.URL{})
 	if result.Error != nil {
 		return fmt.Errorf("删除短链接失败: %v", result.Error)
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("短链接不存在或无权删除")
+		return fmt.Errorf("短链接不存在")
 	}
 
 	// 删除缓存
-	if s.redis.Enabled() { // 更新引用
-		cacheKey := urlCachePrefix + shortCode
-		if err := s.redis.Del(ctx, cacheKey); err != nil {
-			logrus.Warnf("删除短链接缓存失败: %v", err)
+	s.InvalidateCache(ctx, shortCode)
+
+	s.webhooks.Publish(LinkEvent{Type: model.WebhookEventLinkDeleted, ShortCode: shortCode})
+
+	return nil
+}
+
+// InvalidateCache 清除短链接的本地和Redis缓存，并通知其他实例清除本地缓存，链接被删除或修改后调用
+func (s *urlService) InvalidateCache(ctx context.Context, shortCodes ...string) {
+	for _, shortCode := range shortCodes {
+		s.dropLocalCache(shortCode)
+		if s.redis.Enabled() {
+			if err := s.redis.Del(ctx, urlCachePrefix+shortCode, statsCachePrefix+shortCode); err != nil {
+				logrus.Warnf("删除短链接缓存失败: %v", err)
+			}
+			s.publishInvalidation(ctx, shortCode)
 		}
-		s.redis.Del(ctx, statsCachePrefix+shortCode)
+	}
+}
+
+// dropLocalCache 删除本实例缓存的短链接和链接ID
+func (s *urlService) dropLocalCache(shortCode string) {
+	s.memCache.Delete(shortCode)
+	s.urlIDMutex.Lock()
+	delete(s.urlIDCache, shortCode)
+	s.urlIDMutex.Unlock()
+}
+
+// publishInvalidation 通知所有实例(包括本实例)删除短链接的本地缓存，须在Redis中的缓存更新之后调用
+func (s *urlService) publishInvalidation(ctx context.Context, shortCode string) {
+	if err := s.redis.Publish(ctx, cacheInvalidateChannel, shortCode); err != nil {
+		logrus.Warnf("发送缓存失效通知失败: %v", err)
+	}
+}
+
+// receiveInvalidations 处理缓存失效通知，之后的访问从Redis或数据库重新读取
+func (s *urlService) receiveInvalidations(messages <-chan string) {
+	for shortCode := range messages {
+		s.dropLocalCache(shortCode)
+	}
+}
+
+// DisableURL 停用短链接，访问者将看到停用说明页
+func (s *urlService) DisableURL(ctx context.Context, shortCode, reason string, moderatorID uint) error {
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&model.URL{}).
+		Where("short_code = ?", shortCode).
+		Updates(map[string]interface{}{
+			"disabled":        true,
+			"disabled_reason": reason,
+			"disabled_at":     now,
+			"disabled_by":     moderatorID,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("停用短链接失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("短链接不存在")
 	}
 
+	// 直接写入停用标记而不是删除缓存，避免停用后的访问穿透到数据库；
+	// 其他实例收到失效通知后删除本地缓存，再从Redis读到停用标记
+	s.cacheDisabled(ctx, shortCode, reason)
+	if s.redis.Enabled() {
+		s.publishInvalidation(ctx, shortCode)
+	}
 	return nil
 }
 
-// GetURLsByUser 获取用户创建的短链接
+// EnableURL 恢复被停用的短链接
+func (s *urlService) EnableURL(ctx context.Context, shortCode string) error {
+	result := s.db.WithContext(ctx).Model(&model.URL{}).
+		Where("short_code = ?", shortCode).
+		Updates(map[string]interface{}{
+			"disabled":        false,
+			"disabled_reason": "",
+			"disabled_at":     nil,
+			"disabled_by":     0,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("恢复短链接失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("短链接不存在")
+	}
+
+	s.InvalidateCache(ctx, shortCode)
+	return nil
+}
+
+// SearchURLs 按短码或原始URL搜索所有链接，供审核员使用
+func (s *urlService) SearchURLs(ctx context.Context, filter URLFilter) ([]*URLWithOwner, int64, error) {
+	query := s.db.WithContext(ctx).Model(&model.URL{})
+	if filter.Query != "" {
+		like := "%" + escapeLike(filter.Query) + "%"
+		query = query.Where("urls.short_code = ? OR urls.original_url LIKE ? ESCAPE '\\'", filter.Query, like)
+	}
+	if filter.DisabledOnly {
+		query = query.Where("urls.disabled = ?", true)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询短链接失败: %v", err)
+	}
+
+	page, pageSize := filter.Page, filter.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	var urls []*URLWithOwner
+	if err := query.Select("urls.*, users.username AS owner_name").
+		Joins("LEFT JOIN users ON users.id = urls.user_id").
+		Order("urls.id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Scan(&urls).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询短链接失败: %v", err)
+	}
+	return urls, total, nil
+}
+
+// likeEscaper 转义 LIKE 模式中的通配符，配合 ESCAPE '\' 使用
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// cacheDisabled 在本地和Redis缓存中写入停用标记
+func (s *urlService) cacheDisabled(ctx context.Context, shortCode, reason string) {
+	marker := disabledCacheMarker + reason
+	s.memCache.Set(shortCode, marker, cache.DefaultExpiration)
+	if s.redis.Enabled() {
+		if err := s.redis.Set(ctx, urlCachePrefix+shortCode, marker, urlTTL); err != nil {
+			logrus.Warnf("写入短链接停用缓存失败: %v", err)
+		}
+	}
+}
+
+// resolveCachedURL 解析缓存中的值: 空字符串表示链接不存在，带停用标记表示已停用
+func resolveCachedURL(cached string) (string, error) {
+	if cached == "" {
+		return "", fmt.Errorf("短链接不存在或已过期")
+	}
+	if strings.HasPrefix(cached, disabledCacheMarker) {
+		return "", &URLDisabledError{Reason: strings.TrimPrefix(cached, disabledCacheMarker)}
+	}
+	return cached, nil
+}
+
+// GetURLsByUser 获取用户的个人短链接，不包含已转移到团队空间的链接
 func (s *urlService) GetURLsByUser(ctx context.Context, userID uint) ([]*model.URL, error) {
 	var urls []*model.URL
-	if err := s.db.Where("user_id = ?", userID).Find(&urls).Error; err != nil {
+	if err := s.db.Where("user_id = ? AND workspace_id = 0", userID).Find(&urls).Error; err != nil {
 		return nil, fmt.Errorf("获取用户短链接失败: %v", err)
 	}
 	return urls, nil
 }
 
-// GetURLStats 获取短链接访问统计
-func (s *urlService) GetURLStats(ctx context.Context, shortCode string) (*model.Stats, error) {
+// GetURLsByWorkspace 获取团队空间内的短链接
+func (s *urlService) GetURLsByWorkspace(ctx context.Context, workspaceID uint) ([]*model.URL, error) {
+	var urls []*model.URL
+	if err := s.db.Where("workspace_id = ?", workspaceID).Find(&urls).Error; err != nil {
+		return nil, fmt.Errorf("获取团队空间短链接失败: %v", err)
+	}
+	return urls, nil
+}
+
+// GetURLStats 获取短链接访问统计，总访问量和独立访客数为全部时间，其余为时间范围内的统计
+func (s *urlService) GetURLStats(ctx context.Context, shortCode string, r StatsRange) (*model.Stats, error) {
 	var url model.URL
 	if err := s.db.Where("short_code = ?", shortCode).First(&url).Error; err != nil {
 		return nil, fmt.Errorf("获取短链接信息失败: %v", err)
 	}
+	return s.GetLinksStats(ctx, []*model.URL{&url}, r), nil
+}
+
+// GetLinksStats 汇总多个链接的访问统计，口径与 GetURLStats 相同
+// 各链接的 Visits 会加上尚未同步到数据库的访问次数
+func (s *urlService) GetLinksStats(ctx context.Context, urls []*model.URL, r StatsRange) *model.Stats {
+	urlIDs := make([]uint, 0, len(urls))
+	var totalVisits int64
+	for _, url := range urls {
+		url.Visits += s.pendingVisits(ctx, url.ShortCode)
+		totalVisits += url.Visits
+		urlIDs = append(urlIDs, url.ID)
+	}
+
+	stats := &model.Stats{
+		From:              r.From,
+		To:                r.To,
+		Interval:          r.Interval,
+		Timezone:          r.TimezoneName(),
+		DailyVisits:       s.VisitSeries(ctx, LinkSet{IDs: urlIDs}, r),
+		TotalVisits:       totalVisits,
+		TopReferers:       make([]model.Referer, 0),
+		RefererDomains:    []model.Breakdown{},
+		RefererCategories: []model.Breakdown{},
+		TopUserAgents:     make([]model.UserAgent, 0),
+		Browsers:          []model.Breakdown{},
+		BrowserVersions:   []model.Breakdown{},
+		OperatingSystems:  []model.Breakdown{},
+		Devices:           []model.Breakdown{},
+		Countries:         []model.Breakdown{},
+		Regions:           []model.Breakdown{},
+		Cities:            []model.Breakdown{},
+		Bots:              model.BotTraffic{Reasons: []model.Breakdown{}, Agents: []model.Breakdown{}},
+	}
+	for _, point := range stats.DailyVisits {
+		stats.RangeVisits += point.Count
+	}
+	if len(urlIDs) == 0 {
+		return stats
+	}
+
+	// 以下统计均为时间范围内的访问，每条明细按其代表的访问次数计入，不含机器人访问
+	scope := s.newVisitScope(ctx, LinkSet{IDs: urlIDs}, r)
+
+	for _, b := range s.visitBreakdown(ctx, scope, DimensionReferer, 10) {
+		stats.TopReferers = append(stats.TopReferers, model.Referer{URL: b.Name, Count: b.Count})
+	}
+	for _, b := range s.visitBreakdown(ctx, scope, DimensionUserAgent, 10) {
+		stats.TopUserAgents = append(stats.TopUserAgents, model.UserAgent{Name: b.Name, Count: b.Count})
+	}
+	bots, sampled := s.botVisits(ctx, scope)
+
+	stats.UniqueVisitors = s.uniques.count(ctx, urlIDs)
+	stats.RangeUniques = s.uniques.count(ctx, urlIDs, uniqueDays(r.From, r.To)...)
+	stats.RefererDomains = s.visitBreakdown(ctx, scope, DimensionRefererDomain, 10)
+	stats.RefererCategories = s.visitBreakdown(ctx, scope, DimensionRefererCategory, 10)
+	stats.Browsers = s.visitBreakdown(ctx, scope, DimensionBrowser, 10)
+	stats.BrowserVersions = s.visitBreakdown(ctx, scope, DimensionBrowserVersion, 10)
+	stats.OperatingSystems = s.visitBreakdown(ctx, scope, DimensionOS, 10)
+	stats.Devices = s.visitBreakdown(ctx, scope, DimensionDevice, 10)
+	stats.Countries = s.visitBreakdown(ctx, scope, DimensionCountry, 10)
+	stats.Regions = s.visitBreakdown(ctx, scope, DimensionRegion, 10)
+	stats.Cities = s.visitBreakdown(ctx, scope, DimensionCity, 10)
+	stats.Bots = s.botTraffic(ctx, scope, bots)
+	stats.Sampled = sampled
+
+	return stats
+}
 
-	// 检查缓存中是否有计数器更新
+// pendingVisits 返回尚未同步到数据库的访问次数: Redis中的计数器和本实例的本地计数器
+func (s *urlService) pendingVisits(ctx context.Context, shortCode string) int64 {
+	var visits int64
 	if s.redis.Enabled() { // 更新引用
 		if cachedVisits, err := s.redis.Get(ctx, statsCachePrefix+shortCode); err == nil {
-			// 解析缓存的访问次数并添加到数据库记录的计数
+			// 解析缓存的访问次数
 			var additionalVisits int64
 			fmt.Sscanf(cachedVisits, "%d", &additionalVisits)
-			url.Visits += additionalVisits
+			visits += additionalVisits
 		}
 	}
-
-	// 获取每日访问统计
-	var dailyVisits []model.DailyVisit
-	s.db.Raw(`
-		SELECT 
-			DATE(created_at) as date, 
-			COUNT(*) as count 
-		FROM url_visits 
-		WHERE url_id = ? 
-		GROUP BY DATE(created_at) 
-		ORDER BY date DESC 
-		LIMIT 30`, url.ID).Scan(&dailyVisits)
-
-	// 获取来源网站统计
-	var topReferers []model.Referer
-	s.db.Raw(`
-		SELECT 
-			referer_url as url, 
-			COUNT(*) as count 
-		FROM url_visits 
-		WHERE url_id = ? AND referer_url != '' 
-		GROUP BY referer_url 
-		ORDER BY count DESC 
-		LIMIT 10`, url.ID).Scan(&topReferers)
-
-	// 获取用户代理统计
-	var topUserAgents []model.UserAgent
-	s.db.Raw(`
-		SELECT 
-			user_agent as name, 
-			COUNT(*) as count 
-		FROM url_visits 
-		WHERE url_id = ? 
-		GROUP BY user_agent 
-		ORDER BY count DESC 
-		LIMIT 10`, url.ID).Scan(&topUserAgents)
-
-	// 构建统计结果
-	stats := &model.Stats{
-		DailyVisits:   dailyVisits,
-		TotalVisits:   url.Visits,
-		TopReferers:   topReferers,
-		TopUserAgents: topUserAgents,
+	if counter, ok := s.statsCounters.Load(shortCode); ok {
+		visits += atomic.LoadInt64(counter.(*int64))
 	}
-
-	return stats, nil
+	return visits
 }
 
 // generateShortCode 生成短链接代码
@@ -700,7 +1058,7 @@ func (s *urlService) CleanupExpiredURLs(ctx context.Context) (*model.Message, er
 	}
 
 	logrus.Infof("已清理 %d 条过期短链接", result.RowsAffected)
-	return &model.Message{Content: "成功清理过期短链接"}, nil
+	return &model.Message{Content: fmt.Sprintf("成功清理 %d 条过期短链接", result.RowsAffected)}, nil
 }
 
 // 初始化goroutine池和任务队列
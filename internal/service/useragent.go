@@ -0,0 +1,135 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 设备类型
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgentInfo User-Agent解析结果
+type UserAgentInfo struct {
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browser_version"`
+	OS             string `json:"os"`
+	Device         string `json:"device"`
+}
+
+// uaRule 按顺序匹配的浏览器规则，先匹配的优先，因此基于Chromium的浏览器要排在Chrome之前
+type uaRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var (
+	browserRules = []uaRule{
+		{"Edge", regexp.MustCompile(`(?:Edg|Edge|EdgA|EdgiOS)/([\d.]+)`)},
+		{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+		{"WeChat", regexp.MustCompile(`MicroMessenger/([\d.]+)`)},
+		{"QQ Browser", regexp.MustCompile(`M?QQBrowser/([\d.]+)`)},
+		{"UC Browser", regexp.MustCompile(`UCBrowser/([\d.]+)`)},
+		{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+		{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+		{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+		{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+		{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+	}
+
+	windowsVersions = map[string]string{
+		"10.0": "10",
+		"6.3":  "8.1",
+		"6.2":  "8",
+		"6.1":  "7",
+		"6.0":  "Vista",
+		"5.1":  "XP",
+	}
+
+	windowsPattern = regexp.MustCompile(`Windows NT ([\d.]+)`)
+	iosPattern     = regexp.MustCompile(`(?:iPhone|CPU) OS (\d+)`)
+	macPattern     = regexp.MustCompile(`Mac OS X (\d+)[_.](\d+)`)
+	androidPattern = regexp.MustCompile(`Android (\d+)`)
+)
+
+// ParseUserAgent 解析浏览器、操作系统和设备类型，无法识别的字段为 "Other"
+// 只保留主版本号，避免同一浏览器因小版本不同而分散到多个分组
+func ParseUserAgent(ua string) UserAgentInfo {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return UserAgentInfo{Browser: "Other", OS: "Other", Device: DeviceUnknown}
+	}
+
+	info := UserAgentInfo{Browser: "Other", OS: parseOS(ua)}
+	for _, rule := range browserRules {
+		if m := rule.pattern.FindStringSubmatch(ua); m != nil {
+			info.Browser = rule.name
+			info.BrowserVersion = majorVersion(m[1])
+			break
+		}
+	}
+
+	// 爬虫以其名称作为浏览器，便于区分机器人流量的来源
+	if name := crawlerName(ua); name != "" {
+		info.Browser, info.BrowserVersion = name, ""
+	}
+
+	switch {
+	case isBotUserAgent(ua):
+		info.Device = DeviceBot
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		info.Device = DeviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "Android"):
+		info.Device = DeviceMobile
+	default:
+		info.Device = DeviceDesktop
+	}
+	return info
+}
+
+func parseOS(ua string) string {
+	if m := windowsPattern.FindStringSubmatch(ua); m != nil {
+		if v, ok := windowsVersions[m[1]]; ok {
+			return "Windows " + v
+		}
+		return "Windows"
+	}
+	switch {
+	case strings.Contains(ua, "HarmonyOS"):
+		return "HarmonyOS"
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		if m := iosPattern.FindStringSubmatch(ua); m != nil {
+			return "iOS " + m[1]
+		}
+		return "iOS"
+	case strings.Contains(ua, "Android"):
+		if m := androidPattern.FindStringSubmatch(ua); m != nil {
+			return "Android " + m[1]
+		}
+		return "Android"
+	case strings.Contains(ua, "CrOS"):
+		return "Chrome OS"
+	case strings.Contains(ua, "Mac OS X"):
+		// macOS 11 之后的浏览器仍然上报 10_15_7，无法区分更高版本
+		if m := macPattern.FindStringSubmatch(ua); m != nil && m[1] == "10" && m[2] != "15" {
+			return "macOS 10." + m[2]
+		}
+		return "macOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	}
+	return "Other"
+}
+
+func majorVersion(v string) string {
+	if i := strings.IndexByte(v, '.'); i > 0 {
+		return v[:i]
+	}
+	return v
+}
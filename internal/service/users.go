@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shorturl/internal/model"
+)
+
+// ErrAccountDisabled 账户已被管理员禁用
+var ErrAccountDisabled = errors.New("账户已被禁用")
+
+// UserUpdate 管理员修改用户资料，字段为nil表示不修改
+type UserUpdate struct {
+	Username *string
+	Email    *string
+}
+
+// CreateUser 管理员创建用户，未指定密码时生成临时密码并要求首次登录后修改
+// 返回的临时密码只在创建时可见
+func (s *authService) CreateUser(ctx context.Context, username, password, email, role string) (*model.User, string, error) {
+	if role == "" {
+		role = model.RoleEditor
+	}
+	if !model.ValidRole(role) {
+		return nil, "", fmt.Errorf("无效的角色: %s", role)
+	}
+
+	temporary := ""
+	if password == "" {
+		var err error
+		if temporary, err = generateTemporaryPassword(); err != nil {
+			return nil, "", err
+		}
+		password = temporary
+	} else if err := validateNewPassword(password); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.checkUsernameAvailable(ctx, username, 0); err != nil {
+		return nil, "", err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", fmt.Errorf("密码加密失败: %v", err)
+	}
+
+	user := &model.User{
+		Username:           username,
+		Password:           string(hashedPassword),
+		Email:              email,
+		Role:               role,
+		IsAdmin:            role == model.RoleAdmin,
+		MustChangePassword: temporary != "",
+	}
+	if err := s.db.WithContext(ctx).Create(user).Error; err != nil {
+		return nil, "", fmt.Errorf("创建用户失败: %v", err)
+	}
+
+	return user, temporary, nil
+}
+
+// UpdateUser 修改用户名或邮箱
+func (s *authService) UpdateUser(ctx context.Context, userID uint, update UserUpdate) (*model.User, error) {
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+
+	updates := map[string]interface{}{}
+	if update.Username != nil {
+		username := strings.TrimSpace(*update.Username)
+		if len(username) < 3 || len(username) > 64 {
+			return nil, fmt.Errorf("用户名长度应为3到64个字符")
+		}
+		if username != user.Username {
+			if err := s.checkUsernameAvailable(ctx, username, user.ID); err != nil {
+				return nil, err
+			}
+			updates["username"] = username
+		}
+	}
+	if update.Email != nil {
+		updates["email"] = strings.TrimSpace(*update.Email)
+	}
+	if len(updates) == 0 {
+		return &user, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&user).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("更新用户失败: %v", err)
+	}
+	return &user, nil
+}
+
+// SetUserPlan 修改用户套餐，plan为空表示使用默认套餐
+func (s *authService) SetUserPlan(ctx context.Context, userID uint, plan string) error {
+	if plan != "" {
+		if _, ok := s.config.Quota.Plans[plan]; !ok {
+			return fmt.Errorf("无效的套餐: %s", plan)
+		}
+	}
+
+	result := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", userID).Update("plan", plan)
+	if result.Error != nil {
+		return fmt.Errorf("更新套餐失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("用户不存在")
+	}
+	return nil
+}
+
+// SetUserDisabled 禁用或启用账户，禁用时立即吊销该用户的全部会话
+func (s *authService) SetUserDisabled(ctx context.Context, userID uint, disabled bool) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("用户不存在")
+		}
+		if disabled && user.Role == model.RoleAdmin && !user.Disabled {
+			if err := ensureOtherAdmin(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&user).Update("disabled", disabled).Error; err != nil {
+			return fmt.Errorf("更新账户状态失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil || !disabled {
+		return err
+	}
+
+	return s.RevokeUserSessions(ctx, userID)
+}
+
+// DeleteUser 删除用户及其会话、团队空间成员关系等数据
+// transferTo 不为0时将个人链接转移给该用户，否则删除个人链接；团队空间内的链接保留在空间中
+// 返回被删除的短链接，调用方负责清理缓存
+func (s *authService) DeleteUser(ctx context.Context, userID, transferTo uint) ([]string, error) {
+	var deleted []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("用户不存在")
+		}
+		if user.Role == model.RoleAdmin && !user.Disabled {
+			if err := ensureOtherAdmin(tx, user.ID); err != nil {
+				return err
+			}
+		}
+
+		// 唯一所有者删除后团队空间将无人管理，需要先转移所有权
+		var soleOwned []string
+		if err := tx.Model(&model.Workspace{}).
+			Joins("JOIN workspace_members m ON m.workspace_id = workspaces.id AND m.user_id = ? AND m.role = ?",
+				user.ID, model.WorkspaceRoleOwner).
+			Where("NOT EXISTS (SELECT 1 FROM workspace_members o WHERE o.workspace_id = workspaces.id AND o.role = ? AND o.user_id <> ?)",
+				model.WorkspaceRoleOwner, user.ID).
+			Pluck("workspaces.name", &soleOwned).Error; err != nil {
+			return fmt.Errorf("检查团队空间失败: %v", err)
+		}
+		if len(soleOwned) > 0 {
+			return fmt.Errorf("用户是团队空间「%s」的唯一所有者，请先转移所有权", strings.Join(soleOwned, "」「"))
+		}
+
+		personal := tx.Model(&model.URL{}).Where("user_id = ? AND workspace_id = 0", user.ID)
+		if transferTo != 0 {
+			if transferTo == user.ID {
+				return fmt.Errorf("不能将链接转移给被删除的用户")
+			}
+			var target model.User
+			if err := tx.First(&target, transferTo).Error; err != nil {
+				return fmt.Errorf("接收链接的用户不存在")
+			}
+			if err := personal.Update("user_id", target.ID).Error; err != nil {
+				return fmt.Errorf("转移链接失败: %v", err)
+			}
+		} else {
+			if err := personal.Pluck("short_code", &deleted).Error; err != nil {
+				return fmt.Errorf("查询用户链接失败: %v", err)
+			}
+			if err := tx.Where("user_id = ? AND workspace_id = 0", user.ID).Delete(&model.URL{}).Error; err != nil {
+				return fmt.Errorf("删除用户链接失败: %v", err)
+			}
+		}
+
+		for _, cleanup := range []struct {
+			value interface{}
+			query string
+			args  []interface{}
+		}{
+			{&model.Session{}, "user_id = ?", []interface{}{user.ID}},
+			{&model.RecoveryCode{}, "user_id = ?", []interface{}{user.ID}},
+			{&model.PasswordResetToken{}, "user_id = ?", []interface{}{user.ID}},
+			{&model.WorkspaceMember{}, "user_id = ?", []interface{}{user.ID}},
+			{&model.WorkspaceInvite{}, "invitee_id = ? AND status = ?", []interface{}{user.ID, "pending"}},
+			{&model.LoginThrottle{}, "scope = ? AND identifier = ?", []interface{}{model.LoginThrottleAccount, user.Username}},
+		} {
+			if err := tx.Where(cleanup.query, cleanup.args...).Delete(cleanup.value).Error; err != nil {
+				return fmt.Errorf("清理用户数据失败: %v", err)
+			}
+		}
+
+		// 彻底删除，释放用户名；审计日志中保留了操作者名称
+		if err := tx.Unscoped().Delete(&user).Error; err != nil {
+			return fmt.Errorf("删除用户失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// checkUsernameAvailable 检查用户名是否已被其他用户占用
+func (s *authService) checkUsernameAvailable(ctx context.Context, username string, exceptID uint) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Unscoped().Model(&model.User{}).
+		Where("username = ? AND id <> ?", username, exceptID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("检查用户失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("用户名已存在")
+	}
+	return nil
+}
+
+// ensureOtherAdmin 确认除指定用户外还有其他启用中的管理员
+// 用 SELECT ... FOR UPDATE 锁定全部启用中的管理员(包括指定用户)，并发移除管理员时依次执行，
+// 后执行的事务能看到先提交的修改；SQLite 不支持行锁，但同一时间只允许一个写事务，读取后数据被修改时写入会失败
+func ensureOtherAdmin(tx *gorm.DB, userID uint) error {
+	var admins []model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("role = ? AND disabled = ?", model.RoleAdmin, false).
+		Order("id").
+		Find(&admins).Error; err != nil {
+		return fmt.Errorf("检查管理员数量失败: %v", err)
+	}
+	for _, admin := range admins {
+		if admin.ID != userID {
+			return nil
+		}
+	}
+	return fmt.Errorf("不能移除最后一个管理员")
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"shorturl/internal/geoip"
+	"shorturl/internal/model"
+)
+
+const visitBackfillBatch = 100 // 回填时每批处理的不同User-Agent数量
+
+// enrichVisits 在写入数据库前为访问明细填充解析出的维度和地理位置，并规范化来源地址
+// 在批量写入的goroutine中执行，不占用重定向请求的时间
+func (s *urlService) enrichVisits(visits []*model.URLVisit) {
+	// 同一批次中的User-Agent和IP重复率很高，只解析一次
+	parsed := make(map[string]UserAgentInfo)
+	located := make(map[string]geoip.Location)
+	for _, visit := range visits {
+		info, ok := parsed[visit.UserAgent]
+		if !ok {
+			info = ParseUserAgent(visit.UserAgent)
+			parsed[visit.UserAgent] = info
+		}
+		applyUserAgent(visit, info)
+		if s.config.Privacy.DiscardUserAgent {
+			// 只保留解析出的浏览器、系统和设备
+			visit.UserAgent = ""
+		}
+		applyReferer(visit, ParseReferer(visit.RefererURL))
+
+		// 按访问者的原始IP查询地理位置，明细中的IP可能已截断或哈希
+		ip := visit.ClientIP
+		if ip == "" {
+			ip = visit.IP
+		}
+		loc, ok := located[ip]
+		if !ok {
+			loc = s.geo.Lookup(ip)
+			located[ip] = loc
+		}
+		visit.Country = loc.Country
+		visit.Region = loc.Region
+		visit.City = loc.City
+	}
+}
+
+func applyUserAgent(visit *model.URLVisit, info UserAgentInfo) {
+	visit.Browser = info.Browser
+	visit.BrowserVersion = info.BrowserVersion
+	visit.OS = info.OS
+	visit.Device = info.Device
+}
+
+func applyReferer(visit *model.URLVisit, info RefererInfo) {
+	visit.RefererURL = info.URL
+	visit.RefererDomain = info.Domain
+	visit.RefererCategory = info.Category
+}
+
+// backfillVisitDimensions 为升级前写入、尚未解析User-Agent的访问明细补充维度，并标记其中的爬虫访问
+// 相同User-Agent的明细用一条UPDATE处理，完成后不再重复执行
+func (s *urlService) backfillVisitDimensions(ctx context.Context) {
+	start := time.Now()
+
+	// 已解析出爬虫设备类型、但写入时尚未识别机器人访问的明细
+	if err := s.db.WithContext(ctx).Model(&model.URLVisit{}).
+		Where("device = ? AND bot = ?", DeviceBot, false).
+		Updates(map[string]interface{}{"bot": true, "bot_reason": BotReasonCrawler}).Error; err != nil {
+		if ctx.Err() == nil {
+			logrus.Errorf("标记历史机器人访问失败: %v", err)
+		}
+		return
+	}
+
+	var updated int64
+	for {
+		var userAgents []string
+		if err := s.db.WithContext(ctx).Raw(
+			"SELECT DISTINCT COALESCE(user_agent, '') FROM url_visits WHERE device IS NULL OR device = '' LIMIT ?",
+			visitBackfillBatch).Scan(&userAgents).Error; err != nil {
+			if ctx.Err() == nil {
+				logrus.Errorf("查询待解析的访问记录失败: %v", err)
+			}
+			return
+		}
+		if len(userAgents) == 0 {
+			break
+		}
+
+		for _, ua := range userAgents {
+			info := ParseUserAgent(ua)
+			updates := map[string]interface{}{
+				"browser":         info.Browser,
+				"browser_version": info.BrowserVersion,
+				"os":              info.OS,
+				"device":          info.Device,
+			}
+			// 历史明细只能根据User-Agent识别爬虫
+			if info.Device == DeviceBot {
+				updates["bot"] = true
+				updates["bot_reason"] = BotReasonCrawler
+			}
+			result := s.db.WithContext(ctx).Model(&model.URLVisit{}).
+				Where("(device IS NULL OR device = '') AND COALESCE(user_agent, '') = ?", ua).
+				Updates(updates)
+			if result.Error != nil {
+				if ctx.Err() == nil {
+					logrus.Errorf("回填访问记录的User-Agent维度失败: %v", result.Error)
+				}
+				return
+			}
+			updated += result.RowsAffected
+		}
+	}
+
+	if updated > 0 {
+		logrus.Infof("已为 %d 条历史访问记录解析User-Agent，耗时 %v", updated, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// backfillReferers 为升级前写入的访问明细规范化来源地址并识别来源域名和类型，相同来源的明细用一条UPDATE处理
+func (s *urlService) backfillReferers(ctx context.Context) {
+	start := time.Now()
+	var updated int64
+	for {
+		var referers []string
+		if err := s.db.WithContext(ctx).Raw(
+			"SELECT DISTINCT COALESCE(referer_url, '') FROM url_visits WHERE referer_category IS NULL OR referer_category = '' LIMIT ?",
+			visitBackfillBatch).Scan(&referers).Error; err != nil {
+			if ctx.Err() == nil {
+				logrus.Errorf("查询待规范化来源的访问记录失败: %v", err)
+			}
+			return
+		}
+		if len(referers) == 0 {
+			break
+		}
+
+		for _, referer := range referers {
+			info := ParseReferer(referer)
+			result := s.db.WithContext(ctx).Model(&model.URLVisit{}).
+				Where("(referer_category IS NULL OR referer_category = '') AND COALESCE(referer_url, '') = ?", referer).
+				Updates(map[string]interface{}{
+					"referer_url":      info.URL,
+					"referer_domain":   info.Domain,
+					"referer_category": info.Category,
+				})
+			if result.Error != nil {
+				if ctx.Err() == nil {
+					logrus.Errorf("回填访问记录的来源失败: %v", result.Error)
+				}
+				return
+			}
+			updated += result.RowsAffected
+		}
+	}
+
+	if updated > 0 {
+		logrus.Infof("已为 %d 条历史访问记录规范化来源，耗时 %v", updated, time.Since(start).Round(time.Millisecond))
+	}
+}
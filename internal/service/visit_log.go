@@ -0,0 +1,112 @@
+package service
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"shorturl/config"
+)
+
+// 访问明细的记录方式
+const (
+	VisitLoggingFull       = "full"
+	VisitLoggingSampled    = "sampled"
+	VisitLoggingCountsOnly = "counts_only"
+)
+
+const (
+	defaultVisitSampleRate  = 0.1
+	visitLossReportInterval = time.Minute // 丢弃或写入失败的告警日志最短间隔
+)
+
+// VisitLogStats 访问明细的记录情况，计数从服务启动时开始
+type VisitLogStats struct {
+	Mode       string  `json:"mode"`
+	SampleRate float64 `json:"sample_rate"`
+	Tracked    int64   `json:"tracked"`  // 访问次数，包括未记录明细的访问
+	Recorded   int64   `json:"recorded"` // 已写入数据库的明细
+	Dropped    int64   `json:"dropped"`  // 缓冲区已满被丢弃的明细
+	Failed     int64   `json:"failed"`   // 写入数据库失败的明细
+	Buffered   int     `json:"buffered"` // 等待写入的明细
+}
+
+// visitLogger 决定哪些访问记录明细，并统计明细的去向
+type visitLogger struct {
+	mode       string
+	sampleRate float64
+
+	tracked  atomic.Int64
+	recorded atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+
+	lastLosses   int64 // 上次告警时的丢弃和失败总数，只由批处理goroutine访问
+	lastReported time.Time
+}
+
+func newVisitLogger(cfg config.AnalyticsConfig) *visitLogger {
+	l := &visitLogger{mode: cfg.VisitLogging, sampleRate: cfg.SampleRate}
+	switch l.mode {
+	case "":
+		l.mode = VisitLoggingFull
+	case VisitLoggingFull, VisitLoggingCountsOnly:
+	case VisitLoggingSampled:
+		if l.sampleRate <= 0 || l.sampleRate > 1 {
+			logrus.Warnf("访问明细抽样比例 %v 无效，使用默认值 %v", l.sampleRate, defaultVisitSampleRate)
+			l.sampleRate = defaultVisitSampleRate
+		}
+	default:
+		logrus.Warnf("未知的访问明细记录方式 %q，将记录全部明细", l.mode)
+		l.mode = VisitLoggingFull
+	}
+	if l.mode != VisitLoggingSampled {
+		l.sampleRate = 0
+	}
+	return l
+}
+
+// sample 判断本次访问是否记录明细，返回该条明细代表的访问次数
+func (l *visitLogger) sample() (float64, bool) {
+	l.tracked.Add(1)
+	switch l.mode {
+	case VisitLoggingCountsOnly:
+		return 0, false
+	case VisitLoggingSampled:
+		if rand.Float64() >= l.sampleRate {
+			return 0, false
+		}
+		return 1 / l.sampleRate, true
+	}
+	return 1, true
+}
+
+// reportLosses 有明细被丢弃或写入失败时输出告警，避免持续过载时刷屏
+func (l *visitLogger) reportLosses() {
+	dropped, failed := l.dropped.Load(), l.failed.Load()
+	if dropped+failed == l.lastLosses || time.Since(l.lastReported) < visitLossReportInterval {
+		return
+	}
+	logrus.Warnf("访问明细丢失: 缓冲区已满丢弃 %d 条，写入失败 %d 条(启动以来累计)", dropped, failed)
+	l.lastLosses = dropped + failed
+	l.lastReported = time.Now()
+}
+
+// VisitLogStats 返回访问明细的记录情况
+func (s *urlService) VisitLogStats() VisitLogStats {
+	s.visitMutex.Lock()
+	batched := len(s.visitBatch)
+	s.visitMutex.Unlock()
+
+	return VisitLogStats{
+		Mode:       s.visitLog.mode,
+		SampleRate: s.visitLog.sampleRate,
+		Tracked:    s.visitLog.tracked.Load(),
+		Recorded:   s.visitLog.recorded.Load(),
+		Dropped:    s.visitLog.dropped.Load(),
+		Failed:     s.visitLog.failed.Load(),
+		Buffered:   len(s.visitChan) + batched,
+	}
+}
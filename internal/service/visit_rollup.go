@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"shorturl/internal/model"
+)
+
+const (
+	rollupInterval = time.Minute
+	// rollupDelay 只汇总写入时间(RecordedAt)早于该时长的明细，汇总进度按ID推进，遇到较新的明细就停止。
+	// 多个实例同时写入时，ID较小的明细可能晚于ID较大的明细提交；每批写入限时 visitWriteTimeout，
+	// 超时即回滚，因此写入时间早于截止时间的明细之前分配的ID都已提交或已放弃，不会被汇总进度跳过。
+	// 各实例的时钟偏差须远小于 rollupDelay 与 visitWriteTimeout 之差
+	rollupDelay      = time.Second * 30
+	rollupBatchSize  = 5000 // 每次汇总的明细条数
+	rollupStateName  = "url_visits"
+	rollupDayFormat  = "2006-01-02"
+	rollupValueLimit = 512 // 维度值的最大长度，超出部分截断
+	pruneInterval    = time.Hour
+	pruneBatchSize   = 5000 // 每次删除的明细条数，避免长时间锁表
+)
+
+// 汇总统计的维度
+const (
+	DimensionReferer         = "referer"
+	DimensionRefererDomain   = "referer_domain"
+	DimensionRefererCategory = "referer_category" // direct、search、social、email 或 referral
+	DimensionUserAgent       = "user_agent"
+	DimensionBrowser         = "browser"
+	DimensionBrowserVersion  = "browser_version" // 浏览器及主版本号，如 "Chrome 120"
+	DimensionOS              = "os"
+	DimensionDevice          = "device"
+	DimensionCountry         = "country"
+	DimensionRegion          = "region" // 国家代码和地区名称，如 "CN 广东"
+	DimensionCity            = "city"   // 国家代码和城市名称，如 "CN 深圳"
+	DimensionBotReason       = "bot_reason"
+	DimensionBotAgent        = "bot_agent" // 爬虫名称，无头浏览器等为浏览器名称
+)
+
+// visitDimension 维度在访问明细中的取值方式，汇总时在Go中计算，查询未汇总的明细时使用SQL表达式，两者须保持一致
+type visitDimension struct {
+	bot    bool // 统计机器人访问还是正常访问
+	column string
+	value  func(v *model.URLVisit) string
+}
+
+var visitDimensions = map[string]visitDimension{
+	DimensionReferer: {column: "SUBSTR(referer_url, 1, " + strconv.Itoa(rollupValueLimit) + ")", value: func(v *model.URLVisit) string {
+		return truncateRunes(v.RefererURL, rollupValueLimit)
+	}},
+	DimensionRefererDomain:   {column: "referer_domain", value: func(v *model.URLVisit) string { return v.RefererDomain }},
+	DimensionRefererCategory: {column: "referer_category", value: func(v *model.URLVisit) string { return v.RefererCategory }},
+	DimensionUserAgent:       {column: "user_agent", value: func(v *model.URLVisit) string { return v.UserAgent }},
+	DimensionBrowser:         {column: "browser", value: func(v *model.URLVisit) string { return v.Browser }},
+	DimensionBrowserVersion: {column: pairColumn("browser", "browser_version"), value: func(v *model.URLVisit) string {
+		return pairValue(v.Browser, v.BrowserVersion)
+	}},
+	DimensionOS:      {column: "os", value: func(v *model.URLVisit) string { return v.OS }},
+	DimensionDevice:  {column: "device", value: func(v *model.URLVisit) string { return v.Device }},
+	DimensionCountry: {column: "country", value: func(v *model.URLVisit) string { return v.Country }},
+	DimensionRegion: {column: pairColumn("country", "region"), value: func(v *model.URLVisit) string {
+		return pairValue(v.Country, v.Region)
+	}},
+	DimensionCity: {column: pairColumn("country", "city"), value: func(v *model.URLVisit) string {
+		return pairValue(v.Country, v.City)
+	}},
+	DimensionBotReason: {bot: true, column: "bot_reason", value: func(v *model.URLVisit) string { return v.BotReason }},
+	DimensionBotAgent:  {bot: true, column: "browser", value: func(v *model.URLVisit) string { return v.Browser }},
+}
+
+// pairColumn 两列以空格连接，第二列为空时为空字符串
+func pairColumn(parent, column string) string {
+	return "CASE WHEN " + column + " <> '' THEN TRIM(" + parent + " || ' ' || " + column + ") ELSE '' END"
+}
+
+func pairValue(parent, value string) string {
+	if value == "" {
+		return ""
+	}
+	return strings.TrimSpace(parent + " " + value)
+}
+
+func truncateRunes(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit])
+}
+
+var errRollupConflict = errors.New("访问明细已被其他实例汇总或已被删除")
+
+// runRollups 汇总任务: 先补充历史明细的维度和来源，再定期把新写入的明细汇总到汇总表，并删除超过保留天数的明细
+func (s *urlService) runRollups(ctx context.Context) {
+	s.backfillVisitDimensions(ctx)
+	s.backfillReferers(ctx)
+
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		s.rollupVisits(ctx)
+		if s.config.Analytics.VisitRetentionDays > 0 && time.Since(lastPrune) >= pruneInterval {
+			s.pruneVisits(ctx, s.config.Analytics.VisitRetentionDays)
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rollupVisits 汇总所有待汇总的明细
+func (s *urlService) rollupVisits(ctx context.Context) {
+	start := time.Now()
+	var total int
+	for ctx.Err() == nil {
+		n, err := s.rollupBatch(ctx)
+		if errors.Is(err, errRollupConflict) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.Errorf("汇总访问明细失败: %v", err)
+			}
+			break
+		}
+		total += n
+		if n < rollupBatchSize {
+			break
+		}
+	}
+	if total >= rollupBatchSize {
+		logrus.Infof("已汇总 %d 条访问明细，耗时 %v", total, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// rollupCursor 返回已汇总的最后一条明细ID
+func (s *urlService) rollupCursor(ctx context.Context) (uint, error) {
+	state := model.RollupState{Name: rollupStateName}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&state).Error; err != nil {
+		return 0, err
+	}
+	if err := s.db.WithContext(ctx).Where("name = ?", rollupStateName).Take(&state).Error; err != nil {
+		return 0, err
+	}
+	return state.LastVisitID, nil
+}
+
+type hourlyRollupKey struct {
+	urlID uint
+	hour  time.Time
+}
+
+type dailyRollupKey struct {
+	urlID     uint
+	day       string
+	dimension string
+	value     string
+}
+
+// rollupBatch 按ID顺序汇总一批明细，返回汇总的条数
+// 汇总结果和进度在同一事务中写入，进度已被其他实例更新或明细已被删除时放弃本次结果
+func (s *urlService) rollupBatch(ctx context.Context) (int, error) {
+	cursor, err := s.rollupCursor(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var visits []*model.URLVisit
+	if err := s.db.WithContext(ctx).Where("id > ?", cursor).Order("id").Limit(rollupBatchSize).Find(&visits).Error; err != nil {
+		return 0, err
+	}
+	// 汇总进度只能连续推进，遇到刚写入的明细就停止，下次再汇总；升级前写入的明细没有写入时间，均已提交
+	cutoff := time.Now().Add(-rollupDelay)
+	for i, v := range visits {
+		if v.RecordedAt != nil && !v.RecordedAt.Before(cutoff) {
+			visits = visits[:i]
+			break
+		}
+	}
+	if len(visits) == 0 {
+		return 0, nil
+	}
+
+	hourly := make(map[hourlyRollupKey]*model.HourlyVisitRollup)
+	daily := make(map[dailyRollupKey]float64)
+	for _, v := range visits {
+		hour := v.CreatedAt.UTC().Truncate(time.Hour)
+		h, ok := hourly[hourlyRollupKey{v.URLID, hour}]
+		if !ok {
+			h = &model.HourlyVisitRollup{URLID: v.URLID, Hour: hour}
+			hourly[hourlyRollupKey{v.URLID, hour}] = h
+		}
+		h.Records++
+		if v.Bot {
+			h.Bots += v.Weight
+		} else {
+			h.Visits += v.Weight
+		}
+
+		day := hour.Format(rollupDayFormat)
+		for name, d := range visitDimensions {
+			if d.bot != v.Bot {
+				continue
+			}
+			if value := d.value(v); value != "" {
+				daily[dailyRollupKey{v.URLID, day, name, value}] += v.Weight
+			}
+		}
+	}
+
+	hourlyRows := make([]*model.HourlyVisitRollup, 0, len(hourly))
+	for _, h := range hourly {
+		hourlyRows = append(hourlyRows, h)
+	}
+	dailyRows := make([]*model.DailyVisitRollup, 0, len(daily))
+	for k, count := range daily {
+		dailyRows = append(dailyRows, &model.DailyVisitRollup{URLID: k.urlID, Day: k.day, Dimension: k.dimension, Value: k.value, Count: count})
+	}
+
+	last := visits[len(visits)-1].ID
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.RollupState{}).
+			Where("name = ? AND last_visit_id = ?", rollupStateName, cursor).
+			Update("last_visit_id", last)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRollupConflict
+		}
+		// 读取后被删除的明细(见 EraseURLVisits)不能再计入汇总，放弃本次结果重新读取
+		var remaining int64
+		if err := tx.Model(&model.URLVisit{}).Where("id > ? AND id <= ?", cursor, last).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining != int64(len(visits)) {
+			return errRollupConflict
+		}
+
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "url_id"}, {Name: "hour"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"visits":  gorm.Expr("hourly_visit_rollups.visits + excluded.visits"),
+				"bots":    gorm.Expr("hourly_visit_rollups.bots + excluded.bots"),
+				"records": gorm.Expr("hourly_visit_rollups.records + excluded.records"),
+			}),
+		}).CreateInBatches(hourlyRows, maxBatchSize).Error; err != nil {
+			return err
+		}
+
+		if len(dailyRows) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "url_id"}, {Name: "day"}, {Name: "dimension"}, {Name: "value"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("daily_visit_rollups.count + excluded.count")}),
+		}).CreateInBatches(dailyRows, maxBatchSize).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(visits), nil
+}
+
+// pruneVisits 删除超过保留天数且已汇总的访问明细，汇总表中的数据一直保留
+func (s *urlService) pruneVisits(ctx context.Context, retentionDays int) {
+	cursor, err := s.rollupCursor(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.Errorf("查询访问明细汇总进度失败: %v", err)
+		}
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	var pruned int64
+	for ctx.Err() == nil {
+		expired := s.db.Model(&model.URLVisit{}).Select("id").
+			Where("id <= ? AND created_at < ?", cursor, cutoff).
+			Limit(pruneBatchSize)
+		result := s.db.WithContext(ctx).Where("id IN (?)", expired).Delete(&model.URLVisit{})
+		if result.Error != nil {
+			if ctx.Err() == nil {
+				logrus.Errorf("清理过期的访问明细失败: %v", result.Error)
+			}
+			break
+		}
+		pruned += result.RowsAffected
+		if result.RowsAffected < pruneBatchSize {
+			break
+		}
+	}
+
+	if pruned > 0 {
+		logrus.Infof("已删除 %d 条超过 %d 天的访问明细", pruned, retentionDays)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"shorturl/internal/model"
+)
+
+func TestRollupBatch(t *testing.T) {
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	day := hour.Format(rollupDayFormat)
+	committed := time.Now().Add(-time.Minute)
+	recent := time.Now()
+
+	visit := func(id uint, recordedAt *time.Time) model.URLVisit {
+		return model.URLVisit{ID: id, URLID: 1, Weight: 1, Browser: "Chrome", CreatedAt: hour.Add(time.Duration(id) * time.Minute), RecordedAt: recordedAt}
+	}
+
+	tests := []struct {
+		name     string
+		visits   []model.URLVisit
+		existing float64 // 汇总表中已有的访问量
+		// afterRead 读取明细后、写入汇总前执行，模拟其他实例或删除操作
+		afterRead   func(db *gorm.DB) error
+		wantN       int
+		wantErr     error
+		wantCursor  uint
+		wantVisits  float64
+		wantBrowser float64
+	}{
+		{
+			name:        "汇总已提交的明细",
+			visits:      []model.URLVisit{visit(1, &committed), visit(2, &committed), visit(3, &committed)},
+			wantN:       3,
+			wantCursor:  3,
+			wantVisits:  3,
+			wantBrowser: 3,
+		},
+		{
+			name:        "遇到刚写入的明细停止",
+			visits:      []model.URLVisit{visit(1, &committed), visit(2, &committed), visit(3, &recent), visit(4, &committed)},
+			wantN:       2,
+			wantCursor:  2,
+			wantVisits:  2,
+			wantBrowser: 2,
+		},
+		{
+			name:        "升级前没有写入时间的明细直接汇总",
+			visits:      []model.URLVisit{visit(1, nil), visit(2, nil)},
+			wantN:       2,
+			wantCursor:  2,
+			wantVisits:  2,
+			wantBrowser: 2,
+		},
+		{
+			name:        "累加到已有的汇总",
+			visits:      []model.URLVisit{visit(1, &committed), visit(2, &committed)},
+			existing:    5,
+			wantN:       2,
+			wantCursor:  2,
+			wantVisits:  7,
+			wantBrowser: 7,
+		},
+		{
+			name:   "进度已被其他实例推进",
+			visits: []model.URLVisit{visit(1, &committed), visit(2, &committed)},
+			afterRead: func(db *gorm.DB) error {
+				return db.Model(&model.RollupState{}).Where("name = ?", rollupStateName).Update("last_visit_id", 1).Error
+			},
+			wantErr:    errRollupConflict,
+			wantCursor: 1,
+		},
+		{
+			name:   "读取后明细被删除",
+			visits: []model.URLVisit{visit(1, &committed), visit(2, &committed)},
+			afterRead: func(db *gorm.DB) error {
+				return db.Delete(&model.URLVisit{}, 2).Error
+			},
+			wantErr:    errRollupConflict,
+			wantCursor: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDB(t, &model.URLVisit{}, &model.HourlyVisitRollup{}, &model.DailyVisitRollup{}, &model.RollupState{})
+			s := &urlService{db: db}
+
+			if err := db.Create(&tt.visits).Error; err != nil {
+				t.Fatalf("写入访问明细失败: %v", err)
+			}
+			if tt.existing > 0 {
+				if err := db.Create(&model.HourlyVisitRollup{URLID: 1, Hour: hour, Visits: tt.existing, Records: int64(tt.existing)}).Error; err != nil {
+					t.Fatalf("写入小时汇总失败: %v", err)
+				}
+				if err := db.Create(&model.DailyVisitRollup{URLID: 1, Day: day, Dimension: DimensionBrowser, Value: "Chrome", Count: tt.existing}).Error; err != nil {
+					t.Fatalf("写入每日汇总失败: %v", err)
+				}
+			}
+
+			if tt.afterRead != nil {
+				// 只在第一次读取明细(即汇总前读取的那一批)之后执行
+				done := false
+				if err := db.Callback().Query().After("gorm:query").Register("test:after_read", func(tx *gorm.DB) {
+					if done || tx.Statement.Table != "url_visits" {
+						return
+					}
+					done = true
+					if err := tt.afterRead(tx.Session(&gorm.Session{NewDB: true})); err != nil {
+						t.Errorf("模拟并发修改失败: %v", err)
+					}
+				}); err != nil {
+					t.Fatalf("注册回调失败: %v", err)
+				}
+			}
+
+			n, err := s.rollupBatch(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("rollupBatch() error = %v，期望 %v", err, tt.wantErr)
+			}
+			if n != tt.wantN {
+				t.Fatalf("rollupBatch() = %d，期望 %d", n, tt.wantN)
+			}
+
+			cursor, err := s.rollupCursor(ctx)
+			if err != nil {
+				t.Fatalf("查询汇总进度失败: %v", err)
+			}
+			if cursor != tt.wantCursor {
+				t.Fatalf("汇总进度 = %d，期望 %d", cursor, tt.wantCursor)
+			}
+
+			var visits, browser float64
+			if err := db.Model(&model.HourlyVisitRollup{}).Where("url_id = ?", 1).
+				Select("COALESCE(SUM(visits), 0)").Scan(&visits).Error; err != nil {
+				t.Fatalf("查询小时汇总失败: %v", err)
+			}
+			if err := db.Model(&model.DailyVisitRollup{}).
+				Where("url_id = ? AND dimension = ? AND value = ?", 1, DimensionBrowser, "Chrome").
+				Select("COALESCE(SUM(count), 0)").Scan(&browser).Error; err != nil {
+				t.Fatalf("查询每日汇总失败: %v", err)
+			}
+			wantVisits, wantBrowser := tt.wantVisits, tt.wantBrowser
+			if tt.wantErr != nil {
+				// 放弃的批次不能写入任何汇总
+				wantVisits, wantBrowser = tt.existing, tt.existing
+			}
+			if visits != wantVisits || browser != wantBrowser {
+				t.Fatalf("汇总访问量 = %v，浏览器维度 = %v，期望 %v 和 %v", visits, browser, wantVisits, wantBrowser)
+			}
+		})
+	}
+}
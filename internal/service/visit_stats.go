@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"shorturl/internal/model"
+)
+
+// 统计的时间粒度
+const (
+	IntervalHour  = "hour"
+	IntervalDay   = "day"
+	IntervalWeek  = "week" // 周一开始
+	IntervalMonth = "month"
+)
+
+const (
+	maxStatsBuckets  = 1000 // 时间序列的最大点数
+	hourBucketFormat = "2006-01-02 15:04:05"
+)
+
+// StatsRange 统计的时间范围 [From, To)、粒度和时区
+type StatsRange struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	Location *time.Location
+}
+
+// ParseStatsRange 解析统计的时间范围参数
+// from、to 为 YYYY-MM-DD(tz 时区的日期，包含 to 当天)或 RFC3339 时间，未指定 from 时统计截至 to 的 defaultDays 天，
+// 未指定 to 时截至今天；interval 为 hour、day、week 或 month，默认 day；tz 为 IANA 时区名称，默认服务器时区
+func ParseStatsRange(from, to, interval, tz string, defaultDays int) (StatsRange, error) {
+	r := StatsRange{Interval: interval, Location: time.Local}
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return r, fmt.Errorf("无效的时区: %s", tz)
+		}
+		r.Location = loc
+	}
+
+	switch r.Interval {
+	case "":
+		r.Interval = IntervalDay
+	case IntervalHour, IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		return r, fmt.Errorf("无效的时间粒度: %s，可选 hour、day、week、month", interval)
+	}
+
+	var err error
+	if r.To, err = parseRangeTime(to, r.Location, true); err != nil {
+		return r, fmt.Errorf("无效的结束时间: %s", to)
+	}
+	if r.To.IsZero() {
+		r.To = startOfDay(time.Now().In(r.Location)).AddDate(0, 0, 1)
+	}
+	if r.From, err = parseRangeTime(from, r.Location, false); err != nil {
+		return r, fmt.Errorf("无效的开始时间: %s", from)
+	}
+	if r.From.IsZero() {
+		r.From = startOfDay(r.To.Add(-time.Nanosecond)).AddDate(0, 0, 1-defaultDays)
+	}
+
+	if !r.From.Before(r.To) {
+		return r, fmt.Errorf("开始时间必须早于结束时间")
+	}
+	buckets := 0
+	for b := r.bucketStart(r.From); b.Before(r.To); b = r.nextBucket(b) {
+		if buckets++; buckets > maxStatsBuckets {
+			return r, fmt.Errorf("时间范围内的数据点超过 %d 个，请缩小范围或使用更大的时间粒度", maxStatsBuckets)
+		}
+	}
+	return r, nil
+}
+
+// TimezoneName 时区名称，未指定时区时为服务器时区的名称
+func (r StatsRange) TimezoneName() string {
+	if r.Location == time.Local {
+		name, _ := time.Now().Zone()
+		return name
+	}
+	return r.Location.String()
+}
+
+// parseRangeTime 解析日期或时间，日期作为结束时间时取次日零点，使该日包含在范围内
+func parseRangeTime(value string, loc *time.Location, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(loc), nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// bucketStart 返回时间所在时间段的起点
+// 明细按UTC整点汇总，时区与UTC相差非整小时时，小时粒度的时间段按UTC整点划分
+func (r StatsRange) bucketStart(t time.Time) time.Time {
+	t = t.In(r.Location)
+	switch r.Interval {
+	case IntervalHour:
+		return t.Truncate(time.Hour)
+	case IntervalWeek:
+		day := startOfDay(t)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case IntervalMonth:
+		y, m, _ := t.Date()
+		return time.Date(y, m, 1, 0, 0, 0, 0, r.Location)
+	}
+	return startOfDay(t)
+}
+
+func (r StatsRange) nextBucket(t time.Time) time.Time {
+	switch r.Interval {
+	case IntervalHour:
+		return t.Add(time.Hour)
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// bucketLabel 时间段的显示名称: 小时为 "2006-01-02 15:04"，日和周为起始日期，月为 "2006-01"
+func (r StatsRange) bucketLabel(t time.Time) string {
+	switch r.Interval {
+	case IntervalHour:
+		return t.Format("2006-01-02 15:04")
+	case IntervalMonth:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// uniqueDays 时间段对应的独立访客数据日期
+// 独立访客按服务器时区的自然日记录，取起点落在时间段内的日期，小时粒度没有对应的数据
+func uniqueDays(from, to time.Time) []string {
+	var days []string
+	day := startOfDay(from.In(time.Local))
+	if day.Before(from) {
+		day = day.AddDate(0, 0, 1)
+	}
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(uniqueDayFormat))
+	}
+	return days
+}
+
+// LinkSet 参与统计的链接: 指定的链接ID，或查询链接ID的子查询
+// 统计某个用户或团队空间的全部链接时使用 Query，在数据库中以子查询筛选，不必先取出全部ID
+type LinkSet struct {
+	IDs   []uint
+	Query *gorm.DB // 如 db.Model(&model.URL{}).Where("user_id = ?", id).Select("id")，不为nil时忽略 IDs
+}
+
+func (l LinkSet) empty() bool {
+	return l.Query == nil && len(l.IDs) == 0
+}
+
+// arg 返回用于 url_id IN ? 的参数
+func (l LinkSet) arg() interface{} {
+	if l.Query != nil {
+		return gorm.Expr("(?)", l.Query)
+	}
+	return l.IDs
+}
+
+// ids 返回全部链接ID，Query 不为nil时查询数据库
+func (l LinkSet) ids(ctx context.Context) ([]uint, error) {
+	if l.Query == nil {
+		return l.IDs, nil
+	}
+	var ids []uint
+	err := l.Query.WithContext(ctx).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// visitScope 参与统计的访问: 指定链接在时间范围内的访问
+// 已汇总的部分从汇总表读取，汇总进度之后的明细直接查询 url_visits
+type visitScope struct {
+	urls     interface{} // url_id IN ? 的参数，见 LinkSet.arg
+	from     time.Time   // 时间范围 [from, to)，已转换为服务器时区，用于查询明细
+	to       time.Time
+	hourFrom time.Time // 按小时汇总的UTC时间范围
+	hourTo   time.Time
+	dayFrom  string // 按天汇总的UTC日期范围 [dayFrom, dayTo)
+	dayTo    string
+	cursor   uint // 已汇总的最后一条明细
+}
+
+func (s *urlService) newVisitScope(ctx context.Context, links LinkSet, r StatsRange) visitScope {
+	cursor, err := s.rollupCursor(ctx)
+	if err != nil {
+		logrus.Warnf("查询访问明细汇总进度失败: %v", err)
+	}
+	dayFrom, dayTo := rollupDays(r.From, r.To)
+	return visitScope{
+		urls: links.arg(),
+		// SQLite 以文本保存时间，明细按写入时的服务器时区比较，汇总表统一使用UTC
+		from:     r.From.In(time.Local),
+		to:       r.To.In(time.Local),
+		hourFrom: r.From.UTC(),
+		hourTo:   r.To.UTC(),
+		dayFrom:  dayFrom,
+		dayTo:    dayTo,
+		cursor:   cursor,
+	}
+}
+
+// rollupDays 按天汇总的数据只能整天统计，取起点落在时间范围内的UTC日期，范围内没有整点零时时取开始时间所在的一天
+func rollupDays(from, to time.Time) (string, string) {
+	ceil := func(t time.Time) time.Time {
+		day := startOfDay(t.UTC())
+		if day.Before(t) {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day
+	}
+	start, end := ceil(from), ceil(to)
+	if !start.Before(end) {
+		start = startOfDay(from.UTC())
+		end = start.AddDate(0, 0, 1)
+	}
+	return start.Format(rollupDayFormat), end.Format(rollupDayFormat)
+}
+
+// tail 返回尚未汇总的明细的筛选条件和参数
+func (v visitScope) tail() (string, []interface{}) {
+	return "id > ? AND url_id IN ? AND created_at >= ? AND created_at < ?",
+		[]interface{}{v.cursor, v.urls, v.from, v.to}
+}
+
+// where 在 tail 的基础上指定统计机器人访问还是正常访问
+func (v visitScope) where(bot bool) (string, []interface{}) {
+	where, args := v.tail()
+	return where + " AND bot = ?", append(args, bot)
+}
+
+// hourExpr 返回将访问时间截断到UTC整点的文本表达式
+func (s *urlService) hourExpr() string {
+	if s.db.Dialector.Name() == "postgres" {
+		return "to_char(date_trunc('hour', created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD HH24:MI:SS')"
+	}
+	// SQLite 的日期函数会将带时区的时间转换为UTC
+	return "strftime('%Y-%m-%d %H:00:00', created_at)"
+}
+
+// VisitSeries 按粒度汇总多个链接的访问量和独立访客数，没有访问的时间段补0
+func (s *urlService) VisitSeries(ctx context.Context, links LinkSet, r StatsRange) []model.DailyVisit {
+	counts := make(map[string]float64)
+	if !links.empty() {
+		scope := s.newVisitScope(ctx, links, r)
+
+		var rollups []model.HourlyVisitRollup
+		s.db.WithContext(ctx).Select("hour, SUM(visits) as visits").
+			Where("url_id IN ? AND hour >= ? AND hour < ?", scope.urls, scope.hourFrom, scope.hourTo).
+			Group("hour").Find(&rollups)
+		for _, h := range rollups {
+			counts[r.bucketLabel(r.bucketStart(h.Hour))] += h.Visits
+		}
+
+		where, args := scope.where(false)
+		var hours []struct {
+			Hour  string
+			Count float64
+		}
+		s.db.WithContext(ctx).Raw(fmt.Sprintf(`
+			SELECT
+				%s as hour,
+				SUM(weight) as count
+			FROM url_visits
+			WHERE %s
+			GROUP BY 1`, s.hourExpr(), where), args...).Scan(&hours)
+		// 按整点汇总后再归入所在时区的时间段
+		for _, h := range hours {
+			t, err := time.ParseInLocation(hourBucketFormat, h.Hour, time.UTC)
+			if err != nil {
+				continue
+			}
+			counts[r.bucketLabel(r.bucketStart(t))] += h.Count
+		}
+	}
+
+	series := make([]model.DailyVisit, 0)
+	var dayGroups [][]string
+	for b := r.bucketStart(r.From); b.Before(r.To); b = r.nextBucket(b) {
+		label := r.bucketLabel(b)
+		series = append(series, model.DailyVisit{Date: label, Count: int64(counts[label] + 0.5)})
+		dayGroups = append(dayGroups, uniqueDays(b, r.nextBucket(b)))
+	}
+	// 各时间段的独立访客数一次查出，没有对应日期的时间段为0
+	for i, n := range s.uniques.countEach(ctx, links, dayGroups) {
+		series[i].Uniques = n
+	}
+	return series
+}
+
+// VisitCounts 统计时间范围内每个链接的访问量，不含机器人访问，没有访问的链接不在结果中
+func (s *urlService) VisitCounts(ctx context.Context, urlIDs []uint, r StatsRange) map[uint]int64 {
+	result := make(map[uint]int64)
+	if len(urlIDs) == 0 {
+		return result
+	}
+	scope := s.newVisitScope(ctx, LinkSet{IDs: urlIDs}, r)
+
+	var rows []struct {
+		URLID uint
+		Count float64
+	}
+	s.db.WithContext(ctx).Model(&model.HourlyVisitRollup{}).
+		Select("url_id, SUM(visits) as count").
+		Where("url_id IN ? AND hour >= ? AND hour < ?", scope.urls, scope.hourFrom, scope.hourTo).
+		Group("url_id").Scan(&rows)
+	counts := make(map[uint]float64)
+	for _, row := range rows {
+		counts[row.URLID] += row.Count
+	}
+
+	rows = nil
+	where, args := scope.where(false)
+	s.db.WithContext(ctx).Model(&model.URLVisit{}).
+		Select("url_id, SUM(weight) as count").
+		Where(where, args...).
+		Group("url_id").Scan(&rows)
+	for _, row := range rows {
+		counts[row.URLID] += row.Count
+	}
+
+	for id, count := range counts {
+		if n := int64(count + 0.5); n > 0 {
+			result[id] = n
+		}
+	}
+	return result
+}
+
+// VisitBreakdown 统计多个链接在时间范围内按维度分组的前 limit 项
+func (s *urlService) VisitBreakdown(ctx context.Context, links LinkSet, r StatsRange, dimension string, limit int) []model.Breakdown {
+	if links.empty() {
+		return []model.Breakdown{}
+	}
+	return s.visitBreakdown(ctx, s.newVisitScope(ctx, links, r), dimension, limit)
+}
+
+// visitBreakdown 合并按天汇总的数据和尚未汇总的明细，按维度分组统计前 limit 项
+func (s *urlService) visitBreakdown(ctx context.Context, scope visitScope, dimension string, limit int) []model.Breakdown {
+	result := make([]model.Breakdown, 0)
+	d, ok := visitDimensions[dimension]
+	if !ok {
+		return result
+	}
+	where, args := scope.where(d.bot)
+	args = append([]interface{}{scope.urls, scope.dayFrom, scope.dayTo, dimension}, append(args, limit)...)
+	s.db.WithContext(ctx).Raw(fmt.Sprintf(`
+		SELECT
+			name,
+			CAST(ROUND(SUM(n)) AS BIGINT) as count
+		FROM (
+			SELECT value as name, count as n
+			FROM daily_visit_rollups
+			WHERE url_id IN ? AND day >= ? AND day < ? AND dimension = ?
+			UNION ALL
+			SELECT %s as name, weight as n
+			FROM url_visits
+			WHERE %s
+		) t
+		WHERE name <> ''
+		GROUP BY name
+		ORDER BY count DESC
+		LIMIT ?`, d.column, where), args...).Scan(&result)
+	return result
+}
+
+// botVisits 统计时间范围内的机器人访问次数，并判断是否存在抽样记录的明细
+func (s *urlService) botVisits(ctx context.Context, scope visitScope) (bots float64, sampled bool) {
+	var totals struct {
+		Visits  float64
+		Bots    float64
+		Records float64
+	}
+	s.db.WithContext(ctx).Model(&model.HourlyVisitRollup{}).
+		Select("COALESCE(SUM(visits), 0) as visits, COALESCE(SUM(bots), 0) as bots, COALESCE(SUM(records), 0) as records").
+		Where("url_id IN ? AND hour >= ? AND hour < ?", scope.urls, scope.hourFrom, scope.hourTo).
+		Scan(&totals)
+
+	var tail struct {
+		Bots      float64
+		MaxWeight float64
+	}
+	where, args := scope.tail()
+	s.db.WithContext(ctx).Raw(`
+		SELECT
+			COALESCE(SUM(CASE WHEN bot THEN weight ELSE 0 END), 0) as bots,
+			COALESCE(MAX(weight), 1) as max_weight
+		FROM url_visits
+		WHERE `+where, args...).Scan(&tail)
+
+	// 汇总的访问次数多于明细条数，或未汇总的明细代表多次访问时，说明明细为抽样记录
+	sampled = totals.Visits+totals.Bots > totals.Records+0.5 || tail.MaxWeight > 1
+	return totals.Bots + tail.Bots, sampled
+}
+
+// botTraffic 机器人访问的总数、识别原因和来源
+func (s *urlService) botTraffic(ctx context.Context, scope visitScope, visits float64) model.BotTraffic {
+	bots := model.BotTraffic{Visits: int64(visits + 0.5)}
+	if bots.Visits == 0 {
+		bots.Reasons, bots.Agents = []model.Breakdown{}, []model.Breakdown{}
+		return bots
+	}
+	bots.Reasons = s.visitBreakdown(ctx, scope, DimensionBotReason, 10)
+	bots.Agents = s.visitBreakdown(ctx, scope, DimensionBotAgent, 10)
+	return bots
+}
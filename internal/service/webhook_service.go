@@ -0,0 +1,643 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"shorturl/config"
+	"shorturl/internal/model"
+)
+
+const (
+	defaultWebhookTimeout     = time.Second * 5
+	defaultWebhookMaxAttempts = 8
+	defaultWebhookMaxPerUser  = 10
+	webhookPollInterval       = time.Second * 5
+	webhookReloadInterval     = time.Minute // 重新加载订阅，使其他实例的修改生效
+	webhookRetryBase          = time.Second * 30
+	webhookRetryMax           = time.Hour * 6
+	webhookDeliveryLease      = time.Minute // 投递期间占用记录，避免多个实例重复投递
+	webhookDeliveryRetention  = time.Hour * 24 * 30
+	webhookEventBuffer        = 10000
+	webhookBatchSize          = 50
+	webhookConcurrency        = 8 // 每批并发投递的请求数
+)
+
+// LinkEvent 链接事件，由URL服务在创建、删除和访问链接时发布
+type LinkEvent struct {
+	Type      string
+	ShortCode string
+	UserID    uint // 链接创建者，为0时由Webhook服务查询
+	Data      map[string]interface{}
+	CreatedAt time.Time
+}
+
+// webhookPayload 投递给订阅方的JSON内容
+type webhookPayload struct {
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// WebhookUpdate 修改Webhook，字段为nil表示不修改
+type WebhookUpdate struct {
+	URL    *string
+	Events []string
+	Active *bool
+}
+
+// WebhookService Webhook服务接口
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, userID uint, targetURL string, events []string) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context, userID uint) ([]model.Webhook, error)
+	UpdateWebhook(ctx context.Context, userID, id uint, update WebhookUpdate) (*model.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, id uint) error
+	ListDeliveries(ctx context.Context, userID, id uint, limit int) ([]model.WebhookDelivery, error)
+	SendTestEvent(ctx context.Context, userID, id uint) (*model.WebhookDelivery, error)
+	Publish(event LinkEvent)
+	Close()
+}
+
+type webhookService struct {
+	db     *gorm.DB
+	config *config.Config
+	client *http.Client
+	events chan LinkEvent
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	subsMutex sync.RWMutex
+	subs      map[uint][]model.Webhook // 用户ID -> 启用中的Webhook
+	subEvents map[string]bool          // 至少有一个订阅的事件类型，用于快速跳过无人订阅的点击事件
+}
+
+// NewWebhookService 创建Webhook服务并启动后台投递任务
+func NewWebhookService(db *gorm.DB, cfg *config.Config) WebhookService {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &webhookService{
+		db:     db,
+		config: cfg,
+		events: make(chan LinkEvent, webhookEventBuffer),
+		cancel: cancel,
+	}
+	s.client = s.newHTTPClient()
+	s.reloadSubscriptions(ctx)
+
+	s.wg.Add(2)
+	go s.processEvents(ctx)
+	go s.deliverLoop(ctx)
+	return s
+}
+
+// CreateWebhook 创建Webhook并生成签名密钥，返回的Secret只在创建时可见
+func (s *webhookService) CreateWebhook(ctx context.Context, userID uint, targetURL string, events []string) (*model.Webhook, error) {
+	if err := validateWebhookURL(targetURL); err != nil {
+		return nil, err
+	}
+	eventList, err := normalizeWebhookEvents(events)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := s.config.Webhooks.MaxPerUser
+	if limit <= 0 {
+		limit = defaultWebhookMaxPerUser
+	}
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Webhook{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("查询Webhook失败: %v", err)
+	}
+	if count >= int64(limit) {
+		return nil, fmt.Errorf("最多只能创建%d个Webhook", limit)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("生成签名密钥失败: %v", err)
+	}
+
+	webhook := &model.Webhook{
+		UserID: userID,
+		URL:    targetURL,
+		Secret: hex.EncodeToString(secret),
+		Events: eventList,
+		Active: true,
+	}
+	if err := s.db.WithContext(ctx).Create(webhook).Error; err != nil {
+		return nil, fmt.Errorf("创建Webhook失败: %v", err)
+	}
+
+	s.reloadSubscriptions(ctx)
+	return webhook, nil
+}
+
+// ListWebhooks 获取用户的全部Webhook
+func (s *webhookService) ListWebhooks(ctx context.Context, userID uint) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id ASC").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("获取Webhook失败: %v", err)
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook 修改Webhook的地址、订阅事件或启用状态
+func (s *webhookService) UpdateWebhook(ctx context.Context, userID, id uint, update WebhookUpdate) (*model.Webhook, error) {
+	webhook, err := s.getWebhook(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.URL != nil {
+		if err := validateWebhookURL(*update.URL); err != nil {
+			return nil, err
+		}
+		updates["url"] = *update.URL
+	}
+	if update.Events != nil {
+		eventList, err := normalizeWebhookEvents(update.Events)
+		if err != nil {
+			return nil, err
+		}
+		updates["events"] = eventList
+	}
+	if update.Active != nil {
+		updates["active"] = *update.Active
+	}
+	if len(updates) == 0 {
+		return webhook, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(webhook).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("更新Webhook失败: %v", err)
+	}
+	s.reloadSubscriptions(ctx)
+	return webhook, nil
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func (s *webhookService) DeleteWebhook(ctx context.Context, userID, id uint) error {
+	webhook, err := s.getWebhook(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+	if err != nil {
+		return fmt.Errorf("删除Webhook失败: %v", err)
+	}
+
+	s.reloadSubscriptions(ctx)
+	return nil
+}
+
+// ListDeliveries 获取Webhook最近的投递记录
+func (s *webhookService) ListDeliveries(ctx context.Context, userID, id uint, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := s.getWebhook(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	var deliveries []model.WebhookDelivery
+	if err := s.db.WithContext(ctx).Where("webhook_id = ?", id).
+		Order("id DESC").Limit(limit).
+		Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("获取投递记录失败: %v", err)
+	}
+	return deliveries, nil
+}
+
+// SendTestEvent 立即向Webhook投递一条测试事件，结果同样记录在投递记录中
+func (s *webhookService) SendTestEvent(ctx context.Context, userID, id uint) (*model.WebhookDelivery, error) {
+	webhook, err := s.getWebhook(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先占用一段时间，避免后台任务在测试投递完成前同时拿到
+	delivery, err := s.enqueue(ctx, webhook, LinkEvent{
+		Type:      model.WebhookEventTest,
+		Data:      map[string]interface{}{"message": "这是一条测试事件"},
+		CreatedAt: time.Now(),
+	}, time.Now().Add(webhookDeliveryLease))
+	if err != nil {
+		return nil, err
+	}
+
+	s.attempt(ctx, webhook, delivery)
+	return delivery, nil
+}
+
+// Publish 发布链接事件，不阻塞调用方；缓冲区满时丢弃事件
+func (s *webhookService) Publish(event LinkEvent) {
+	s.subsMutex.RLock()
+	subscribed := s.subEvents[event.Type]
+	s.subsMutex.RUnlock()
+	if !subscribed {
+		return
+	}
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	select {
+	case s.events <- event:
+	default:
+		logrus.Warnf("Webhook事件缓冲区已满，丢弃事件: %s %s", event.Type, event.ShortCode)
+	}
+}
+
+// Close 停止后台任务，已写入发件箱的事件在下次启动后继续投递
+func (s *webhookService) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *webhookService) getWebhook(ctx context.Context, userID, id uint) (*model.Webhook, error) {
+	var webhook model.Webhook
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&webhook).Error; err != nil {
+		return nil, fmt.Errorf("Webhook不存在")
+	}
+	return &webhook, nil
+}
+
+// reloadSubscriptions 从数据库加载启用中的Webhook
+func (s *webhookService) reloadSubscriptions(ctx context.Context) {
+	var webhooks []model.Webhook
+	if err := s.db.WithContext(ctx).Where("active = ?", true).Find(&webhooks).Error; err != nil {
+		logrus.Errorf("加载Webhook订阅失败: %v", err)
+		return
+	}
+
+	subs := make(map[uint][]model.Webhook)
+	subEvents := make(map[string]bool)
+	for _, w := range webhooks {
+		subs[w.UserID] = append(subs[w.UserID], w)
+		for _, e := range strings.Split(w.Events, ",") {
+			subEvents[e] = true
+		}
+	}
+
+	s.subsMutex.Lock()
+	s.subs = subs
+	s.subEvents = subEvents
+	s.subsMutex.Unlock()
+}
+
+// processEvents 将事件写入订阅者的发件箱
+func (s *webhookService) processEvents(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.events:
+			s.dispatch(ctx, event)
+		}
+	}
+}
+
+func (s *webhookService) dispatch(ctx context.Context, event LinkEvent) {
+	if event.UserID == 0 {
+		var url model.URL
+		if err := s.db.WithContext(ctx).Unscoped().Select("user_id").
+			Where("short_code = ?", event.ShortCode).
+			First(&url).Error; err != nil {
+			return
+		}
+		event.UserID = url.UserID
+	}
+
+	s.subsMutex.RLock()
+	webhooks := s.subs[event.UserID]
+	s.subsMutex.RUnlock()
+
+	for i := range webhooks {
+		if !webhookSubscribed(&webhooks[i], event.Type) {
+			continue
+		}
+		// 由后台任务在下一轮轮询时投递
+		if _, err := s.enqueue(ctx, &webhooks[i], event, event.CreatedAt); err != nil {
+			logrus.Errorf("写入Webhook发件箱失败: %v", err)
+		}
+	}
+}
+
+// enqueue 为Webhook生成一条待投递记录，nextAttempt 之后由后台任务投递
+func (s *webhookService) enqueue(ctx context.Context, webhook *model.Webhook, event LinkEvent, nextAttempt time.Time) (*model.WebhookDelivery, error) {
+	eventID := make([]byte, 12)
+	if _, err := rand.Read(eventID); err != nil {
+		return nil, fmt.Errorf("生成事件ID失败: %v", err)
+	}
+
+	data := event.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	if event.ShortCode != "" {
+		data["short_code"] = event.ShortCode
+	}
+	payload, err := json.Marshal(webhookPayload{
+		ID:        "evt_" + hex.EncodeToString(eventID),
+		Event:     event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化事件失败: %v", err)
+	}
+
+	delivery := &model.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		Event:         event.Type,
+		Payload:       string(payload),
+		Status:        model.WebhookDeliveryPending,
+		NextAttemptAt: nextAttempt,
+	}
+	if err := s.db.WithContext(ctx).Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// deliverLoop 定期投递到期的发件箱记录，并清理过期的投递记录
+func (s *webhookService) deliverLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	lastReload, lastCleanup := time.Now(), time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if time.Since(lastReload) > webhookReloadInterval {
+			s.reloadSubscriptions(ctx)
+			lastReload = time.Now()
+		}
+		if time.Since(lastCleanup) > time.Hour {
+			s.cleanupDeliveries(ctx)
+			lastCleanup = time.Now()
+		}
+
+		var due []model.WebhookDelivery
+		if err := s.db.WithContext(ctx).
+			Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, time.Now()).
+			Order("next_attempt_at ASC").
+			Limit(webhookBatchSize).
+			Find(&due).Error; err != nil {
+			logrus.Errorf("查询待投递的Webhook失败: %v", err)
+			continue
+		}
+
+		sem := make(chan struct{}, webhookConcurrency)
+		var batch sync.WaitGroup
+		for i := range due {
+			if !s.claim(ctx, &due[i]) {
+				continue
+			}
+			sem <- struct{}{}
+			batch.Add(1)
+			go func(delivery *model.WebhookDelivery) {
+				defer func() { <-sem; batch.Done() }()
+				s.deliver(ctx, delivery)
+			}(&due[i])
+		}
+		batch.Wait()
+	}
+}
+
+// deliver 投递发件箱中的一条记录，Webhook已停用时不再投递
+func (s *webhookService) deliver(ctx context.Context, delivery *model.WebhookDelivery) {
+	var webhook model.Webhook
+	if err := s.db.WithContext(ctx).First(&webhook, delivery.WebhookID).Error; err != nil {
+		return
+	}
+	if !webhook.Active {
+		s.db.WithContext(ctx).Model(delivery).Updates(map[string]interface{}{
+			"status":     model.WebhookDeliveryFailed,
+			"last_error": "Webhook已停用",
+		})
+		return
+	}
+	s.attempt(ctx, &webhook, delivery)
+}
+
+// claim 以条件更新占用投递记录，多个实例同时运行时只有一个能拿到
+func (s *webhookService) claim(ctx context.Context, delivery *model.WebhookDelivery) bool {
+	lease := time.Now().Add(webhookDeliveryLease)
+	result := s.db.WithContext(ctx).Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, model.WebhookDeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", lease)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	delivery.NextAttemptAt = lease
+	return true
+}
+
+// attempt 投递一次并记录结果，失败时按指数退避安排下次重试
+func (s *webhookService) attempt(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) {
+	statusCode, err := s.post(ctx, webhook, delivery)
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	now := time.Now()
+	switch {
+	case err == nil:
+		delivery.Status = model.WebhookDeliverySuccess
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= s.maxAttempts():
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.LastError = truncateRunes(err.Error(), 512)
+	default:
+		delivery.LastError = truncateRunes(err.Error(), 512)
+		delivery.NextAttemptAt = now.Add(webhookRetryDelay(delivery.Attempts))
+	}
+
+	// 请求上下文可能已被取消，使用独立的上下文保存结果
+	saveCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := s.db.WithContext(saveCtx).Model(delivery).Updates(map[string]interface{}{
+		"status":           delivery.Status,
+		"attempts":         delivery.Attempts,
+		"next_attempt_at":  delivery.NextAttemptAt,
+		"last_status_code": delivery.LastStatusCode,
+		"last_error":       delivery.LastError,
+		"delivered_at":     delivery.DeliveredAt,
+	}).Error; err != nil {
+		logrus.Errorf("更新Webhook投递记录失败: %v", err)
+	}
+}
+
+// post 发送签名请求，签名为 HMAC-SHA256(secret, 时间戳 + "." + 请求体)
+func (s *webhookService) post(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shorturl-webhook/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("响应状态码 %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// cleanupDeliveries 删除超过保留期的投递记录
+func (s *webhookService) cleanupDeliveries(ctx context.Context) {
+	if err := s.db.WithContext(ctx).
+		Where("status <> ? AND created_at < ?", model.WebhookDeliveryPending, time.Now().Add(-webhookDeliveryRetention)).
+		Delete(&model.WebhookDelivery{}).Error; err != nil {
+		logrus.Errorf("清理Webhook投递记录失败: %v", err)
+	}
+}
+
+func (s *webhookService) maxAttempts() int {
+	if s.config.Webhooks.MaxAttempts > 0 {
+		return s.config.Webhooks.MaxAttempts
+	}
+	return defaultWebhookMaxAttempts
+}
+
+// newHTTPClient 创建投递用的HTTP客户端，默认拒绝连接内网地址
+func (s *webhookService) newHTTPClient() *http.Client {
+	timeout := defaultWebhookTimeout
+	if s.config.Webhooks.Timeout > 0 {
+		timeout = time.Duration(s.config.Webhooks.Timeout) * time.Second
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	if !s.config.Webhooks.AllowPrivateNetworks {
+		// 在建立连接时检查解析后的地址，防止通过DNS指向内网
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return fmt.Errorf("不允许投递到内网地址: %s", host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 4,
+		},
+		// 不跟随重定向，避免被重定向到内网地址
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookRetryDelay 第n次失败后的重试间隔
+func webhookRetryDelay(attempts int) time.Duration {
+	d := webhookRetryBase
+	for i := 1; i < attempts && d < webhookRetryMax; i++ {
+		d *= 2
+	}
+	if d > webhookRetryMax {
+		d = webhookRetryMax
+	}
+	return d
+}
+
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Webhook地址必须是http或https URL")
+	}
+	return nil
+}
+
+// normalizeWebhookEvents 校验事件类型并转换为逗号分隔的字符串
+func normalizeWebhookEvents(events []string) (string, error) {
+	if len(events) == 0 {
+		return "", fmt.Errorf("请至少选择一个事件")
+	}
+	seen := make(map[string]bool)
+	var list []string
+	for _, e := range events {
+		valid := false
+		for _, known := range model.WebhookEvents {
+			if e == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", fmt.Errorf("无效的事件类型: %s", e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			list = append(list, e)
+		}
+	}
+	return strings.Join(list, ","), nil
+}
+
+func webhookSubscribed(webhook *model.Webhook, event string) bool {
+	for _, e := range strings.Split(webhook.Events, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
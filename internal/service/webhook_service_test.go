@@ -0,0 +1,57 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shorturl/config"
+)
+
+func TestWebhookDialGuard(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		url          string
+		allowPrivate bool
+		wantBlocked  bool
+	}{
+		{name: "本机地址", url: srv.URL, wantBlocked: true},
+		{name: "允许内网时可投递本机", url: srv.URL, allowPrivate: true},
+		{name: "IPv6 本机地址", url: "http://[::1]:9/", wantBlocked: true},
+		{name: "10.0.0.0/8", url: "http://10.1.2.3:9/", wantBlocked: true},
+		{name: "172.16.0.0/12", url: "http://172.20.0.1:9/", wantBlocked: true},
+		{name: "192.168.0.0/16", url: "http://192.168.1.1:9/", wantBlocked: true},
+		{name: "云服务元数据地址", url: "http://169.254.169.254/latest/meta-data/", wantBlocked: true},
+		{name: "未指定地址", url: "http://0.0.0.0:9/", wantBlocked: true},
+		{name: "IPv6 唯一本地地址", url: "http://[fd00::1]:9/", wantBlocked: true},
+		// 文档用地址不属于内网，连接失败但不应被拦截
+		{name: "公网地址", url: "http://192.0.2.1:9/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Webhooks.Timeout = 1
+			cfg.Webhooks.AllowPrivateNetworks = tt.allowPrivate
+			client := (&webhookService{config: cfg}).newHTTPClient()
+
+			resp, err := client.Get(tt.url)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			blocked := err != nil && strings.Contains(err.Error(), "不允许投递到内网地址")
+			if blocked != tt.wantBlocked {
+				t.Fatalf("拦截 = %v，期望 %v (err: %v)", blocked, tt.wantBlocked, err)
+			}
+			if tt.allowPrivate && err != nil {
+				t.Fatalf("允许内网时投递失败: %v", err)
+			}
+		})
+	}
+}
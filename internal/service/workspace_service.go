@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"shorturl/internal/model"
+)
+
+// WorkspaceSummary 用户所属团队空间及其角色
+type WorkspaceSummary struct {
+	model.Workspace
+	Role       string `json:"role"`
+	LinksCount int64  `json:"links_count"`
+}
+
+// WorkspaceMemberInfo 团队空间成员及用户信息
+type WorkspaceMemberInfo struct {
+	model.WorkspaceMember
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// WorkspaceInviteInfo 待处理邀请及空间信息
+type WorkspaceInviteInfo struct {
+	model.WorkspaceInvite
+	WorkspaceName   string `json:"workspace_name"`
+	InviterUsername string `json:"inviter_username"`
+}
+
+// WorkspaceService 团队空间服务接口
+type WorkspaceService interface {
+	CreateWorkspace(ctx context.Context, ownerID uint, name string) (*model.Workspace, error)
+	ListWorkspaces(ctx context.Context, userID uint) ([]WorkspaceSummary, error)
+	GetMembership(ctx context.Context, workspaceID, userID uint) (*model.WorkspaceMember, error)
+	ListMembers(ctx context.Context, workspaceID uint) ([]WorkspaceMemberInfo, error)
+	InviteMember(ctx context.Context, workspaceID, inviterID uint, username, role string) (*model.WorkspaceInvite, error)
+	ListInvites(ctx context.Context, userID uint) ([]WorkspaceInviteInfo, error)
+	RespondInvite(ctx context.Context, inviteID, userID uint, accept bool) error
+	UpdateMemberRole(ctx context.Context, workspaceID, userID uint, role string) error
+	RemoveMember(ctx context.Context, workspaceID, userID uint) error
+	TransferURL(ctx context.Context, shortCode string, workspaceID uint) error
+}
+
+type workspaceService struct {
+	db *gorm.DB
+}
+
+// NewWorkspaceService 创建团队空间服务
+func NewWorkspaceService(db *gorm.DB) WorkspaceService {
+	return &workspaceService{db: db}
+}
+
+// CreateWorkspace 创建团队空间，创建者成为所有者
+func (s *workspaceService) CreateWorkspace(ctx context.Context, ownerID uint, name string) (*model.Workspace, error) {
+	workspace := &model.Workspace{
+		Name:    name,
+		OwnerID: ownerID,
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(workspace).Error; err != nil {
+			return fmt.Errorf("创建团队空间失败: %v", err)
+		}
+		member := &model.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      ownerID,
+			Role:        model.WorkspaceRoleOwner,
+		}
+		if err := tx.Create(member).Error; err != nil {
+			return fmt.Errorf("添加空间所有者失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// ListWorkspaces 获取用户加入的所有团队空间
+func (s *workspaceService) ListWorkspaces(ctx context.Context, userID uint) ([]WorkspaceSummary, error) {
+	var workspaces []WorkspaceSummary
+	if err := s.db.WithContext(ctx).Model(&model.Workspace{}).
+		Select("workspaces.*, workspace_members.role, (SELECT COUNT(*) FROM urls WHERE urls.workspace_id = workspaces.id AND urls.deleted_at IS NULL) as links_count").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.id ASC").
+		Scan(&workspaces).Error; err != nil {
+		return nil, fmt.Errorf("获取团队空间失败: %v", err)
+	}
+	return workspaces, nil
+}
+
+// GetMembership 获取用户在团队空间中的成员记录
+func (s *workspaceService) GetMembership(ctx context.Context, workspaceID, userID uint) (*model.WorkspaceMember, error) {
+	var member model.WorkspaceMember
+	if err := s.db.WithContext(ctx).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		First(&member).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("不是该团队空间的成员")
+		}
+		return nil, fmt.Errorf("获取成员信息失败: %v", err)
+	}
+	return &member, nil
+}
+
+// ListMembers 获取团队空间成员列表
+func (s *workspaceService) ListMembers(ctx context.Context, workspaceID uint) ([]WorkspaceMemberInfo, error) {
+	var members []WorkspaceMemberInfo
+	if err := s.db.WithContext(ctx).Model(&model.WorkspaceMember{}).
+		Select("workspace_members.*, users.username, users.email").
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ?", workspaceID).
+		Order("workspace_members.id ASC").
+		Scan(&members).Error; err != nil {
+		return nil, fmt.Errorf("获取成员列表失败: %v", err)
+	}
+	return members, nil
+}
+
+// InviteMember 按用户名邀请成员加入团队空间
+func (s *workspaceService) InviteMember(ctx context.Context, workspaceID, inviterID uint, username, role string) (*model.WorkspaceInvite, error) {
+	if !model.ValidWorkspaceRole(role) || role == model.WorkspaceRoleOwner {
+		return nil, fmt.Errorf("无效的空间角色: %s", role)
+	}
+
+	var invitee model.User
+	if err := s.db.WithContext(ctx).Where("username = ?", username).First(&invitee).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+
+	var count int64
+	s.db.WithContext(ctx).Model(&model.WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, invitee.ID).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("该用户已是空间成员")
+	}
+
+	s.db.WithContext(ctx).Model(&model.WorkspaceInvite{}).
+		Where("workspace_id = ? AND invitee_id = ? AND status = ?", workspaceID, invitee.ID, "pending").Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("已向该用户发送过邀请")
+	}
+
+	invite := &model.WorkspaceInvite{
+		WorkspaceID: workspaceID,
+		InviteeID:   invitee.ID,
+		InviterID:   inviterID,
+		Role:        role,
+		Status:      "pending",
+	}
+	if err := s.db.WithContext(ctx).Create(invite).Error; err != nil {
+		return nil, fmt.Errorf("创建邀请失败: %v", err)
+	}
+
+	return invite, nil
+}
+
+// ListInvites 获取用户收到的待处理邀请
+func (s *workspaceService) ListInvites(ctx context.Context, userID uint) ([]WorkspaceInviteInfo, error) {
+	var invites []WorkspaceInviteInfo
+	if err := s.db.WithContext(ctx).Model(&model.WorkspaceInvite{}).
+		Select("workspace_invites.*, workspaces.name as workspace_name, users.username as inviter_username").
+		Joins("JOIN workspaces ON workspaces.id = workspace_invites.workspace_id AND workspaces.deleted_at IS NULL").
+		Joins("LEFT JOIN users ON users.id = workspace_invites.inviter_id").
+		Where("workspace_invites.invitee_id = ? AND workspace_invites.status = ?", userID, "pending").
+		Order("workspace_invites.id DESC").
+		Scan(&invites).Error; err != nil {
+		return nil, fmt.Errorf("获取邀请失败: %v", err)
+	}
+	return invites, nil
+}
+
+// RespondInvite 接受或拒绝邀请
+func (s *workspaceService) RespondInvite(ctx context.Context, inviteID, userID uint, accept bool) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var invite model.WorkspaceInvite
+		if err := tx.Where("id = ? AND invitee_id = ? AND status = ?", inviteID, userID, "pending").
+			First(&invite).Error; err != nil {
+			return fmt.Errorf("邀请不存在或已处理")
+		}
+
+		status := "declined"
+		if accept {
+			status = "accepted"
+		}
+		now := time.Now()
+		if err := tx.Model(&invite).Updates(map[string]interface{}{
+			"status":       status,
+			"responded_at": &now,
+		}).Error; err != nil {
+			return fmt.Errorf("更新邀请失败: %v", err)
+		}
+
+		if !accept {
+			return nil
+		}
+
+		member := &model.WorkspaceMember{
+			WorkspaceID: invite.WorkspaceID,
+			UserID:      userID,
+			Role:        invite.Role,
+		}
+		if err := tx.Create(member).Error; err != nil {
+			return fmt.Errorf("加入团队空间失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// UpdateMemberRole 修改成员角色，空间至少保留一个所有者
+func (s *workspaceService) UpdateMemberRole(ctx context.Context, workspaceID, userID uint, role string) error {
+	if !model.ValidWorkspaceRole(role) {
+		return fmt.Errorf("无效的空间角色: %s", role)
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		member, err := s.memberForChange(tx, workspaceID, userID, role != model.WorkspaceRoleOwner)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(member).Update("role", role).Error; err != nil {
+			return fmt.Errorf("更新成员角色失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// RemoveMember 移除成员，成员创建的空间链接仍保留在空间内
+func (s *workspaceService) RemoveMember(ctx context.Context, workspaceID, userID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		member, err := s.memberForChange(tx, workspaceID, userID, true)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(member).Error; err != nil {
+			return fmt.Errorf("移除成员失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// TransferURL 将链接移动到指定团队空间，workspaceID为0时移回创建者的个人链接
+// 营销活动属于原来的空间，转移后链接不再属于任何活动
+func (s *workspaceService) TransferURL(ctx context.Context, shortCode string, workspaceID uint) error {
+	result := s.db.WithContext(ctx).Model(&model.URL{}).
+		Where("short_code = ?", shortCode).
+		Updates(map[string]interface{}{"workspace_id": workspaceID, "campaign_id": 0})
+	if result.Error != nil {
+		return fmt.Errorf("转移短链接失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("短链接不存在")
+	}
+	return nil
+}
+
+// memberForChange 获取成员记录，removingOwner为true时检查不会移除最后一个所有者
+func (s *workspaceService) memberForChange(tx *gorm.DB, workspaceID, userID uint, removingOwner bool) (*model.WorkspaceMember, error) {
+	var member model.WorkspaceMember
+	if err := tx.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error; err != nil {
+		return nil, fmt.Errorf("成员不存在")
+	}
+
+	if removingOwner && member.Role == model.WorkspaceRoleOwner {
+		var owners int64
+		if err := tx.Model(&model.WorkspaceMember{}).
+			Where("workspace_id = ? AND role = ?", workspaceID, model.WorkspaceRoleOwner).
+			Count(&owners).Error; err != nil {
+			return nil, fmt.Errorf("检查空间所有者失败: %v", err)
+		}
+		if owners <= 1 {
+			return nil, fmt.Errorf("团队空间至少需要保留一个所有者")
+		}
+	}
+
+	return &member, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxCellLimit Excel单元格最多容纳的字符数
+const xlsxCellLimit = 32767
+
+// xlsxWriter 按行流式写入只含数据的XLSX文件，每个表格一个工作表
+// 字符串使用内联字符串，不需要在写完全部数据后再生成共享字符串表
+type xlsxWriter struct {
+	zw     *zip.Writer
+	sheets []string
+	sheet  io.Writer // 正在写入的工作表，nil 表示没有打开的工作表
+	rows   int
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	return &xlsxWriter{zw: zip.NewWriter(w)}
+}
+
+func (x *xlsxWriter) table(name string, header ...string) error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	x.sheets = append(x.sheets, name)
+	f, err := x.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+	x.sheet, x.rows = f, 0
+
+	values := make([]interface{}, len(header))
+	for i, h := range header {
+		values[i] = h
+	}
+	return x.row(values...)
+}
+
+func (x *xlsxWriter) row(values ...interface{}) error {
+	x.rows++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.rows)
+	for i, v := range values {
+		ref := xlsxColumn(i) + strconv.Itoa(x.rows)
+		switch v := v.(type) {
+		case int64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			value := 0
+			if v {
+				value = 1
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, value)
+		default:
+			s := fmt.Sprint(v)
+			if s == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			// EscapeText 会把XML中不允许的控制字符替换为U+FFFD
+			xml.EscapeText(&b, []byte(truncateRunes(s, xlsxCellLimit)))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+	_, err := io.WriteString(x.sheet, b.String())
+	return err
+}
+
+func (x *xlsxWriter) endSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+	_, err := io.WriteString(x.sheet, `</sheetData></worksheet>`)
+	x.sheet = nil
+	return err
+}
+
+// close 写入工作簿结构，工作表须在此之前全部写完
+func (x *xlsxWriter) close() error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+
+	var types, sheets, rels strings.Builder
+	for i, name := range x.sheets {
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	}
+	for _, part := range parts {
+		f, err := x.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, xml.Header+part.content); err != nil {
+			return err
+		}
+	}
+	return x.zw.Close()
+}
+
+// xlsxColumn 返回从0开始的列序号对应的列名，如 0 -> A、26 -> AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -21,6 +21,8 @@ import (
 	"shorturl/config"
 	"shorturl/internal/cache"
 	"shorturl/internal/db"
+	"shorturl/internal/geoip"
+	"shorturl/internal/mail"
 	"shorturl/internal/model"
 	"shorturl/internal/router"
 	"shorturl/internal/service"
@@ -76,8 +78,22 @@ func main() {
 	}
 
 	// 初始化服务
-	urlService := service.NewURLService(database, redisClient)
-	authService := service.NewAuthService(database, cfg)
+	webhookService := service.NewWebhookService(database, cfg)
+	clickStream := service.NewClickStream(database, redisClient)
+	geoResolver := geoip.NewResolver(cfg)
+	defer geoResolver.Close()
+	urlService := service.NewURLService(database, redisClient, cfg, webhookService, clickStream, geoResolver)
+	mailer, err := mail.NewMailer(cfg)
+	if err != nil {
+		logrus.Fatalf("初始化邮件发送失败: %v", err)
+	}
+
+	authService := service.NewAuthService(database, cfg, mailer)
+	oidcService := service.NewOIDCService(database, cfg)
+	workspaceService := service.NewWorkspaceService(database)
+	auditService := service.NewAuditService(database)
+	reportService := service.NewReportService(database, cfg, urlService)
+	campaignService := service.NewCampaignService(database, urlService)
 
 	// 添加默认管理员（如果不存在）
 	createDefaultAdmin(database)
@@ -97,7 +113,7 @@ func main() {
 	}
 
 	// 设置路由
-	r := router.Setup(urlService, authService, database)
+	r := router.Setup(cfg, urlService, authService, oidcService, workspaceService, auditService, reportService, campaignService, webhookService, clickStream, database)
 
 	// 启动HTTP服务器
 	serverAddr := cfg.Server.Host + ":" + strconv.Itoa(cfg.Server.Port)
@@ -121,26 +137,17 @@ func main() {
 		},
 	}
 
-	// 启动服务器并设置优雅关闭
-	startServerWithGracefulShutdown(server, serverAddr)
-
-	// 添加服务优雅关闭的代码
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-quit
-		logrus.Info("正在关闭服务...")
-
-		// 关闭URL服务以保存数据
-		urlService.Close()
+	// 关闭时结束实时访问事件流，否则长连接会使Shutdown一直等待到超时
+	server.RegisterOnShutdown(clickStream.Close)
 
-		// 关闭Redis和数据库
-		// ...
+	// 启动服务器并设置优雅关闭，收到退出信号后返回
+	startServerWithGracefulShutdown(server, serverAddr)
 
-		logrus.Info("服务已安全关闭")
-		os.Exit(0)
-	}()
+	// 关闭服务，将尚未同步的访问计数写入数据库
+	logrus.Info("正在关闭服务...")
+	urlService.Close()
+	webhookService.Close()
+	logrus.Info("服务已安全关闭")
 }
 
 // 启动服务器并处理优雅关闭
@@ -181,6 +188,7 @@ func createDefaultAdmin(db *gorm.DB) {
 			Password:    string(password),
 			Email:       "admin@example.com",
 			IsAdmin:     true,
+			Role:        model.RoleAdmin,
 			LastLoginAt: time.Now(),
 		}
 
@@ -0,0 +1,270 @@
+// mockidp 是用于本地联调单点登录的最小OpenID Connect身份提供方。
+//
+// 支持服务发现、授权码模式(含PKCE S256校验)、JWKS和RS256签名的ID令牌，
+// 授权页面直接填写用户名、邮箱和用户组即可完成登录，不做任何真实认证。
+// 仅用于开发和测试环境:
+//
+//	go run ./scripts/mockidp -addr :9000
+//
+// 对应配置:
+//
+//	auth:
+//	  oidc:
+//	    enabled: true
+//	    issuer: "http://localhost:9000"
+//	    client_id: "shorturl"
+//	    client_secret: "secret"
+//	    redirect_url: "http://localhost:8080/api/auth/oidc/callback"
+//	    admin_groups: ["admins"]
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const keyID = "mockidp"
+
+// authRequest 授权码对应的待兑换请求
+type authRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Nonce         string
+	CodeChallenge string
+	Username      string
+	Email         string
+	Groups        []string
+	ExpiresAt     time.Time
+}
+
+type server struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]*authRequest
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><meta charset="UTF-8"><title>Mock IdP</title></head>
+<body style="font-family:sans-serif;max-width:420px;margin:60px auto">
+<h2>Mock IdP 登录</h2>
+<form method="POST">
+{{ range $k, $v := .Params }}<input type="hidden" name="{{ $k }}" value="{{ $v }}">{{ end }}
+<p><label>用户名<br><input name="username" value="alice" required></label></p>
+<p><label>邮箱<br><input name="email" value="alice@example.com"></label></p>
+<p><label>用户组(逗号分隔)<br><input name="groups" value="staff"></label></p>
+<p><button type="submit">登录</button> <button type="submit" name="deny" value="1">拒绝</button></p>
+</form></body></html>`))
+
+func main() {
+	addr := flag.String("addr", ":9000", "监听地址")
+	issuer := flag.String("issuer", "http://localhost:9000", "签发者地址，需与客户端配置一致")
+	clientID := flag.String("client-id", "shorturl", "客户端ID")
+	clientSecret := flag.String("client-secret", "secret", "客户端密钥")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("生成签名密钥失败: %v", err)
+	}
+
+	s := &server{
+		issuer:       strings.TrimRight(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		key:          key,
+		codes:        make(map[string]*authRequest),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+
+	log.Printf("Mock IdP 启动在 %s (issuer=%s)", *addr, s.issuer)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// discovery 返回OpenID服务发现文档
+func (s *server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "profile", "email", "groups"},
+	})
+}
+
+// authorize 展示登录表单，提交后携带授权码跳回客户端
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redirectURI := r.Form.Get("redirect_uri")
+	if r.Form.Get("client_id") != s.clientID || redirectURI == "" {
+		http.Error(w, "invalid client", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "" {
+		http.Error(w, "PKCE S256 required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		params := map[string]string{}
+		for _, k := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			params[k] = r.Form.Get(k)
+		}
+		loginPage.Execute(w, map[string]interface{}{"Params": params})
+		return
+	}
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := target.Query()
+	query.Set("state", r.Form.Get("state"))
+
+	if r.Form.Get("deny") != "" {
+		query.Set("error", "access_denied")
+	} else {
+		var groups []string
+		for _, g := range strings.Split(r.Form.Get("groups"), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+
+		code := randomString()
+		s.mu.Lock()
+		s.codes[code] = &authRequest{
+			ClientID:      s.clientID,
+			RedirectURI:   redirectURI,
+			Nonce:         r.Form.Get("nonce"),
+			CodeChallenge: r.Form.Get("code_challenge"),
+			Username:      r.Form.Get("username"),
+			Email:         r.Form.Get("email"),
+			Groups:        groups,
+			ExpiresAt:     time.Now().Add(time.Minute),
+		}
+		s.mu.Unlock()
+		query.Set("code", code)
+	}
+
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token 校验授权码和PKCE后签发ID令牌
+func (s *server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if clientID != s.clientID || clientSecret != s.clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	s.mu.Lock()
+	req, found := s.codes[r.Form.Get("code")]
+	delete(s.codes, r.Form.Get("code"))
+	s.mu.Unlock()
+
+	if !found || time.Now().After(req.ExpiresAt) || req.RedirectURI != r.Form.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != req.CodeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                s.issuer,
+		"sub":                "mock-" + req.Username,
+		"aud":                req.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              req.Nonce,
+		"preferred_username": req.Username,
+		"email":              req.Email,
+		"groups":             req.Groups,
+	})
+	idToken.Header["kid"] = keyID
+
+	signed, err := idToken.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+// jwks 公布ID令牌签名公钥
+func (s *server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
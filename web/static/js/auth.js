@@ -29,6 +29,124 @@ document.addEventListener('DOMContentLoaded', function() {
         regError.textContent = '';
     });
     
+    // 找回密码与重置密码
+    const forgotCard = document.getElementById('forgot-card');
+    const resetCard = document.getElementById('reset-card');
+    const forgotBtn = document.getElementById('forgotBtn');
+    const resetBtn = document.getElementById('resetBtn');
+    const forgotError = document.getElementById('forgot-error');
+    const resetError = document.getElementById('reset-error');
+    const resetToken = new URLSearchParams(window.location.search).get('reset_token');
+    
+    // 通过邮件中的链接打开时直接显示设置新密码表单
+    if (resetToken) {
+        loginCard.style.display = 'none';
+        resetCard.style.display = 'block';
+    }
+    
+    document.getElementById('showForgot').addEventListener('click', function(e) {
+        e.preventDefault();
+        loginCard.style.display = 'none';
+        forgotCard.style.display = 'block';
+        forgotError.textContent = '';
+    });
+    
+    document.querySelectorAll('.show-login').forEach(link => {
+        link.addEventListener('click', function(e) {
+            e.preventDefault();
+            forgotCard.style.display = 'none';
+            resetCard.style.display = 'none';
+            loginCard.style.display = 'block';
+            // 去掉地址栏中的重置令牌
+            window.history.replaceState(null, '', window.location.pathname);
+        });
+    });
+    
+    forgotBtn.addEventListener('click', function() {
+        const email = document.getElementById('forgot-email').value.trim();
+        
+        if (!validateEmail(email)) {
+            forgotError.textContent = '请输入有效的电子邮箱地址';
+            return;
+        }
+        
+        forgotError.textContent = '';
+        forgotBtn.disabled = true;
+        
+        fetch('/api/auth/password/forgot', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ email: email }),
+        })
+        .then(response => response.json())
+        .then(data => {
+            forgotBtn.disabled = false;
+            
+            if (data.error) {
+                forgotError.textContent = data.error;
+                return;
+            }
+            
+            showNotification(data.message, 'success');
+        })
+        .catch(error => {
+            console.error('找回密码错误:', error);
+            forgotBtn.disabled = false;
+            forgotError.textContent = '请求失败，请重试';
+        });
+    });
+    
+    resetBtn.addEventListener('click', function() {
+        const password = document.getElementById('reset-password').value;
+        const passwordConfirm = document.getElementById('reset-password-confirm').value;
+        
+        if (password.length < 6) {
+            resetError.textContent = '密码长度至少需要6个字符';
+            return;
+        }
+        
+        if (password !== passwordConfirm) {
+            resetError.textContent = '两次输入的密码不一致';
+            return;
+        }
+        
+        resetError.textContent = '';
+        resetBtn.disabled = true;
+        
+        fetch('/api/auth/password/reset', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({
+                token: resetToken,
+                new_password: password
+            }),
+        })
+        .then(response => response.json())
+        .then(data => {
+            resetBtn.disabled = false;
+            
+            if (data.error) {
+                resetError.textContent = data.error;
+                showNotification(data.error, 'error');
+                return;
+            }
+            
+            showNotification(data.message, 'success');
+            window.history.replaceState(null, '', window.location.pathname);
+            resetCard.style.display = 'none';
+            loginCard.style.display = 'block';
+        })
+        .catch(error => {
+            console.error('重置密码错误:', error);
+            resetBtn.disabled = false;
+            resetError.textContent = '重置失败，请重试';
+        });
+    });
+    
     // 登录处理
     loginBtn.addEventListener('click', function() {
         const username = document.getElementById('username').value.trim();
@@ -67,16 +185,16 @@ document.addEventListener('DOMContentLoaded', function() {
                 return;
             }
             
-            // 保存令牌到Cookie
-            document.cookie = `auth_token=${data.token}; path=/; max-age=${24*60*60}`; // 24小时
-            
-            // 显示成功通知
-            showNotification('登录成功，正在跳转...', 'success');
+            // 已启用两步验证，切换到验证码输入
+            if (data.two_factor_required) {
+                challengeToken = data.challenge_token;
+                loginCard.style.display = 'none';
+                twoFactorCard.style.display = 'block';
+                document.getElementById('two-factor-code').focus();
+                return;
+            }
             
-            // 重定向到仪表盘
-            setTimeout(() => {
-                window.location.href = '/dashboard';
-            }, 1000);
+            completeLogin(data);
         })
         .catch(error => {
             console.error('登录错误:', error);
@@ -87,6 +205,84 @@ document.addEventListener('DOMContentLoaded', function() {
         });
     });
     
+    // 两步验证处理
+    const twoFactorCard = document.getElementById('two-factor-card');
+    const twoFactorBtn = document.getElementById('twoFactorBtn');
+    const twoFactorError = document.getElementById('two-factor-error');
+    let challengeToken = null;
+    
+    // 单点登录后本地启用了两步验证，回调跳转到此页面并在URL片段中带上挑战令牌
+    const oidcChallenge = new URLSearchParams(window.location.hash.slice(1)).get('challenge_token');
+    if (oidcChallenge) {
+        challengeToken = oidcChallenge;
+        loginCard.style.display = 'none';
+        twoFactorCard.style.display = 'block';
+        window.history.replaceState(null, '', window.location.pathname);
+    }
+    
+    twoFactorBtn.addEventListener('click', function() {
+        const code = document.getElementById('two-factor-code').value.trim();
+        
+        if (!code) {
+            twoFactorError.textContent = '请输入验证码';
+            return;
+        }
+        
+        twoFactorError.textContent = '';
+        twoFactorBtn.disabled = true;
+        
+        fetch('/api/auth/2fa/verify', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({
+                challenge_token: challengeToken,
+                code: code
+            }),
+        })
+        .then(response => response.json())
+        .then(data => {
+            twoFactorBtn.disabled = false;
+            
+            if (data.error) {
+                twoFactorError.textContent = data.error;
+                showNotification(data.error, 'error');
+                return;
+            }
+            
+            completeLogin(data);
+        })
+        .catch(error => {
+            console.error('验证错误:', error);
+            twoFactorBtn.disabled = false;
+            twoFactorError.textContent = '验证失败，请重试';
+        });
+    });
+    
+    document.getElementById('two-factor-code').addEventListener('keypress', function(e) {
+        if (e.key === 'Enter') {
+            twoFactorBtn.click();
+        }
+    });
+    
+    // 保存令牌并跳转到仪表盘
+    function completeLogin(data) {
+        // 保存令牌到Cookie
+        document.cookie = `auth_token=${data.token}; path=/; max-age=${24*60*60}`; // 24小时
+        // 保存刷新令牌，用于访问令牌过期后续期
+        localStorage.setItem('refresh_token', data.refresh_token);
+        
+        // 显示成功通知
+        showNotification('登录成功，正在跳转...', 'success');
+        
+        // 重定向到仪表盘，使用临时密码登录时直接进入修改密码页面
+        setTimeout(() => {
+            const mustSetup = data.must_change_password || data.two_factor_setup_required;
+            window.location.href = mustSetup ? '/dashboard#security' : '/dashboard';
+        }, 1000);
+    }
+    
     // 注册处理
     registerBtn.addEventListener('click', function() {
         const username = document.getElementById('reg-username').value.trim();
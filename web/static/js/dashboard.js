@@ -5,6 +5,9 @@ document.addEventListener('DOMContentLoaded', function() {
     // 初始化选项卡切换
     initTabs();
     
+    // 初始化团队空间切换
+    initWorkspaceSwitcher();
+    
     // 初始化数据加载
     loadDashboardData();
     
@@ -88,22 +91,51 @@ function handleHashChange() {
         window.location.hash = hash;
     }
     
+    // 管理员重置密码后需先修改密码，其他页面的接口都会被拒绝
+    if (hash !== 'security' && document.getElementById('password-card').getAttribute('data-must-change') === 'true') {
+        showNotification('您正在使用临时密码，请先修改密码', 'info');
+        window.location.hash = 'security';
+        return;
+    }
+    
     activateTab(hash);
 }
 
 // 加载特定选项卡的数据
 function loadTabData(tabId) {
+    closeLiveClicks();
     switch (tabId) {
         case 'dashboard':
             loadDashboardData();
+            openLiveClicks('/api/live', 'dashboard-live-clicks');
             break;
         case 'links':
             loadUserLinks();
             break;
+        case 'create':
+            loadQuotaUsage();
+            loadCampaignOptions();
+            break;
         case 'stats':
             // 不需要立即加载数据，用户需要先选择一个链接
             initStatsSearch();
             break;
+        case 'campaigns':
+            loadCampaigns();
+            break;
+        case 'workspaces':
+            loadWorkspaces();
+            break;
+        case 'security':
+            loadSecurityTab();
+            break;
+        case 'webhooks':
+            loadWebhooks();
+            break;
+        case 'moderation':
+            loadReportSummary();
+            loadModerationLinks();
+            break;
         case 'admin':
             loadAdminData();
             break;
@@ -125,14 +157,14 @@ function loadDashboardData() {
     document.getElementById('recent-links').innerHTML = '<tr><td colspan="5" class="text-center">加载中...</td></tr>';
     
     // 获取用户仪表盘数据
-    fetch('/api/dashboard', {
-        headers: {
+    fetch(`/api/dashboard?${statsRangeQuery('dashboard-range', 'dashboard-interval')}`, {
+        headers: workspaceHeaders({
             'Authorization': `Bearer ${token}`
-        }
+        })
     })
     .then(response => {
         if (!response.ok) {
-            throw new Error('加载仪表盘数据失败');
+            return responseError(response, '加载仪表盘数据失败').then(err => { throw err; });
         }
         return response.json();
     })
@@ -147,13 +179,28 @@ function loadDashboardData() {
         
         // 渲染访问趋势图表
         renderVisitsTrendChart(data.visits_trend || []);
+        
+        // 渲染访问地区分布
+        renderTopCountries(data.top_countries || []);
     })
     .catch(error => {
         console.error('Error:', error);
-        showNotification('加载仪表盘数据失败', 'error');
+        showNotification(error.message || '加载仪表盘数据失败', 'error');
     });
 }
 
+// 渲染仪表盘的访问地区分布，没有地理位置数据时隐藏
+function renderTopCountries(countries) {
+    const card = document.getElementById('top-countries-card');
+    if (countries.length === 0) {
+        card.style.display = 'none';
+        return;
+    }
+    card.style.display = '';
+    document.getElementById('top-countries').innerHTML = renderDetailList(
+        countries.map(c => ({ name: countryName(c.name), count: c.count })));
+}
+
 // 更新最近链接表格
 function updateRecentLinks(links) {
     const tbody = document.getElementById('recent-links');
@@ -256,9 +303,11 @@ function renderVisitsTrendChart(trendData) {
     }
     
     // 准备数据
-    trendData.sort((a, b) => new Date(a.date) - new Date(b.date));
-    const labels = trendData.map(item => formatDate(new Date(item.date)));
+    // 时间段名称已按浏览器时区生成，按字符串排序即为时间顺序
+    trendData.sort((a, b) => a.date.localeCompare(b.date));
+    const labels = trendData.map(item => item.date);
     const values = trendData.map(item => item.count);
+    const uniques = trendData.map(item => item.uniques || 0);
     
     // 创建图表
     window.visitsTrendChart = new Chart(ctx, {
@@ -272,14 +321,14 @@ function renderVisitsTrendChart(trendData) {
                 backgroundColor: 'rgba(52, 152, 219, 0.1)',
                 tension: 0.4,
                 fill: true
-            }]
+            }, uniqueVisitorsDataset(uniques)]
         },
         options: {
             responsive: true,
             maintainAspectRatio: false,
             plugins: {
                 legend: {
-                    display: false
+                    display: true
                 },
                 tooltip: {
                     mode: 'index',
@@ -310,9 +359,9 @@ function loadUserLinks() {
     tableBody.innerHTML = '<tr><td colspan="6" class="text-center">正在加载...</td></tr>';
     
     fetch('/api/urls', {
-        headers: {
+        headers: workspaceHeaders({
             'Authorization': `Bearer ${token}`
-        }
+        })
     })
     .then(response => {
         if (!response.ok) {
@@ -352,7 +401,7 @@ function loadUserLinks() {
                 <td class="url-original"><a href="${url.original_url}" target="_blank" title="${url.original_url}">${truncateString(url.original_url, 40)}</a></td>
                 <td class="url-date">${formatDateTime(createdAt)}</td>
                 <td class="url-date">${formatDateTime(expiresAt)}</td>
-                <td class="url-visits">${url.visits}</td>
+                <td class="url-visits">${url.visits}${url.disabled ? ` <span class="error" title="${escapeHtml(url.disabled_reason)}">已停用</span>` : ''}</td>
                 <td class="actions-cell">
                     <div class="btn-group">
                         <button class="btn btn-sm btn-outline-primary copy-url" data-url="${shortUrl}" title="复制链接">
@@ -361,6 +410,18 @@ function loadUserLinks() {
                         <button class="btn btn-sm btn-outline-info view-stats" data-code="${url.short_code}" title="查看统计">
                             <i class="bx bx-bar-chart-alt-2"></i>
                         </button>
+                        <button class="btn btn-sm btn-outline-secondary transfer-url" data-code="${url.short_code}" title="转移到其他空间">
+                            <i class="bx bx-transfer"></i>
+                        </button>
+                        <button class="btn btn-sm btn-outline-secondary set-campaign" data-code="${url.short_code}" data-campaign="${url.campaign_id || 0}" title="归入营销活动">
+                            <i class="bx bx-purchase-tag"></i>
+                        </button>
+                        <button class="btn btn-sm btn-outline-secondary toggle-tracking" data-code="${url.short_code}" data-no-tracking="${url.no_tracking ? 1 : 0}" title="${url.no_tracking ? '开启访问跟踪' : '关闭访问跟踪'}">
+                            <i class="bx ${url.no_tracking ? 'bx-show' : 'bx-hide'}"></i>
+                        </button>
+                        <button class="btn btn-sm btn-outline-danger erase-visits" data-code="${url.short_code}" title="删除访问数据">
+                            <i class="bx bx-eraser"></i>
+                        </button>
                         <button class="btn btn-sm btn-outline-danger delete-url" data-code="${url.short_code}" title="删除">
                             <i class="bx bx-trash"></i>
                         </button>
@@ -394,6 +455,30 @@ function loadUserLinks() {
             });
         });
         
+        document.querySelectorAll('.transfer-url').forEach(btn => {
+            btn.addEventListener('click', function() {
+                transferLink(this.getAttribute('data-code'));
+            });
+        });
+        
+        document.querySelectorAll('.set-campaign').forEach(btn => {
+            btn.addEventListener('click', function() {
+                setLinkCampaign(this.getAttribute('data-code'), this.getAttribute('data-campaign'));
+            });
+        });
+        
+        document.querySelectorAll('.toggle-tracking').forEach(btn => {
+            btn.addEventListener('click', function() {
+                setLinkTracking(this.getAttribute('data-code'), this.getAttribute('data-no-tracking') !== '1');
+            });
+        });
+        
+        document.querySelectorAll('.erase-visits').forEach(btn => {
+            btn.addEventListener('click', function() {
+                eraseLinkVisits(this.getAttribute('data-code'));
+            });
+        });
+        
         // 初始化搜索功能
         initLinksSearch(urls);
     })
@@ -456,9 +541,9 @@ function initStatsSearch() {
     
     // 获取所有链接用于搜索
     fetch('/api/urls', {
-        headers: {
+        headers: workspaceHeaders({
             'Authorization': `Bearer ${token}`
-        }
+        })
     })
     .then(response => response.json())
     .then(urls => {
@@ -541,14 +626,15 @@ function selectUrlForStats(code) {
     const statsContent = document.getElementById('stats-content');
     statsContent.innerHTML = '<div class="loading-spinner"><div class="spinner"></div></div>';
     
-    fetch(`/api/urls/${code}/stats`, {
+    currentStatsCode = code;
+    fetch(`/api/urls/${code}/stats?${statsRangeQuery('stats-range', 'stats-interval')}`, {
         headers: {
             'Authorization': `Bearer ${token}`
         }
     })
     .then(response => {
         if (!response.ok) {
-            throw new Error('加载统计数据失败');
+            return responseError(response, '加载统计数据失败').then(err => { throw err; });
         }
         return response.json();
     })
@@ -565,10 +651,13 @@ function selectUrlForStats(code) {
                 <button class="btn btn-primary mt-3" onclick="selectUrlForStats('${code}')">重试</button>
             </div>
         `;
-        showNotification('加载统计数据失败', 'error');
+        showNotification(error.message || '加载统计数据失败', 'error');
     });
 }
 
+// 当前查看统计的短码，切换时间范围时重新加载
+let currentStatsCode = null;
+
 // 渲染统计内容
 function renderStatsContent(code, stats) {
     const shortUrl = window.location.origin + '/' + code;
@@ -585,8 +674,17 @@ function renderStatsContent(code, stats) {
                         <div class="col">
                             <p><strong>短链接:</strong> <a href="${shortUrl}" target="_blank">${shortUrl}</a></p>
                             <p><strong>总访问量:</strong> ${stats.total_visits || 0}</p>
+                            <p><strong>独立访客:</strong> ${stats.unique_visitors || 0} <span class="text-muted">(估算值)</span></p>
+                            <p><strong>所选时间段:</strong> ${stats.range_visits || 0} 次访问，${stats.range_uniques || 0} 位独立访客</p>
+                            ${stats.sampled ? '<p class="text-muted">访问明细为抽样记录，趋势和来源分布是按抽样比例估算的结果</p>' : ''}
                         </div>
                         <div class="col text-right">
+                            <select id="export-format" class="form-control form-control-sm" title="导出格式">
+                                <option value="xlsx">Excel (XLSX)</option>
+                                <option value="csv">CSV</option>
+                                <option value="json">JSON</option>
+                            </select>
+                            <label><input type="checkbox" id="export-visits"> 包含访问明细</label>
                             <button id="export-stats" class="btn btn-primary" data-code="${code}">
                                 <i class="bx bx-download"></i> 导出数据
                             </button>
@@ -604,11 +702,22 @@ function renderStatsContent(code, stats) {
                 </div>
             </div>
             
+            <div class="card mb-4">
+                <div class="card-header">
+                    <h2>实时访问</h2>
+                </div>
+                <div class="card-body">
+                    <ul id="stats-live-clicks" class="list-unstyled">
+                        <li class="text-muted live-placeholder">等待访问...</li>
+                    </ul>
+                </div>
+            </div>
+            
             <div class="row">
                 <div class="col">
                     <div class="card mb-4">
                         <div class="card-header">
-                            <h2>主要来源网站</h2>
+                            <h2>访问来源</h2>
                         </div>
                         <div class="card-body">
                             <div id="referersChart"></div>
@@ -626,41 +735,137 @@ function renderStatsContent(code, stats) {
                     </div>
                 </div>
             </div>
+            
+            <div class="card mb-4">
+                <div class="card-header">
+                    <h2>地理分布</h2>
+                </div>
+                <div class="card-body">
+                    <div id="geoChart"></div>
+                </div>
+            </div>
+            
+            <div class="card mb-4">
+                <div class="card-header">
+                    <h2>机器人访问</h2>
+                </div>
+                <div class="card-body">
+                    <div id="botTraffic"></div>
+                </div>
+            </div>
         </div>
     `;
     
     // 渲染访问趋势图表
     renderUrlVisitsChart(stats.daily_visits || []);
     
-    // 渲染来源网站列表
-    renderReferersList(stats.top_referers || []);
+    // 渲染来源类型、域名和页面
+    renderReferersList(stats);
+    
+    // 渲染设备、浏览器和操作系统分布
+    renderUserAgentsList(stats);
+    
+    // 渲染国家、地区和城市分布
+    renderGeoList(stats);
     
-    // 渲染用户代理列表
-    renderUserAgentsList(stats.top_user_agents || []);
+    // 渲染机器人访问统计
+    renderBotTraffic(stats.bots || {});
     
     // 添加导出事件
     document.getElementById('export-stats').addEventListener('click', function() {
         const code = this.getAttribute('data-code');
         exportStats(code);
     });
+    
+    openLiveClicks(`/api/urls/${code}/live`, 'stats-live-clicks');
+}
+
+const LIVE_DEVICE_ICONS = {
+    desktop: 'bx-desktop',
+    mobile: 'bx-mobile',
+    tablet: 'bx-tab',
+    bot: 'bx-bot'
+};
+const LIVE_CLICKS_MAX = 20;
+
+let liveSource = null;
+let liveRetryTimer = null;
+
+// 通过Server-Sent Events接收实时访问，同一时间只保持一个连接
+function openLiveClicks(path, listId) {
+    closeLiveClicks();
+    const token = getAuthToken();
+    if (!token) {
+        return;
+    }
+    
+    const params = new URLSearchParams({ token: token });
+    if (getActiveWorkspace() !== '0') {
+        params.set('workspace_id', getActiveWorkspace());
+    }
+    
+    const source = new EventSource(`${path}?${params}`);
+    source.addEventListener('click', event => prependLiveClick(listId, JSON.parse(event.data)));
+    source.onerror = () => {
+        // 连接被服务端结束或令牌失效时浏览器不再自动重连，稍后使用最新的令牌重新连接
+        if (source.readyState === EventSource.CLOSED && liveSource === source) {
+            liveRetryTimer = setTimeout(() => openLiveClicks(path, listId), 5000);
+        }
+    };
+    liveSource = source;
+}
+
+// 关闭实时访问连接
+function closeLiveClicks() {
+    clearTimeout(liveRetryTimer);
+    if (liveSource) {
+        liveSource.close();
+        liveSource = null;
+    }
+}
+
+// 在列表顶部显示一条访问
+function prependLiveClick(listId, click) {
+    const list = document.getElementById(listId);
+    if (!list) {
+        return;
+    }
+    if (list.querySelector('.live-placeholder')) {
+        list.innerHTML = '';
+    }
+    
+    const item = document.createElement('li');
+    item.className = 'mb-2';
+    item.innerHTML = `
+        <i class="bx ${LIVE_DEVICE_ICONS[click.device] || 'bx-globe'}"></i>
+        <span class="url-date">${formatDateTime(new Date(click.time))}</span>
+        <strong>${escapeHtml(click.short_code)}</strong>
+        ${escapeHtml(click.browser)} ${escapeHtml(click.browser_version)} / ${escapeHtml(click.os)}
+        <span class="text-muted">来自 ${click.referer_host ? escapeHtml(click.referer_host) : '直接访问'}</span>
+    `;
+    list.prepend(item);
+    while (list.children.length > LIVE_CLICKS_MAX) {
+        list.lastElementChild.remove();
+    }
 }
 
-// 渲染URL访问趋势图表
-function renderUrlVisitsChart(dailyVisits) {
-    const ctx = document.getElementById('urlVisitsChart').getContext('2d');
+// 渲染URL访问趋势图表，图表实例以画布ID保存在window上
+function renderUrlVisitsChart(dailyVisits, canvasId = 'urlVisitsChart') {
+    const ctx = document.getElementById(canvasId).getContext('2d');
     
     // 检查是否已存在图表实例并销毁
-    if (window.urlVisitsChart && typeof window.urlVisitsChart.destroy === 'function') {
-        window.urlVisitsChart.destroy();
+    if (window[canvasId] && typeof window[canvasId].destroy === 'function') {
+        window[canvasId].destroy();
     }
     
     // 准备数据
-    dailyVisits.sort((a, b) => new Date(a.date) - new Date(b.date));
-    const labels = dailyVisits.map(item => formatDate(new Date(item.date)));
+    dailyVisits.sort((a, b) => a.date.localeCompare(b.date));
+    const labels = dailyVisits.map(item => item.date);
     const data = dailyVisits.map(item => item.count);
+    const uniques = dailyVisits.map(item => item.uniques || 0);
     
     // 创建图表
-    window.urlVisitsChart = new Chart(ctx, {
+    window[canvasId] = new Chart(ctx, {
         type: 'line',
         data: {
             labels: labels,
@@ -671,7 +876,7 @@ function renderUrlVisitsChart(dailyVisits) {
                 backgroundColor: 'rgba(52, 152, 219, 0.1)',
                 borderColor: 'rgba(52, 152, 219, 1)',
                 tension: 0.4
-            }]
+            }, uniqueVisitorsDataset(uniques)]
         },
         options: {
             responsive: true,
@@ -694,200 +899,1576 @@ function renderUrlVisitsChart(dailyVisits) {
     });
 }
 
-// 渲染来源网站列表
-function renderReferersList(referers) {
-    const container = document.getElementById('referersChart');
-    
-    if (!referers || referers.length === 0) {
+// 独立访客数的折线，与访问量画在同一图表中
+function uniqueVisitorsDataset(data) {
+    return {
+        label: '独立访客',
+        data: data,
+        fill: false,
+        borderColor: 'rgba(46, 204, 113, 1)',
+        backgroundColor: 'rgba(46, 204, 113, 0.1)',
+        tension: 0.4
+    };
+}
+
+const REFERER_CATEGORY_NAMES = {
+    direct: '直接访问',
+    search: '搜索引擎',
+    social: '社交网络',
+    email: '邮件',
+    referral: '其他网站'
+};
+
+// 渲染来源类型、来源域名和来源页面
+function renderReferersList(stats, containerId = 'referersChart') {
+    const container = document.getElementById(containerId);
+    const categories = (stats.referer_categories || []).map(c => ({ name: REFERER_CATEGORY_NAMES[c.name] || c.name, count: c.count }));
+    const sections = [
+        ['来源类型', categories],
+        ['来源域名', stats.referer_domains || []],
+        ['来源页面', (stats.top_referers || []).map(referer => ({ name: referer.url, count: referer.count }))]
+    ].filter(([, items]) => items.length > 0);
+    
+    if (sections.length === 0) {
         container.innerHTML = '<div class="empty-state"><p>暂无来源数据</p></div>';
         return;
     }
     
-    let html = '<ul class="detail-list">';
-    referers.forEach(referer => {
-        const url = referer.url || '直接访问';
-        html += `
-            <li>
-                <span class="detail-label" title="${url}">${truncateString(url, 30)}</span>
-                <span class="detail-value">${referer.count}</span>
-            </li>
-        `;
-    });
-    html += '</ul>';
-    
-    container.innerHTML = html;
+    container.innerHTML = sections.map(([title, items]) => `
+        <p class="mt-2"><strong>${title}</strong></p>
+        ${renderDetailList(items.slice(0, 5))}
+    `).join('');
 }
 
-// 渲染用户代理列表
-function renderUserAgentsList(userAgents) {
-    const container = document.getElementById('userAgentsChart');
-    
-    if (!userAgents || userAgents.length === 0) {
+const DEVICE_NAMES = {
+    desktop: '桌面设备',
+    mobile: '手机',
+    tablet: '平板',
+    bot: '爬虫',
+    unknown: '未知'
+};
+
+// 渲染设备类型、浏览器和操作系统分布
+function renderUserAgentsList(stats, containerId = 'userAgentsChart') {
+    const container = document.getElementById(containerId);
+    const devices = (stats.devices || []).map(d => ({ name: DEVICE_NAMES[d.name] || d.name, count: d.count }));
+    const sections = [
+        ['设备类型', devices],
+        ['浏览器', stats.browsers || []],
+        ['浏览器版本', stats.browser_versions || []],
+        ['操作系统', stats.operating_systems || []]
+    ].filter(([, items]) => items.length > 0);
+    
+    if (sections.length === 0) {
         container.innerHTML = '<div class="empty-state"><p>暂无设备/浏览器数据</p></div>';
         return;
     }
     
-    let html = '<ul class="detail-list">';
-    userAgents.forEach(ua => {
-        html += `
-            <li>
-                <span class="detail-label" title="${ua.name}">${truncateString(ua.name, 30)}</span>
-                <span class="detail-value">${ua.count}</span>
-            </li>
-        `;
-    });
-    html += '</ul>';
-    
-    container.innerHTML = html;
+    container.innerHTML = sections.map(([title, items]) => `
+        <p class="mt-2"><strong>${title}</strong></p>
+        ${renderDetailList(items.slice(0, 5))}
+    `).join('');
 }
 
-// 加载管理员面板数据
-function loadAdminData() {
-    const token = getAuthToken();
-    if (!token) {
-        redirectToLogin();
+const regionNames = typeof Intl.DisplayNames === 'function'
+    ? new Intl.DisplayNames(['zh-CN'], { type: 'region' })
+    : null;
+
+// countryName 将ISO国家代码转换为中文名称
+function countryName(code) {
+    try {
+        return (regionNames && regionNames.of(code)) || code;
+    } catch (e) {
+        return code;
+    }
+}
+
+// withCountryName 将 "CN 广东" 形式的名称中的国家代码替换为国家名称
+function withCountryName(item) {
+    const [code, ...rest] = item.name.split(' ');
+    return { name: `${countryName(code)} ${rest.join(' ')}`.trim(), count: item.count };
+}
+
+// 渲染国家、地区和城市分布
+function renderGeoList(stats, containerId = 'geoChart') {
+    const container = document.getElementById(containerId);
+    const sections = [
+        ['国家/地区', (stats.countries || []).map(c => ({ name: countryName(c.name), count: c.count }))],
+        ['省/州', (stats.regions || []).map(withCountryName)],
+        ['城市', (stats.cities || []).map(withCountryName)]
+    ].filter(([, items]) => items.length > 0);
+    
+    if (sections.length === 0) {
+        container.innerHTML = '<div class="empty-state"><p>暂无地理位置数据</p></div>';
         return;
     }
     
-    // 显示加载状态
-    document.getElementById('total-users').textContent = '-';
-    document.getElementById('admin-total-links').textContent = '-';
-    document.getElementById('expired-links').textContent = '-';
-    document.getElementById('users-table').innerHTML = '<tr><td colspan="7" class="text-center">加载中...</td></tr>';
-    
-    // 获取管理员统计数据
-    fetch('/api/admin/stats', {
-        headers: {
-            'Authorization': `Bearer ${token}`
-        }
-    })
-    .then(response => {
-        if (!response.ok) {
-            throw new Error('加载管理员数据失败');
-        }
-        return response.json();
-    })
-    .then(data => {
-        // 更新统计卡片
-        document.getElementById('total-users').textContent = data.total_users || 0;
-        document.getElementById('admin-total-links').textContent = data.total_links || 0;
-        document.getElementById('expired-links').textContent = data.expired_links || 0;
-        
-        // 确保显示总访问量
-        if (document.getElementById('admin-total-visits')) {
-            document.getElementById('admin-total-visits').textContent = data.total_visits || 0;
-        }
-        
-        // 加载用户列表
-        loadUsersList();
-        
-        // 添加清理按钮事件
-        document.getElementById('cleanup-btn').addEventListener('click', cleanupExpiredUrls);
-        
-        // 添加备份按钮事件
-        document.getElementById('backup-btn').addEventListener('click', exportSystemData);
-    })
-    .catch(error => {
-        console.error('Error:', error);
-        showNotification('加载管理员数据失败', 'error');
-    });
+    container.innerHTML = '<div class="row">' + sections.map(([title, items]) => `
+        <div class="col">
+            <p class="mt-2"><strong>${title}</strong></p>
+            ${renderDetailList(items)}
+        </div>
+    `).join('') + '</div>';
 }
 
-// 加载用户列表
-function loadUsersList() {
-    const token = getAuthToken();
-    if (!token) {
-        redirectToLogin();
+const BOT_REASON_NAMES = {
+    crawler: '爬虫/链接预览',
+    headless: '无头浏览器/脚本',
+    head: 'HEAD 请求',
+    prefetch: '预加载'
+};
+
+// 渲染机器人访问的识别原因和来源，这些访问不计入访问量
+function renderBotTraffic(bots) {
+    const container = document.getElementById('botTraffic');
+    if (!bots.visits) {
+        container.innerHTML = '<div class="empty-state"><p>暂无机器人访问</p></div>';
         return;
     }
     
-    const usersTable = document.getElementById('users-table');
-    
-    fetch('/api/admin/users', {
-        headers: {
-            'Authorization': `Bearer ${token}`
-        }
-    })
-    .then(response => {
-        if (!response.ok) {
-            throw new Error('加载用户列表失败');
-        }
-        return response.json();
-    })
-    .then(users => {
-        if (users.length === 0) {
-            usersTable.innerHTML = '<tr><td colspan="7" class="text-center">暂无用户数据</td></tr>';
+    const reasons = (bots.reasons || []).map(r => ({ name: BOT_REASON_NAMES[r.name] || r.name, count: r.count }));
+    container.innerHTML = `
+        <p class="text-muted">共 ${bots.visits} 次，聊天软件的链接预览、爬虫和预加载等访问不计入访问量和上面的分布</p>
+        <div class="row">
+            <div class="col">
+                <p class="mt-2"><strong>识别原因</strong></p>
+                ${renderDetailList(reasons)}
+            </div>
+            <div class="col">
+                <p class="mt-2"><strong>来源</strong></p>
+                ${renderDetailList(bots.agents || [])}
+            </div>
+        </div>
+    `;
+}
+
+// 渲染名称和数量列表，名称来自访问请求，需要转义
+function renderDetailList(items) {
+    return '<ul class="detail-list">' + items.map(item => `
+        <li>
+            <span class="detail-label" title="${escapeHtml(item.name)}">${escapeHtml(truncateString(item.name, 30))}</span>
+            <span class="detail-value">${item.count}</span>
+        </li>
+    `).join('') + '</ul>';
+}
+
+const UTM_FIELDS = ['utm_source', 'utm_medium', 'utm_campaign', 'utm_term', 'utm_content'];
+
+// 当前查看统计的营销活动，切换时间范围时重新加载
+let currentCampaignId = null;
+
+// 加载当前空间的营销活动列表
+function loadCampaigns() {
+    const tableBody = document.getElementById('campaigns-table');
+    authFetch('/api/campaigns', { headers: workspaceHeaders({}) })
+    .then(campaigns => {
+        if (campaigns.length === 0) {
+            tableBody.innerHTML = '<tr><td colspan="5" class="text-center">还没有营销活动</td></tr>';
             return;
         }
         
-        usersTable.innerHTML = '';
-        users.forEach(user => {
-            const row = document.createElement('tr');
-            
-            // 格式化日期
-            const createdAt = new Date(user.CreatedAt);
-            const lastLogin = new Date(user.last_login_at);
-            
-            row.innerHTML = `
-                <td>${user.ID}</td>
-                <td>${user.username}</td>
-                <td>${user.email}</td>
-                <td>${formatDateTime(createdAt)}</td>
-                <td>${user.links_count || 0}</td>
-                <td>${formatDateTime(lastLogin)}</td>
+        tableBody.innerHTML = campaigns.map(campaign => `
+            <tr>
+                <td>${escapeHtml(campaign.name)}</td>
+                <td class="url-original" title="${escapeHtml(campaign.description)}">${escapeHtml(truncateString(campaign.description, 40))}</td>
+                <td>${campaign.links_count}</td>
+                <td>${campaign.total_visits}</td>
                 <td class="actions-cell">
                     <div class="btn-group">
-                        <button class="btn btn-sm btn-outline-primary" onclick="viewUserLinks(${user.ID})" title="查看链接">
-                            <i class="bx bx-link"></i>
-                        </button>
-                        <button class="btn btn-sm btn-outline-danger" onclick="resetUserPassword(${user.ID})" title="重置密码">
-                            <i class="bx bx-reset"></i>
-                        </button>
+                        <button class="btn btn-sm btn-outline-info" onclick="loadCampaignStats(${campaign.ID})" title="查看统计"><i class="bx bx-bar-chart-alt-2"></i></button>
+                        <button class="btn btn-sm btn-outline-primary" onclick="renameCampaign(${campaign.ID})" title="修改"><i class="bx bx-edit"></i></button>
+                        <button class="btn btn-sm btn-danger" onclick="deleteCampaign(${campaign.ID})" title="删除"><i class="bx bx-trash"></i></button>
                     </div>
                 </td>
-            `;
-            
-            usersTable.appendChild(row);
-        });
+            </tr>
+        `).join('');
     })
     .catch(error => {
-        console.error('Error:', error);
-        usersTable.innerHTML = '<tr><td colspan="7" class="text-center">加载失败，请刷新页面重试</td></tr>';
-        showNotification('加载用户列表失败', 'error');
+        tableBody.innerHTML = '<tr><td colspan="5" class="text-center">加载失败</td></tr>';
+        showNotification(error.message, 'error');
     });
 }
 
-// 清理过期URL
-function cleanupExpiredUrls() {
-    if (!confirm('确定要清理所有过期的短链接？此操作不可恢复。')) {
+// 加载创建短链接表单中的营销活动选项
+function loadCampaignOptions() {
+    const select = document.getElementById('create-campaign');
+    authFetch('/api/campaigns', { headers: workspaceHeaders({}) })
+    .then(campaigns => {
+        select.innerHTML = '<option value="0">不归入活动</option>' + campaigns.map(campaign =>
+            `<option value="${campaign.ID}">${escapeHtml(campaign.name)}</option>`
+        ).join('');
+    })
+    .catch(error => console.error('加载营销活动失败:', error));
+}
+
+// 在当前空间创建营销活动
+function createCampaign() {
+    const name = document.getElementById('campaign-name');
+    const description = document.getElementById('campaign-description');
+    if (!name.value.trim()) {
+        showNotification('请输入活动名称', 'error');
         return;
     }
     
-    const token = getAuthToken();
-    if (!token) {
-        redirectToLogin();
+    authFetch('/api/campaigns', {
+        method: 'POST',
+        headers: workspaceHeaders({}),
+        body: JSON.stringify({ name: name.value.trim(), description: description.value.trim() })
+    })
+    .then(() => {
+        name.value = '';
+        description.value = '';
+        showNotification('营销活动已创建', 'success');
+        loadCampaigns();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 修改营销活动名称，已创建链接的 utm_campaign 不变
+function renameCampaign(id) {
+    const name = prompt('新的活动名称(已创建链接中的 utm_campaign 不会修改):');
+    if (name === null || name.trim() === '') {
         return;
     }
     
-    const cleanupBtn = document.getElementById('cleanup-btn');
-    
-    // 显示加载状态
-    cleanupBtn.disabled = true;
-    cleanupBtn.innerHTML = '<i class="bx bx-loader-alt bx-spin"></i> 清理中...';
+    authFetch(`/api/campaigns/${id}`, {
+        method: 'PATCH',
+        body: JSON.stringify({ name: name.trim() })
+    })
+    .then(() => {
+        showNotification('营销活动已修改', 'success');
+        loadCampaigns();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 删除营销活动，活动中的链接保留
+function deleteCampaign(id) {
+    if (!confirm('确定删除该营销活动吗？活动中的链接不会被删除。')) {
+        return;
+    }
     
-    fetch('/api/urls/cleanup', {
-        method: 'POST',
-        headers: {
-            'Authorization': `Bearer ${token}`
+    authFetch(`/api/campaigns/${id}`, { method: 'DELETE' })
+    .then(() => {
+        showNotification('营销活动已删除', 'success');
+        if (currentCampaignId === id) {
+            currentCampaignId = null;
+            document.getElementById('campaign-stats').style.display = 'none';
         }
+        loadCampaigns();
     })
-    .then(response => {
-        if (!response.ok) {
-            throw new Error('清理过期链接失败');
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 将已有链接归入当前空间的营销活动，输入0时移出活动
+function setLinkCampaign(code, current) {
+    authFetch('/api/campaigns', { headers: workspaceHeaders({}) })
+    .then(campaigns => {
+        if (campaigns.length === 0) {
+            showNotification('当前空间还没有营销活动', 'error');
+            return;
         }
-        return response.json();
+        const choices = ['0: 不归入活动'].concat(campaigns.map(campaign => `${campaign.ID}: ${campaign.name}`)).join('\n');
+        const target = prompt(`输入活动编号:\n${choices}`, current);
+        if (target === null || target.trim() === '') {
+            return;
+        }
+        return authFetch(`/api/urls/${code}/campaign`, {
+            method: 'PUT',
+            body: JSON.stringify({ campaign_id: parseInt(target, 10) || 0 })
+        })
+        .then(() => {
+            showNotification('链接所属活动已更新', 'success');
+            loadUserLinks();
+        });
     })
-    .then(data => {
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 开启或关闭链接的访问跟踪
+function setLinkTracking(code, noTracking) {
+    authFetch(`/api/urls/${code}/tracking`, {
+        method: 'PUT',
+        body: JSON.stringify({ no_tracking: noTracking })
+    })
+    .then(() => {
+        showNotification(noTracking ? '已关闭访问跟踪，只累计访问次数' : '已开启访问跟踪', 'success');
+        loadUserLinks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 删除链接的全部访问数据
+function eraseLinkVisits(code) {
+    if (!confirm(`确定要删除 ${code} 的全部访问数据吗？访问次数和统计将清零，此操作不可恢复`)) {
+        return;
+    }
+    authFetch(`/api/urls/${code}/visits`, { method: 'DELETE' })
+    .then(data => {
+        showNotification(`已删除 ${data.erased} 条访问明细`, 'success');
+        loadUserLinks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 加载营销活动的汇总统计
+function loadCampaignStats(id) {
+    currentCampaignId = id;
+    const container = document.getElementById('campaign-stats');
+    const content = document.getElementById('campaign-stats-content');
+    container.style.display = 'block';
+    content.innerHTML = '<div class="loading-spinner"><div class="spinner"></div></div>';
+    
+    authFetch(`/api/campaigns/${id}/stats?${statsRangeQuery('campaign-range', 'campaign-interval')}`)
+    .then(stats => renderCampaignStats(stats))
+    .catch(error => {
+        content.innerHTML = '<div class="empty-state"><p>加载统计数据失败</p></div>';
+        showNotification(error.message, 'error');
+    });
+}
+
+// 渲染营销活动的汇总统计，趋势和分布的口径与单个链接相同
+function renderCampaignStats(stats) {
+    document.getElementById('campaign-stats-title').textContent = `活动统计: ${stats.campaign.name}`;
+    const content = document.getElementById('campaign-stats-content');
+    const utmSections = [
+        ['来源 (utm_source)', stats.utm_sources || []],
+        ['媒介 (utm_medium)', stats.utm_mediums || []],
+        ['内容 (utm_content)', stats.utm_contents || []]
+    ].filter(([, items]) => items.length > 0);
+    
+    content.innerHTML = `
+        <div class="card mb-4">
+            <div class="card-header">
+                <h2>活动概览</h2>
+            </div>
+            <div class="card-body">
+                <p><strong>链接数:</strong> ${stats.links.length}</p>
+                <p><strong>总访问量:</strong> ${stats.total_visits || 0}</p>
+                <p><strong>独立访客:</strong> ${stats.unique_visitors || 0} <span class="text-muted">(估算值)</span></p>
+                <p><strong>所选时间段:</strong> ${stats.range_visits || 0} 次访问，${stats.range_uniques || 0} 位独立访客</p>
+                ${stats.sampled ? '<p class="text-muted">访问明细为抽样记录，趋势和来源分布是按抽样比例估算的结果</p>' : ''}
+            </div>
+        </div>
+        
+        <div class="card mb-4">
+            <div class="card-header">
+                <h2>访问趋势</h2>
+            </div>
+            <div class="chart-container" style="height: 300px;">
+                <canvas id="campaignVisitsChart"></canvas>
+            </div>
+        </div>
+        
+        <div class="card mb-4">
+            <div class="card-header">
+                <h2>活动链接</h2>
+            </div>
+            <div class="card-body">
+                <div class="table-responsive">
+                    <table class="table">
+                        <thead>
+                            <tr>
+                                <th>短码</th>
+                                <th>来源 / 媒介 / 内容</th>
+                                <th>所选时间段</th>
+                                <th>总访问量</th>
+                            </tr>
+                        </thead>
+                        <tbody>
+                            ${stats.links.length === 0 ? '<tr><td colspan="4" class="text-center">活动中还没有链接</td></tr>' : stats.links.map(link => `
+                                <tr>
+                                    <td class="url-code"><a href="#stats" onclick="selectUrlForStats('${link.short_code}')" title="${escapeHtml(link.original_url)}">${link.short_code}</a></td>
+                                    <td>${[link.utm_source, link.utm_medium, link.utm_content].map(value => escapeHtml(value || '-')).join(' / ')}</td>
+                                    <td>${link.range_visits}</td>
+                                    <td>${link.total_visits}</td>
+                                </tr>
+                            `).join('')}
+                        </tbody>
+                    </table>
+                </div>
+            </div>
+        </div>
+        
+        <div class="row">
+            <div class="col">
+                <div class="card mb-4">
+                    <div class="card-header">
+                        <h2>UTM参数</h2>
+                    </div>
+                    <div class="card-body">
+                        ${utmSections.length === 0 ? '<div class="empty-state"><p>活动中的链接没有填写UTM参数</p></div>' : utmSections.map(([title, items]) => `
+                            <p class="mt-2"><strong>${title}</strong></p>
+                            ${renderDetailList(items.slice(0, 5))}
+                        `).join('')}
+                    </div>
+                </div>
+            </div>
+            <div class="col">
+                <div class="card mb-4">
+                    <div class="card-header">
+                        <h2>访问来源</h2>
+                    </div>
+                    <div class="card-body">
+                        <div id="campaignReferers"></div>
+                    </div>
+                </div>
+            </div>
+        </div>
+        
+        <div class="row">
+            <div class="col">
+                <div class="card mb-4">
+                    <div class="card-header">
+                        <h2>设备与浏览器</h2>
+                    </div>
+                    <div class="card-body">
+                        <div id="campaignUserAgents"></div>
+                    </div>
+                </div>
+            </div>
+            <div class="col">
+                <div class="card mb-4">
+                    <div class="card-header">
+                        <h2>地理分布</h2>
+                    </div>
+                    <div class="card-body">
+                        <div id="campaignGeo"></div>
+                    </div>
+                </div>
+            </div>
+        </div>
+    `;
+    
+    renderUrlVisitsChart(stats.daily_visits || [], 'campaignVisitsChart');
+    renderReferersList(stats, 'campaignReferers');
+    renderUserAgentsList(stats, 'campaignUserAgents');
+    renderGeoList(stats, 'campaignGeo');
+}
+
+// 加载账户安全选项卡
+function loadSecurityTab() {
+    const status = document.getElementById('two-factor-status');
+    const actions = document.getElementById('two-factor-actions');
+    const enabled = status.getAttribute('data-enabled') === 'true';
+    
+    status.textContent = enabled ? '状态：已启用' : '状态：未启用';
+    document.getElementById('two-factor-setup').style.display = 'none';
+    
+    if (enabled) {
+        actions.innerHTML = `
+            <button class="btn btn-outline-primary" onclick="regenerateRecoveryCodes()">重新生成恢复码</button>
+            <button class="btn btn-danger" onclick="disableTwoFactor()">关闭两步验证</button>
+        `;
+    } else {
+        actions.innerHTML = '<button class="btn btn-primary" onclick="setupTwoFactor()">启用两步验证</button>';
+    }
+}
+
+// 修改密码，成功后其他会话失效，使用返回的新令牌继续当前会话
+function changePassword() {
+    const current = document.getElementById('current-password').value;
+    const password = document.getElementById('new-password').value;
+    const confirmPassword = document.getElementById('new-password-confirm').value;
+    
+    if (!current || !password) {
+        showNotification('请输入当前密码和新密码', 'error');
+        return;
+    }
+    if (password.length < 6) {
+        showNotification('新密码长度至少需要6个字符', 'error');
+        return;
+    }
+    if (password !== confirmPassword) {
+        showNotification('两次输入的密码不一致', 'error');
+        return;
+    }
+    
+    authFetch('/api/auth/password', {
+        method: 'PUT',
+        body: JSON.stringify({ current_password: current, new_password: password })
+    })
+    .then(data => {
+        document.cookie = `auth_token=${data.token}; path=/; max-age=${24*60*60}`;
+        localStorage.setItem('refresh_token', data.refresh_token);
+        ['current-password', 'new-password', 'new-password-confirm'].forEach(id => {
+            document.getElementById(id).value = '';
+        });
+        document.getElementById('password-card').removeAttribute('data-must-change');
+        showNotification(data.message, 'success');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 生成两步验证密钥
+function setupTwoFactor() {
+    authFetch('/api/auth/2fa/setup', { method: 'POST' })
+    .then(data => {
+        document.getElementById('two-factor-qr').src = data.qr_code;
+        document.getElementById('two-factor-secret').textContent = data.secret;
+        document.getElementById('two-factor-setup').style.display = 'block';
+        document.getElementById('two-factor-enable-btn').onclick = enableTwoFactor;
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 确认启用两步验证
+function enableTwoFactor() {
+    const code = document.getElementById('two-factor-enable-code').value.trim();
+    if (!code) {
+        showNotification('请输入验证码', 'error');
+        return;
+    }
+    
+    authFetch('/api/auth/2fa/enable', {
+        method: 'POST',
+        body: JSON.stringify({ code: code })
+    })
+    .then(data => {
+        document.getElementById('two-factor-status').setAttribute('data-enabled', 'true');
+        loadSecurityTab();
+        showRecoveryCodes(data.recovery_codes);
+        showNotification(data.message, 'success');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 关闭两步验证
+function disableTwoFactor() {
+    // 单点登录账户没有本地密码，只需验证码或恢复码
+    let password = '';
+    if (document.getElementById('two-factor-status').getAttribute('data-auth-provider') === 'local') {
+        password = prompt('请输入当前密码');
+        if (!password) return;
+    }
+    const code = prompt('请输入验证码或恢复码');
+    if (!code) return;
+    
+    authFetch('/api/auth/2fa/disable', {
+        method: 'POST',
+        body: JSON.stringify({ password: password, code: code })
+    })
+    .then(data => {
+        document.getElementById('two-factor-status').setAttribute('data-enabled', 'false');
+        document.getElementById('recovery-codes').style.display = 'none';
+        loadSecurityTab();
+        showNotification(data.message, 'success');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 重新生成恢复码
+function regenerateRecoveryCodes() {
+    const code = prompt('请输入身份验证器中的6位验证码');
+    if (!code) return;
+    
+    authFetch('/api/auth/2fa/recovery-codes', {
+        method: 'POST',
+        body: JSON.stringify({ code: code })
+    })
+    .then(data => {
+        showRecoveryCodes(data.recovery_codes);
+        showNotification(data.message, 'success');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 显示恢复码
+function showRecoveryCodes(codes) {
+    document.getElementById('recovery-codes-list').textContent = (codes || []).join('\n');
+    document.getElementById('recovery-codes').style.display = 'block';
+}
+
+const WEBHOOK_EVENT_NAMES = {
+    'link.created': '链接创建',
+    'link.deleted': '链接删除',
+    'link.clicked': '链接访问'
+};
+
+const WEBHOOK_DELIVERY_STATUS_NAMES = {
+    pending: '等待重试',
+    success: '成功',
+    failed: '失败'
+};
+
+// 加载Webhook列表
+function loadWebhooks() {
+    const tableBody = document.getElementById('webhooks-table');
+    authFetch('/api/webhooks')
+    .then(data => {
+        const events = document.getElementById('webhook-events');
+        if (!events.hasChildNodes()) {
+            events.innerHTML = data.events.map(event => `
+                <label class="mr-3"><input type="checkbox" name="webhook-event" value="${event}" checked> ${WEBHOOK_EVENT_NAMES[event] || event}</label>
+            `).join('');
+        }
+        
+        if (data.webhooks.length === 0) {
+            tableBody.innerHTML = '<tr><td colspan="4" class="text-center">还没有配置Webhook</td></tr>';
+            return;
+        }
+        
+        tableBody.innerHTML = data.webhooks.map(hook => `
+            <tr>
+                <td class="url-original" title="${escapeHtml(hook.url)}">${escapeHtml(truncateString(hook.url, 40))}</td>
+                <td>${hook.events.split(',').map(event => WEBHOOK_EVENT_NAMES[event] || escapeHtml(event)).join('、')}</td>
+                <td>${hook.active ? '启用' : '<span class="error">已暂停</span>'}</td>
+                <td class="actions-cell">
+                    <div class="btn-group">
+                        <button class="btn btn-sm btn-outline-primary" onclick="testWebhook(${hook.id})" title="发送测试事件"><i class="bx bx-send"></i></button>
+                        <button class="btn btn-sm btn-outline-primary" onclick="loadWebhookDeliveries(${hook.id})" title="投递记录"><i class="bx bx-list-ul"></i></button>
+                        <button class="btn btn-sm btn-outline-primary" onclick="toggleWebhook(${hook.id}, ${!hook.active})" title="${hook.active ? '暂停' : '启用'}">
+                            <i class="bx ${hook.active ? 'bx-pause' : 'bx-play'}"></i>
+                        </button>
+                        <button class="btn btn-sm btn-danger" onclick="deleteWebhook(${hook.id})" title="删除"><i class="bx bx-trash"></i></button>
+                    </div>
+                </td>
+            </tr>
+        `).join('');
+    })
+    .catch(error => {
+        tableBody.innerHTML = '<tr><td colspan="4" class="text-center">加载失败</td></tr>';
+        showNotification(error.message, 'error');
+    });
+}
+
+// 创建Webhook，签名密钥只在创建时返回
+function createWebhook() {
+    const input = document.getElementById('webhook-url');
+    const url = input.value.trim();
+    const events = Array.from(document.querySelectorAll('input[name="webhook-event"]:checked')).map(el => el.value);
+    if (!url) {
+        showNotification('请输入Webhook地址', 'error');
+        return;
+    }
+    if (events.length === 0) {
+        showNotification('请至少选择一个事件', 'error');
+        return;
+    }
+    
+    authFetch('/api/webhooks', {
+        method: 'POST',
+        body: JSON.stringify({ url: url, events: events })
+    })
+    .then(data => {
+        input.value = '';
+        document.getElementById('webhook-secret-value').textContent = data.secret;
+        document.getElementById('webhook-secret').style.display = 'block';
+        showNotification('Webhook已创建', 'success');
+        loadWebhooks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 暂停或启用Webhook
+function toggleWebhook(id, active) {
+    authFetch(`/api/webhooks/${id}`, {
+        method: 'PATCH',
+        body: JSON.stringify({ active: active })
+    })
+    .then(() => {
+        showNotification(active ? 'Webhook已启用' : 'Webhook已暂停', 'success');
+        loadWebhooks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 删除Webhook
+function deleteWebhook(id) {
+    if (!confirm('确定要删除这个Webhook吗？')) {
+        return;
+    }
+    
+    authFetch(`/api/webhooks/${id}`, { method: 'DELETE' })
+    .then(() => {
+        showNotification('Webhook已删除', 'success');
+        document.getElementById('webhook-deliveries-card').style.display = 'none';
+        loadWebhooks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 发送测试事件并显示投递结果
+function testWebhook(id) {
+    authFetch(`/api/webhooks/${id}/test`, { method: 'POST' })
+    .then(delivery => {
+        if (delivery.status === 'success') {
+            showNotification(`测试事件投递成功 (HTTP ${delivery.last_status_code})`, 'success');
+        } else {
+            showNotification(`测试事件投递失败: ${delivery.last_error || 'HTTP ' + delivery.last_status_code}`, 'error');
+        }
+        loadWebhookDeliveries(id);
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 查看Webhook投递记录
+function loadWebhookDeliveries(id) {
+    const card = document.getElementById('webhook-deliveries-card');
+    const tableBody = document.getElementById('webhook-deliveries-table');
+    card.style.display = 'block';
+    document.getElementById('webhook-deliveries-title').textContent = `投递记录 #${id}`;
+    tableBody.innerHTML = '<tr><td colspan="5" class="text-center">加载中...</td></tr>';
+    
+    authFetch(`/api/webhooks/${id}/deliveries?limit=50`)
+    .then(deliveries => {
+        if (deliveries.length === 0) {
+            tableBody.innerHTML = '<tr><td colspan="5" class="text-center">暂无投递记录</td></tr>';
+            return;
+        }
+        
+        tableBody.innerHTML = deliveries.map(d => `
+            <tr>
+                <td>${formatDateTime(new Date(d.created_at))}</td>
+                <td>${escapeHtml(d.event)}</td>
+                <td>${d.status === 'failed'
+                    ? `<span class="error">${WEBHOOK_DELIVERY_STATUS_NAMES[d.status]}</span>`
+                    : WEBHOOK_DELIVERY_STATUS_NAMES[d.status] || escapeHtml(d.status)}</td>
+                <td>${d.attempts}</td>
+                <td title="${escapeHtml(d.last_error || '')}">${d.last_status_code ? 'HTTP ' + d.last_status_code : escapeHtml(truncateString(d.last_error || '-', 40))}</td>
+            </tr>
+        `).join('');
+    })
+    .catch(error => {
+        tableBody.innerHTML = '<tr><td colspan="5" class="text-center">加载失败</td></tr>';
+        showNotification(error.message, 'error');
+    });
+}
+
+// 搜索所有链接，供审核员停用、恢复或删除
+function loadModerationLinks() {
+    const tableBody = document.getElementById('moderation-table');
+    const params = new URLSearchParams({ q: document.getElementById('moderation-query').value.trim() });
+    if (document.getElementById('moderation-disabled-only').checked) {
+        params.set('disabled', 'true');
+    }
+    
+    tableBody.innerHTML = '<tr><td colspan="6" class="text-center">加载中...</td></tr>';
+    authFetch(`/api/moderation/links?${params}`)
+    .then(data => {
+        if (data.items.length === 0) {
+            tableBody.innerHTML = '<tr><td colspan="6" class="text-center">没有找到链接</td></tr>';
+            return;
+        }
+        
+        tableBody.innerHTML = data.items.map(url => `
+            <tr>
+                <td class="url-code">${escapeHtml(url.short_code)}</td>
+                <td class="url-original" title="${escapeHtml(url.original_url)}">${escapeHtml(truncateString(url.original_url, 40))}</td>
+                <td>${escapeHtml(url.owner_name || '-')}</td>
+                <td>${url.visits}</td>
+                <td>${url.disabled ? `<span class="error" title="${escapeHtml(url.disabled_reason)}">已停用</span>` : '正常'}</td>
+                <td class="actions-cell">
+                    <div class="btn-group">
+                        ${url.disabled
+                            ? `<button class="btn btn-sm btn-outline-primary" onclick="enableLink('${url.short_code}')" title="恢复"><i class="bx bx-check-circle"></i></button>`
+                            : `<button class="btn btn-sm btn-outline-danger" onclick="disableLink('${url.short_code}')" title="停用"><i class="bx bx-block"></i></button>`}
+                        <button class="btn btn-sm btn-danger" onclick="moderateDeleteLink('${url.short_code}')" title="删除">
+                            <i class="bx bx-trash"></i>
+                        </button>
+                    </div>
+                </td>
+            </tr>
+        `).join('');
+    })
+    .catch(error => {
+        tableBody.innerHTML = '<tr><td colspan="6" class="text-center">加载失败</td></tr>';
+        showNotification(error.message, 'error');
+    });
+}
+
+// 停用链接
+function disableLink(shortCode) {
+    const reason = prompt('请输入停用原因');
+    if (!reason) return;
+    
+    authFetch(`/api/moderation/links/${shortCode}/disable`, {
+        method: 'POST',
+        body: JSON.stringify({ reason: reason })
+    })
+    .then(data => {
+        showNotification(data.message, 'success');
+        loadModerationLinks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 恢复被停用的链接
+function enableLink(shortCode) {
+    authFetch(`/api/moderation/links/${shortCode}/enable`, { method: 'POST' })
+    .then(data => {
+        showNotification(data.message, 'success');
+        loadModerationLinks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 删除任意链接
+function moderateDeleteLink(shortCode) {
+    if (!confirm(`确定删除短链接 ${shortCode} 吗？此操作不可恢复。`)) {
+        return;
+    }
+    
+    authFetch(`/api/urls/${shortCode}`, { method: 'DELETE' })
+    .then(data => {
+        showNotification(data.message || '短链接已删除', 'success');
+        loadModerationLinks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 举报类型与处理状态的显示名称
+const reportCategoryLabels = { phishing: '钓鱼或诈骗', spam: '垃圾信息', malware: '恶意软件', other: '其他' };
+const reportStatusLabels = { pending: '待处理', actioned: '已处置', dismissed: '已驳回' };
+
+// 按链接汇总的举报队列
+function loadReportSummary() {
+    const tableBody = document.getElementById('report-summary-table');
+    const pendingOnly = document.getElementById('reports-pending-only').checked;
+    
+    authFetch(`/api/moderation/reports/summary?pending=${pendingOnly}`)
+    .then(summaries => {
+        if (summaries.length === 0) {
+            tableBody.innerHTML = '<tr><td colspan="7" class="text-center">暂无举报</td></tr>';
+            return;
+        }
+        
+        tableBody.innerHTML = summaries.map(item => `
+            <tr>
+                <td class="url-code">${escapeHtml(item.short_code)}</td>
+                <td class="url-original" title="${escapeHtml(item.original_url)}">${item.original_url ? escapeHtml(truncateString(item.original_url, 40)) : '(已删除)'}</td>
+                <td>${item.pending}</td>
+                <td>${item.total}</td>
+                <td class="url-date">${formatDateTime(new Date(item.last_reported_at))}</td>
+                <td>${item.disabled ? '<span class="error">已停用</span>' : (item.original_url ? '正常' : '-')}</td>
+                <td class="actions-cell">
+                    <button class="btn btn-sm btn-outline-primary" onclick="loadReportDetails('${item.short_code}')" title="查看举报">
+                        <i class="bx bx-list-ul"></i>
+                    </button>
+                </td>
+            </tr>
+        `).join('');
+    })
+    .catch(error => {
+        tableBody.innerHTML = '<tr><td colspan="7" class="text-center">加载失败</td></tr>';
+        showNotification(error.message, 'error');
+    });
+}
+
+// 查看某个链接收到的举报
+function loadReportDetails(shortCode) {
+    const card = document.getElementById('report-detail-card');
+    const tableBody = document.getElementById('report-detail-table');
+    document.getElementById('report-detail-code').textContent = shortCode;
+    card.style.display = 'block';
+    
+    authFetch(`/api/moderation/reports?code=${encodeURIComponent(shortCode)}`)
+    .then(data => {
+        tableBody.innerHTML = data.items.map(report => `
+            <tr>
+                <td class="url-date">${formatDateTime(new Date(report.created_at))}</td>
+                <td>${reportCategoryLabels[report.category] || escapeHtml(report.category)}</td>
+                <td>${escapeHtml(report.description || '-')}</td>
+                <td>${escapeHtml(report.reporter_email || report.reporter_ip)}</td>
+                <td title="${escapeHtml(report.resolution || '')}">${reportStatusLabels[report.status] || escapeHtml(report.status)}</td>
+                <td class="actions-cell">
+                    ${report.status === 'pending' ? `
+                    <div class="btn-group">
+                        <button class="btn btn-sm btn-outline-primary" onclick="resolveReport(${report.id}, 'dismiss', '${report.short_code}')" title="驳回">
+                            <i class="bx bx-x"></i>
+                        </button>
+                        <button class="btn btn-sm btn-outline-danger" onclick="resolveReport(${report.id}, 'disable', '${report.short_code}')" title="停用链接">
+                            <i class="bx bx-block"></i>
+                        </button>
+                        <button class="btn btn-sm btn-danger" onclick="resolveReport(${report.id}, 'delete', '${report.short_code}')" title="删除链接">
+                            <i class="bx bx-trash"></i>
+                        </button>
+                    </div>` : ''}
+                </td>
+            </tr>
+        `).join('');
+        card.scrollIntoView({ behavior: 'smooth', block: 'start' });
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 处理举报，停用或删除链接时该链接的全部待处理举报一并结案
+function resolveReport(reportId, action, shortCode) {
+    let note = '';
+    if (action === 'disable') {
+        note = prompt('请输入停用原因(留空则使用举报类型)');
+        if (note === null) return;
+    } else if (action === 'delete') {
+        if (!confirm(`确定删除短链接 ${shortCode} 吗？此操作不可恢复。`)) return;
+    } else {
+        note = prompt('驳回说明(可选)') || '';
+    }
+    
+    authFetch(`/api/moderation/reports/${reportId}/resolve`, {
+        method: 'POST',
+        body: JSON.stringify({ action: action, note: note.trim() })
+    })
+    .then(data => {
+        showNotification(`${data.message}，共 ${data.resolved} 条`, 'success');
+        loadReportDetails(shortCode);
+        loadReportSummary();
+        loadModerationLinks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 当前团队空间ID，0表示个人空间
+function getActiveWorkspace() {
+    return localStorage.getItem('active_workspace') || '0';
+}
+
+// 为请求头附加当前团队空间
+function workspaceHeaders(headers) {
+    const workspaceId = getActiveWorkspace();
+    if (workspaceId !== '0') {
+        headers['X-Workspace-ID'] = workspaceId;
+    }
+    return headers;
+}
+
+const WORKSPACE_ROLE_NAMES = {
+    owner: '所有者',
+    admin: '管理员',
+    editor: '编辑者',
+    viewer: '查看者'
+};
+
+// 初始化侧边栏的团队空间切换
+function initWorkspaceSwitcher() {
+    const switcher = document.getElementById('workspace-switcher');
+    switcher.addEventListener('change', function() {
+        localStorage.setItem('active_workspace', this.value);
+        loadTabData(window.location.hash.substring(1) || 'dashboard');
+    });
+    refreshWorkspaceSwitcher();
+}
+
+// 重新加载团队空间下拉列表，当前空间已不可用时切回个人空间
+function refreshWorkspaceSwitcher() {
+    return authFetch('/api/workspaces')
+    .then(workspaces => {
+        const switcher = document.getElementById('workspace-switcher');
+        const active = getActiveWorkspace();
+        switcher.innerHTML = '<option value="0">个人空间</option>';
+        workspaces.forEach(ws => {
+            const option = document.createElement('option');
+            option.value = String(ws.ID);
+            option.textContent = ws.name;
+            switcher.appendChild(option);
+        });
+        if (!workspaces.some(ws => String(ws.ID) === active)) {
+            localStorage.setItem('active_workspace', '0');
+        }
+        switcher.value = getActiveWorkspace();
+        return workspaces;
+    })
+    .catch(error => {
+        console.error('加载团队空间失败:', error);
+        return [];
+    });
+}
+
+// 加载团队空间选项卡
+function loadWorkspaces() {
+    refreshWorkspaceSwitcher().then(workspaces => {
+        const table = document.getElementById('workspaces-table');
+        if (workspaces.length === 0) {
+            table.innerHTML = '<tr><td colspan="4" class="text-center">还没有加入任何团队空间</td></tr>';
+        } else {
+            table.innerHTML = workspaces.map(ws => `
+                <tr>
+                    <td>${escapeHtml(ws.name)}</td>
+                    <td>${WORKSPACE_ROLE_NAMES[ws.role] || ws.role}</td>
+                    <td>${ws.links_count}</td>
+                    <td>
+                        <button class="btn btn-sm btn-outline-primary" onclick="switchWorkspace(${ws.ID})">切换</button>
+                        <button class="btn btn-sm btn-outline-primary" onclick="loadWorkspaceMembers(${ws.ID}, '${ws.role}')">成员</button>
+                    </td>
+                </tr>
+            `).join('');
+        }
+    });
+    
+    authFetch('/api/workspace-invites')
+    .then(invites => {
+        const card = document.getElementById('workspace-invites-card');
+        const list = document.getElementById('workspace-invites');
+        card.style.display = invites.length ? 'block' : 'none';
+        list.innerHTML = invites.map(invite => `
+            <li class="mb-2">
+                ${escapeHtml(invite.inviter_username || '')} 邀请你以${WORKSPACE_ROLE_NAMES[invite.role]}身份加入「${escapeHtml(invite.workspace_name)}」
+                <button class="btn btn-sm btn-primary" onclick="respondInvite(${invite.id}, true)">接受</button>
+                <button class="btn btn-sm btn-outline-danger" onclick="respondInvite(${invite.id}, false)">拒绝</button>
+            </li>
+        `).join('');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 切换当前团队空间
+function switchWorkspace(workspaceId) {
+    localStorage.setItem('active_workspace', String(workspaceId));
+    document.getElementById('workspace-switcher').value = String(workspaceId);
+    window.location.hash = 'links';
+}
+
+// 将链接转移到其他团队空间
+function transferLink(code) {
+    const switcher = document.getElementById('workspace-switcher');
+    const choices = Array.from(switcher.options)
+        .filter(option => option.value !== getActiveWorkspace())
+        .map(option => `${option.value}: ${option.textContent}`)
+        .join('\n');
+    const target = prompt(`输入目标空间编号:\n${choices}`);
+    if (target === null || target.trim() === '') {
+        return;
+    }
+    
+    authFetch(`/api/urls/${code}/transfer`, {
+        method: 'POST',
+        body: JSON.stringify({ workspace_id: parseInt(target, 10) })
+    })
+    .then(() => {
+        showNotification('链接已转移', 'success');
+        loadUserLinks();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 创建团队空间
+function createWorkspace() {
+    const input = document.getElementById('workspace-name');
+    const name = input.value.trim();
+    if (!name) {
+        showNotification('请输入团队空间名称', 'error');
+        return;
+    }
+    
+    authFetch('/api/workspaces', {
+        method: 'POST',
+        body: JSON.stringify({ name: name })
+    })
+    .then(() => {
+        input.value = '';
+        showNotification('团队空间已创建', 'success');
+        loadWorkspaces();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 处理团队空间邀请
+function respondInvite(inviteId, accept) {
+    authFetch(`/api/workspace-invites/${inviteId}/${accept ? 'accept' : 'decline'}`, { method: 'POST' })
+    .then(data => {
+        showNotification(data.message, 'success');
+        loadWorkspaces();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 加载团队空间成员
+function loadWorkspaceMembers(workspaceId, myRole) {
+    const card = document.getElementById('workspace-members-card');
+    const canManage = myRole === 'owner' || myRole === 'admin';
+    card.dataset.workspaceId = workspaceId;
+    card.dataset.role = myRole;
+    card.style.display = 'block';
+    document.getElementById('workspace-invite-form').style.display = canManage ? 'block' : 'none';
+    
+    authFetch(`/api/workspaces/${workspaceId}/members`)
+    .then(members => {
+        document.getElementById('workspace-members-table').innerHTML = members.map(member => `
+            <tr>
+                <td>${escapeHtml(member.username)}</td>
+                <td>${escapeHtml(member.email || '-')}</td>
+                <td>
+                    ${canManage ? `
+                    <select class="form-control form-control-sm" onchange="updateMemberRole(${member.user_id}, this.value)">
+                        ${Object.keys(WORKSPACE_ROLE_NAMES).map(role => `<option value="${role}" ${role === member.role ? 'selected' : ''}>${WORKSPACE_ROLE_NAMES[role]}</option>`).join('')}
+                    </select>` : WORKSPACE_ROLE_NAMES[member.role]}
+                </td>
+                <td>${canManage || member.username === currentUsername() ? `<button class="btn btn-sm btn-outline-danger" onclick="removeMember(${member.user_id})">移除</button>` : ''}</td>
+            </tr>
+        `).join('');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 邀请成员
+function inviteMember() {
+    const card = document.getElementById('workspace-members-card');
+    const username = document.getElementById('invite-username').value.trim();
+    if (!username) {
+        showNotification('请输入用户名', 'error');
+        return;
+    }
+    
+    authFetch(`/api/workspaces/${card.dataset.workspaceId}/invites`, {
+        method: 'POST',
+        body: JSON.stringify({ username: username, role: document.getElementById('invite-role').value })
+    })
+    .then(() => {
+        document.getElementById('invite-username').value = '';
+        showNotification('邀请已发送', 'success');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 修改成员角色
+function updateMemberRole(userId, role) {
+    const card = document.getElementById('workspace-members-card');
+    authFetch(`/api/workspaces/${card.dataset.workspaceId}/members/${userId}`, {
+        method: 'PUT',
+        body: JSON.stringify({ role: role })
+    })
+    .then(() => showNotification('成员角色已更新', 'success'))
+    .catch(error => showNotification(error.message, 'error'))
+    .finally(() => loadWorkspaceMembers(card.dataset.workspaceId, card.dataset.role));
+}
+
+// 移除成员或退出团队空间
+function removeMember(userId) {
+    if (!confirm('确定要移除该成员吗？')) {
+        return;
+    }
+    
+    const card = document.getElementById('workspace-members-card');
+    authFetch(`/api/workspaces/${card.dataset.workspaceId}/members/${userId}`, { method: 'DELETE' })
+    .then(() => {
+        showNotification('成员已移除', 'success');
+        loadWorkspaces();
+        loadWorkspaceMembers(card.dataset.workspaceId, card.dataset.role);
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 当前登录用户名
+function currentUsername() {
+    return document.querySelector('.user-name').textContent.trim();
+}
+
+// 转义用户输入的内容，避免插入HTML
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    // 也用于属性值，引号同样需要转义
+    return div.innerHTML.replace(/"/g, '&quot;').replace(/'/g, '&#39;');
+}
+
+// 携带认证令牌请求JSON接口，非2xx响应时抛出带服务端错误信息的异常
+function authFetch(url, options = {}) {
+    const token = getAuthToken();
+    if (!token) {
+        redirectToLogin();
+        return Promise.reject(new Error('未登录'));
+    }
+    
+    options.headers = Object.assign({
+        'Authorization': `Bearer ${token}`,
+        'Content-Type': 'application/json'
+    }, options.headers || {});
+    
+    return fetch(url, options).then(response => {
+        return response.json().then(data => {
+            if (!response.ok) {
+                if (data.code === 'password_change_required' || data.code === 'two_factor_setup_required') {
+                    window.location.hash = 'security';
+                }
+                throw new Error(data.error || '请求失败');
+            }
+            return data;
+        });
+    });
+}
+
+// 加载管理员面板数据
+function loadAdminData() {
+    const token = getAuthToken();
+    if (!token) {
+        redirectToLogin();
+        return;
+    }
+    
+    // 显示加载状态
+    document.getElementById('total-users').textContent = '-';
+    document.getElementById('admin-total-links').textContent = '-';
+    document.getElementById('expired-links').textContent = '-';
+    document.getElementById('users-table').innerHTML = '<tr><td colspan="9" class="text-center">加载中...</td></tr>';
+    
+    // 获取管理员统计数据
+    fetch('/api/admin/stats', {
+        headers: {
+            'Authorization': `Bearer ${token}`
+        }
+    })
+    .then(response => {
+        if (response.status === 403) {
+            return response.json().then(data => {
+                // 管理员两步验证策略要求先完成绑定
+                if (data.code === 'two_factor_setup_required') {
+                    window.location.hash = 'security';
+                }
+                throw new Error(data.error || '加载管理员数据失败');
+            });
+        }
+        if (!response.ok) {
+            throw new Error('加载管理员数据失败');
+        }
+        return response.json();
+    })
+    .then(data => {
+        // 更新统计卡片
+        document.getElementById('total-users').textContent = data.total_users || 0;
+        document.getElementById('admin-total-links').textContent = data.total_links || 0;
+        document.getElementById('expired-links').textContent = data.expired_links || 0;
+        
+        // 确保显示总访问量
+        if (document.getElementById('admin-total-visits')) {
+            document.getElementById('admin-total-visits').textContent = data.total_visits || 0;
+        }
+        
+        renderVisitLoggingStatus(data.visit_logging);
+        
+        // 加载用户列表
+        loadUsersList();
+        
+        // 添加清理按钮事件
+        document.getElementById('cleanup-btn').addEventListener('click', cleanupExpiredUrls);
+        
+        // 添加备份按钮事件
+        document.getElementById('backup-btn').addEventListener('click', exportSystemData);
+        
+        document.getElementById('erase-ip-btn').onclick = eraseVisitorData;
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        showNotification('加载管理员数据失败', 'error');
+    });
+}
+
+const VISIT_LOGGING_NAMES = {
+    full: '记录全部明细',
+    sampled: '抽样记录明细',
+    counts_only: '只统计次数'
+};
+
+// 显示访问明细的记录方式和丢失情况
+function renderVisitLoggingStatus(status) {
+    const el = document.getElementById('visit-logging-status');
+    if (!status) {
+        el.textContent = '';
+        return;
+    }
+    
+    let mode = VISIT_LOGGING_NAMES[status.mode] || status.mode;
+    if (status.mode === 'sampled') {
+        mode += ` (${Math.round(status.sample_rate * 1000) / 10}%)`;
+    }
+    el.innerHTML = `访问明细: ${escapeHtml(mode)}，启动以来已写入 ${status.recorded} 条，待写入 ${status.buffered} 条` +
+        (status.dropped || status.failed
+            ? `，<span class="error">丢弃 ${status.dropped} 条，写入失败 ${status.failed} 条</span>`
+            : '');
+}
+
+// 加载用户列表
+function loadUsersList() {
+    const token = getAuthToken();
+    if (!token) {
+        redirectToLogin();
+        return;
+    }
+    
+    const usersTable = document.getElementById('users-table');
+    
+    fetch('/api/admin/users', {
+        headers: {
+            'Authorization': `Bearer ${token}`
+        }
+    })
+    .then(response => {
+        if (!response.ok) {
+            throw new Error('加载用户列表失败');
+        }
+        return response.json();
+    })
+    .then(users => {
+        if (users.length === 0) {
+            usersTable.innerHTML = '<tr><td colspan="9" class="text-center">暂无用户数据</td></tr>';
+            return;
+        }
+        
+        usersTable.innerHTML = '';
+        users.forEach(user => {
+            const row = document.createElement('tr');
+            
+            // 格式化日期
+            const createdAt = new Date(user.CreatedAt);
+            const lastLogin = new Date(user.last_login_at);
+            // 管理员创建且从未登录的账户没有登录时间
+            const lastLoginText = lastLogin.getFullYear() > 1 ? formatDateTime(lastLogin) : '从未登录';
+            
+            row.innerHTML = `
+                <td>${user.ID}</td>
+                <td>${escapeHtml(user.username)}</td>
+                <td>${escapeHtml(user.email)}</td>
+                <td>${formatDateTime(createdAt)}</td>
+                <td>
+                    <select class="form-control form-control-sm" onchange="setUserRole(${user.ID}, this)" data-current="${user.role}">
+                        ${Object.entries(ROLE_NAMES).map(([value, name]) =>
+                            `<option value="${value}" ${user.role === value ? 'selected' : ''}>${name}</option>`).join('')}
+                    </select>
+                </td>
+                <td>${user.links_count || 0}</td>
+                <td>${lastLoginText}</td>
+                <td>${user.disabled ? '<span class="error">已禁用</span>' : '正常'}</td>
+                <td class="actions-cell">
+                    <div class="btn-group">
+                        <button class="btn btn-sm btn-outline-primary" onclick="viewUserLinks(${user.ID})" title="查看链接">
+                            <i class="bx bx-link"></i>
+                        </button>
+                        <button class="btn btn-sm btn-outline-primary" onclick="editUser(${user.ID})" title="编辑">
+                            <i class="bx bx-edit"></i>
+                        </button>
+                        <button class="btn btn-sm btn-outline-primary" onclick="setUserPlan(${user.ID}, '${escapeHtml(user.plan || '')}')" title="套餐">
+                            <i class="bx bx-package"></i>
+                        </button>
+                        <button class="btn btn-sm btn-outline-danger" onclick="resetUserPassword(${user.ID})" title="重置密码">
+                            <i class="bx bx-reset"></i>
+                        </button>
+                        ${user.disabled
+                            ? `<button class="btn btn-sm btn-outline-primary" onclick="setUserDisabled(${user.ID}, false)" title="启用"><i class="bx bx-check-circle"></i></button>`
+                            : `<button class="btn btn-sm btn-outline-danger" onclick="setUserDisabled(${user.ID}, true)" title="禁用"><i class="bx bx-block"></i></button>`}
+                        <button class="btn btn-sm btn-danger" onclick="deleteUser(${user.ID})" title="删除">
+                            <i class="bx bx-trash"></i>
+                        </button>
+                    </div>
+                </td>
+            `;
+            
+            row.dataset.username = user.username;
+            row.dataset.email = user.email || '';
+            row.id = `user-row-${user.ID}`;
+            usersTable.appendChild(row);
+        });
+    })
+    .catch(error => {
+        console.error('Error:', error);
+        usersTable.innerHTML = '<tr><td colspan="9" class="text-center">加载失败，请刷新页面重试</td></tr>';
+        showNotification('加载用户列表失败', 'error');
+    });
+}
+
+// 角色显示名称
+const ROLE_NAMES = {
+    viewer: '访客',
+    editor: '用户',
+    moderator: '审核员',
+    admin: '管理员'
+};
+
+// 修改用户角色
+function setUserRole(userId, select) {
+    const role = select.value;
+    const previous = select.getAttribute('data-current');
+    
+    if (!confirm(`确定将该用户的角色修改为「${ROLE_NAMES[role]}」吗？`)) {
+        select.value = previous;
+        return;
+    }
+    
+    authFetch(`/api/admin/users/${userId}/role`, {
+        method: 'PUT',
+        body: JSON.stringify({ role: role })
+    })
+    .then(data => {
+        select.setAttribute('data-current', role);
+        showNotification(data.message, 'success');
+    })
+    .catch(error => {
+        select.value = previous;
+        showNotification(error.message, 'error');
+    });
+}
+
+// 修改用户套餐，留空恢复为默认套餐
+function setUserPlan(userId, currentPlan) {
+    authFetch('/api/admin/plans')
+    .then(data => {
+        const names = Object.keys(data.plans || {});
+        if (names.length === 0) {
+            showNotification('未配置任何套餐', 'info');
+            return;
+        }
+        
+        const plan = prompt(`可选套餐: ${names.join('、')}\n留空使用默认套餐(${data.default_plan})`, currentPlan);
+        if (plan === null) return;
+        
+        return authFetch(`/api/admin/users/${userId}/plan`, {
+            method: 'PUT',
+            body: JSON.stringify({ plan: plan.trim() })
+        })
+        .then(result => {
+            showNotification(result.message, 'success');
+            loadUsersList();
+        });
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 重置用户密码，生成的临时密码只显示一次
+function resetUserPassword(userId) {
+    if (!confirm('确定重置该用户的密码吗？用户的所有登录会话将失效，下次登录后需修改密码。')) {
+        return;
+    }
+    
+    authFetch(`/api/admin/users/${userId}/reset-password`, { method: 'POST' })
+    .then(data => {
+        prompt('临时密码只显示一次，请通过安全渠道告知用户:', data.temporary_password);
+        showNotification(data.message, 'success');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 创建用户，未填写密码时显示服务端生成的临时密码
+function createUser() {
+    const username = document.getElementById('new-user-username').value.trim();
+    if (username.length < 3) {
+        showNotification('用户名长度至少需要3个字符', 'error');
+        return;
+    }
+    
+    authFetch('/api/admin/users', {
+        method: 'POST',
+        body: JSON.stringify({
+            username: username,
+            email: document.getElementById('new-user-email').value.trim(),
+            password: document.getElementById('new-user-password').value,
+            role: document.getElementById('new-user-role').value
+        })
+    })
+    .then(data => {
+        ['new-user-username', 'new-user-email', 'new-user-password'].forEach(id => {
+            document.getElementById(id).value = '';
+        });
+        if (data.temporary_password) {
+            prompt('临时密码只显示一次，请通过安全渠道告知用户:', data.temporary_password);
+        }
+        showNotification(data.message, 'success');
+        loadUsersList();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 修改用户名和邮箱
+function editUser(userId) {
+    const row = document.getElementById(`user-row-${userId}`);
+    const username = prompt('用户名', row.dataset.username);
+    if (username === null) return;
+    const email = prompt('电子邮箱', row.dataset.email);
+    if (email === null) return;
+    
+    authFetch(`/api/admin/users/${userId}`, {
+        method: 'PATCH',
+        body: JSON.stringify({ username: username.trim(), email: email.trim() })
+    })
+    .then(data => {
+        showNotification(data.message, 'success');
+        loadUsersList();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 禁用或启用账户
+function setUserDisabled(userId, disabled) {
+    if (disabled && !confirm('确定禁用该账户吗？该用户将立即退出所有设备且无法登录。')) {
+        return;
+    }
+    
+    authFetch(`/api/admin/users/${userId}/${disabled ? 'disable' : 'enable'}`, { method: 'POST' })
+    .then(data => {
+        showNotification(data.message, 'success');
+        loadUsersList();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 删除用户，可选择删除其个人链接或转移给其他用户
+function deleteUser(userId) {
+    const username = document.getElementById(`user-row-${userId}`).dataset.username;
+    if (!confirm(`确定删除用户「${username}」吗？此操作不可恢复。`)) {
+        return;
+    }
+    
+    const transferTo = prompt('如需保留该用户的个人链接，请输入接收链接的用户ID；留空则删除其全部个人链接');
+    if (transferTo === null) return;
+    
+    const query = transferTo.trim() ? `transfer_to=${encodeURIComponent(transferTo.trim())}` : 'links=delete';
+    authFetch(`/api/admin/users/${userId}?${query}`, { method: 'DELETE' })
+    .then(data => {
+        showNotification(data.message, 'success');
+        loadAdminData();
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+// 清理过期URL
+// 删除某个IP在所有链接上的访问明细
+function eraseVisitorData() {
+    const input = document.getElementById('erase-ip');
+    const ip = input.value.trim();
+    if (!ip) {
+        showNotification('请输入IP地址', 'error');
+        return;
+    }
+    if (!confirm(`确定要删除 ${ip} 的全部访问明细吗？此操作不可恢复`)) {
+        return;
+    }
+    authFetch('/api/admin/visits/erase', {
+        method: 'POST',
+        body: JSON.stringify({ ip: ip })
+    })
+    .then(data => {
+        input.value = '';
+        showNotification(`已删除 ${data.erased} 条访问明细`, 'success');
+    })
+    .catch(error => showNotification(error.message, 'error'));
+}
+
+function cleanupExpiredUrls() {
+    if (!confirm('确定要清理所有过期的短链接？此操作不可恢复。')) {
+        return;
+    }
+    
+    const token = getAuthToken();
+    if (!token) {
+        redirectToLogin();
+        return;
+    }
+    
+    const cleanupBtn = document.getElementById('cleanup-btn');
+    
+    // 显示加载状态
+    cleanupBtn.disabled = true;
+    cleanupBtn.innerHTML = '<i class="bx bx-loader-alt bx-spin"></i> 清理中...';
+    
+    fetch('/api/urls/cleanup', {
+        method: 'POST',
+        headers: {
+            'Authorization': `Bearer ${token}`
+        }
+    })
+    .then(response => {
+        if (!response.ok) {
+            throw new Error('清理过期链接失败');
+        }
+        return response.json();
+    })
+    .then(data => {
         cleanupBtn.disabled = false;
         cleanupBtn.innerHTML = '<i class="bx bx-trash"></i> 清理过期链接';
         
@@ -938,7 +2519,10 @@ function exportStats(code) {
         return;
     }
     
-    window.open(`/api/urls/${code}/export?token=${token}`, '_blank');
+    // 导出与页面上选择的时间范围一致
+    const format = document.getElementById('export-format').value;
+    const visits = document.getElementById('export-visits').checked;
+    window.open(`/api/urls/${code}/export?format=${format}&visits=${visits}&${statsRangeQuery('stats-range', 'stats-interval')}&token=${token}`, '_blank');
     showNotification('统计数据导出已开始', 'success');
 }
 
@@ -990,9 +2574,47 @@ function addEventListeners() {
         createBtn.addEventListener('click', createShortUrl);
     }
     
+    // 统计时间范围变化时重新加载
+    ['dashboard-range', 'dashboard-interval'].forEach(id => {
+        document.getElementById(id).addEventListener('change', loadDashboardData);
+    });
+    ['stats-range', 'stats-interval'].forEach(id => {
+        document.getElementById(id).addEventListener('change', () => {
+            if (currentStatsCode) {
+                selectUrlForStats(currentStatsCode);
+            }
+        });
+    });
+    ['campaign-range', 'campaign-interval'].forEach(id => {
+        document.getElementById(id).addEventListener('change', () => {
+            if (currentCampaignId) {
+                loadCampaignStats(currentCampaignId);
+            }
+        });
+    });
+    
     // 注册其他事件...
 }
 
+// statsRangeQuery 根据时间范围和粒度选择框生成查询参数，按浏览器时区统计
+function statsRangeQuery(rangeId, intervalId) {
+    const days = parseInt(document.getElementById(rangeId).value, 10);
+    const from = new Date();
+    from.setDate(from.getDate() - days + 1);
+    const pad = n => String(n).padStart(2, '0');
+    return new URLSearchParams({
+        from: `${from.getFullYear()}-${pad(from.getMonth() + 1)}-${pad(from.getDate())}`,
+        interval: document.getElementById(intervalId).value,
+        tz: Intl.DateTimeFormat().resolvedOptions().timeZone || ''
+    }).toString();
+}
+
+// responseError 从失败的响应中读取错误信息
+function responseError(response, fallback) {
+    return response.json()
+        .then(data => new Error(data.error || fallback), () => new Error(fallback));
+}
+
 // 创建短链接
 function createShortUrl() {
     const token = getAuthToken();
@@ -1003,6 +2625,13 @@ function createShortUrl() {
     
     const originalUrl = document.getElementById('create-url').value.trim();
     const expiration = document.getElementById('create-expiration').value;
+    const alias = document.getElementById('create-alias').value.trim();
+    const campaignId = parseInt(document.getElementById('create-campaign').value, 10) || 0;
+    const noTracking = document.getElementById('create-no-tracking').checked;
+    const utm = {};
+    UTM_FIELDS.forEach(field => {
+        utm[field] = document.getElementById(`create-${field.replace('_', '-')}`).value.trim();
+    });
     const createBtn = document.getElementById('create-btn');
     const resultDiv = document.getElementById('create-result');
     
@@ -1023,21 +2652,25 @@ function createShortUrl() {
     
     fetch('/api/urls', {
         method: 'POST',
-        headers: {
+        headers: workspaceHeaders({
             'Content-Type': 'application/json',
             'Authorization': `Bearer ${token}`
-        },
-        body: JSON.stringify({
+        }),
+        body: JSON.stringify(Object.assign({
             original_url: originalUrl,
-            expires_in: expiration
-        })
+            expires_in: expiration,
+            alias: alias,
+            campaign_id: campaignId,
+            no_tracking: noTracking
+        }, utm))
     })
-    .then(response => {
+    .then(response => response.json().then(data => {
         if (!response.ok) {
-            throw new Error('创建短链接失败');
+            // 超出套餐限额等错误直接展示服务端的说明
+            throw new Error(data.error || '创建短链接失败');
         }
-        return response.json();
-    })
+        return data;
+    }))
     .then(data => {
         // 恢复按钮状态
         createBtn.disabled = false;
@@ -1059,6 +2692,12 @@ function createShortUrl() {
         
         // 清空输入框
         document.getElementById('create-url').value = '';
+        document.getElementById('create-alias').value = '';
+        document.getElementById('create-no-tracking').checked = false;
+        UTM_FIELDS.forEach(field => {
+            document.getElementById(`create-${field.replace('_', '-')}`).value = '';
+        });
+        loadQuotaUsage();
         
         // 刷新仪表盘数据
         if (document.getElementById('dashboard').classList.contains('active')) {
@@ -1069,10 +2708,33 @@ function createShortUrl() {
         console.error('Error:', error);
         createBtn.disabled = false;
         createBtn.innerHTML = '创建短链接';
-        showNotification('创建短链接失败', 'error');
+        showNotification(error.message, 'error');
     });
 }
 
+// 显示当前套餐的用量
+function loadQuotaUsage() {
+    const usageText = document.getElementById('quota-usage');
+    
+    authFetch('/api/quota')
+    .then(usage => {
+        if (usage.unlimited) {
+            usageText.textContent = '';
+            return;
+        }
+        const limit = value => value > 0 ? value : '不限';
+        usageText.textContent = `当前套餐: ${usage.plan} | 有效链接 ${usage.active_links}/${limit(usage.limits.max_active_links)}` +
+            ` | 今日创建 ${usage.links_today}/${limit(usage.limits.max_links_per_day)}` +
+            ` | 最长有效期 ${usage.limits.max_expiry_days > 0 ? usage.limits.max_expiry_days + '天' : '不限'}`;
+        
+        const aliasAllowed = (usage.limits.features || []).includes('custom_alias');
+        const aliasInput = document.getElementById('create-alias');
+        aliasInput.disabled = !aliasAllowed;
+        aliasInput.placeholder = aliasAllowed ? '可选，3到10位字母、数字、下划线或连字符' : '当前套餐不支持自定义短码';
+    })
+    .catch(error => console.error('加载套餐用量失败:', error));
+}
+
 // 复制到剪贴板
 function copyToClipboard(text) {
     if (navigator.clipboard) {
@@ -1105,10 +2767,29 @@ function copyToClipboard(text) {
 
 // 退出登录
 function logout() {
-    // 删除认证Cookie
-    document.cookie = 'auth_token=; path=/; expires=Thu, 01 Jan 1970 00:00:01 GMT;';
-    // 重定向到首页
-    window.location.href = '/';
+    const token = getAuthToken();
+    const clearSession = () => {
+        // 删除认证Cookie和刷新令牌
+        document.cookie = 'auth_token=; path=/; expires=Thu, 01 Jan 1970 00:00:01 GMT;';
+        localStorage.removeItem('refresh_token');
+        // 重定向到首页
+        window.location.href = '/';
+    };
+
+    if (!token) {
+        clearSession();
+        return;
+    }
+
+    // 通知服务端吊销当前会话
+    fetch('/api/auth/logout', {
+        method: 'POST',
+        headers: {
+            'Authorization': `Bearer ${token}`
+        }
+    })
+    .catch(error => console.error('Error:', error))
+    .finally(clearSession);
 }
 
 // 辅助函数 - 获取认证令牌
@@ -1148,15 +2829,6 @@ function formatDateTime(date) {
     });
 }
 
-// 格式化日期
-function formatDate(date) {
-    return date.toLocaleDateString('zh-CN', {
-        year: 'numeric',
-        month: '2-digit',
-        day: '2-digit'
-    });
-}
-
 // 通知系统
 function showNotification(message, type = 'info') {
     const notificationsContainer = document.getElementById('notifications');
@@ -0,0 +1,50 @@
+document.addEventListener('DOMContentLoaded', function() {
+    const codeInput = document.getElementById('report-code');
+    const categorySelect = document.getElementById('report-category');
+    const descriptionInput = document.getElementById('report-description');
+    const emailInput = document.getElementById('report-email');
+    const reportBtn = document.getElementById('reportBtn');
+    const errorMessage = document.getElementById('report-error-message');
+    
+    // 提交举报
+    reportBtn.addEventListener('click', function() {
+        // 允许粘贴完整的短链接，只取最后一段作为短码
+        const shortCode = codeInput.value.trim().replace(/\/+$/, '').split('/').pop();
+        if (!shortCode) {
+            errorMessage.textContent = '请输入要举报的短链接';
+            return;
+        }
+        
+        errorMessage.textContent = '';
+        reportBtn.disabled = true;
+        reportBtn.innerHTML = '<i class="bx bx-loader-alt bx-spin"></i> 提交中...';
+        
+        fetch('/api/reports', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({
+                short_code: shortCode,
+                category: categorySelect.value,
+                description: descriptionInput.value.trim(),
+                email: emailInput.value.trim()
+            }),
+        })
+        .then(response => response.json().then(data => {
+            if (!response.ok) {
+                throw new Error(data.error || '提交举报失败');
+            }
+            return data;
+        }))
+        .then(() => {
+            document.getElementById('report-card').style.display = 'none';
+            document.getElementById('report-done-card').style.display = 'block';
+        })
+        .catch(error => {
+            errorMessage.textContent = error.message;
+            reportBtn.disabled = false;
+            reportBtn.textContent = '提交举报';
+        });
+    });
+});